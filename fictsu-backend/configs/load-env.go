@@ -3,6 +3,11 @@ package config
 import (
 	"os"
 	"log"
+	"time"
+	"strings"
+	"strconv"
+	"net/url"
+	"net/http"
 
 	"github.com/joho/godotenv"
 )
@@ -12,19 +17,57 @@ var (
 	ClientSecret      	string
 	ClientCallbackURL 	string
 
+	GitHubClientID 		string
+	GitHubClientSecret 	string
+	GitHubCallbackURL 	string
+
+	DiscordClientID 	string
+	DiscordClientSecret string
+	DiscordCallbackURL 	string
+
 	OpenAIKey    		string
 	OpenAIOrgID  		string
 	OpenAIProjID 		string
 
+	LLMProvider 		string
+	LLMBaseURL 			string
+	LLMAPIKey 			string
+
+	StorylineModel 		string
+	CharacterModel 		string
+	BackgroundModel 	string
+	CoverModel 			string
+	AssistantModel 		string
+	ChapterToolsModel 	string
+	TranslationModel 	string
+
+	AssistantContextTokens int
+
+	AIDailyRequestLimit int
+	AIDailyTokenLimit 	int
+
 	SessionKey 			string
 
+	SessionIdleTimeout 		time.Duration
+	SessionAbsoluteTimeout 	time.Duration
+
+	CookieSecure 		bool
+	CookieDomain 		string
+	CookieSameSite 		http.SameSite
+
+	RateLimitBackend 	string
+	TrustedProxies 		[]string
+
 	FrontEndURL 		string
+	AllowedOrigins 		[]string
 
 	CoverPath  			string
+	AvatarPath 			string
 	BucketName 			string
 
 	CharImagePath 		string
 	BGImagePath  		string
+	PageImagePath 		string
 )
 
 func LoadEnv() {
@@ -37,25 +80,183 @@ func LoadEnv() {
 	ClientSecret 		= os.Getenv("CLIENT_SECRET")
 	ClientCallbackURL 	= os.Getenv("CLIENT_CALLBACK_URL")
 
+	// Optional, a provider is only enabled when its client ID is set
+	GitHubClientID 		= os.Getenv("GITHUB_CLIENT_ID")
+	GitHubClientSecret 	= os.Getenv("GITHUB_CLIENT_SECRET")
+	GitHubCallbackURL 	= os.Getenv("GITHUB_CALLBACK_URL")
+
+	DiscordClientID 	= os.Getenv("DISCORD_CLIENT_ID")
+	DiscordClientSecret = os.Getenv("DISCORD_CLIENT_SECRET")
+	DiscordCallbackURL 	= os.Getenv("DISCORD_CALLBACK_URL")
+
 	OpenAIKey 			= os.Getenv("OPENAI_KEY")
 	OpenAIOrgID 		= os.Getenv("OPENAI_ORG_ID")
 	OpenAIProjID 		= os.Getenv("OPENAI_PROJ_ID")
 
+	// "openai" or "local" for any OpenAI-compatible server such as Ollama or llama.cpp
+	LLMProvider 		= strings.ToLower(GetEnvDefault("LLM_PROVIDER", "openai"))
+	LLMBaseURL 			= os.Getenv("LLM_BASE_URL")
+	LLMAPIKey 			= os.Getenv("LLM_API_KEY")
+
+	// Each AI feature can run on its own model
+	StorylineModel 		= GetEnvDefault("LLM_MODEL_STORYLINE", "gpt-4o")
+	CharacterModel 		= GetEnvDefault("LLM_MODEL_CHARACTER", "dall-e-3")
+	BackgroundModel 	= GetEnvDefault("LLM_MODEL_BACKGROUND", "dall-e-3")
+	CoverModel 			= GetEnvDefault("LLM_MODEL_COVER", "dall-e-3")
+	AssistantModel 		= GetEnvDefault("LLM_MODEL_ASSISTANT", "gpt-4o")
+	ChapterToolsModel 	= GetEnvDefault("LLM_MODEL_CHAPTER_TOOLS", "gpt-4o")
+	TranslationModel 	= GetEnvDefault("LLM_MODEL_TRANSLATION", "gpt-4o")
+
+	// Token budget for an assistant request, keep it below the context window of LLM_MODEL_ASSISTANT
+	AssistantContextTokens = GetEnvInt("LLM_ASSISTANT_CONTEXT_TOKENS", 16000)
+
+	// Per-user defaults, super users are unlimited and can override these per user
+	AIDailyRequestLimit = GetEnvInt("AI_DAILY_REQUEST_LIMIT", 50)
+	AIDailyTokenLimit 	= GetEnvInt("AI_DAILY_TOKEN_LIMIT", 100000)
+
 	SessionKey 			= os.Getenv("SESSION_KEY")
 
+	SessionIdleTimeout 		= GetEnvDuration("SESSION_IDLE_TIMEOUT", 7 * 24 * time.Hour)
+	SessionAbsoluteTimeout 	= GetEnvDuration("SESSION_ABSOLUTE_TIMEOUT", 30 * 24 * time.Hour)
+
+	CookieSecure 		= GetEnvBool("COOKIE_SECURE", false)
+	CookieDomain 		= os.Getenv("COOKIE_DOMAIN")
+	CookieSameSite 		= GetEnvSameSite("COOKIE_SAMESITE", http.SameSiteLaxMode)
+
+	// "memory" is enough for a single instance, "postgres" shares counters between instances
+	RateLimitBackend 	= strings.ToLower(os.Getenv("RATE_LIMIT_BACKEND"))
+	if RateLimitBackend == "" {
+		RateLimitBackend = "memory"
+	}
+
+	if RateLimitBackend != "memory" && RateLimitBackend != "postgres" {
+		log.Fatalf("Invalid RATE_LIMIT_BACKEND: must be memory or postgres")
+	}
+
+	// Comma-separated IPs or CIDRs of the reverse proxies in front of the API, their X-Forwarded-For is believed.
+	// Empty trusts none and the client IP is always the connection's address.
+	TrustedProxies 		= []string{}
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			TrustedProxies = append(TrustedProxies, proxy)
+		}
+	}
+
 	FrontEndURL 		= os.Getenv("FRONT_END_URL")
 
+	// FRONT_END_URL is always allowed, ALLOWED_ORIGINS adds comma-separated extras
+	AllowedOrigins 		= []string{strings.TrimSuffix(FrontEndURL, "/")}
+	for _, origin := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			AllowedOrigins = append(AllowedOrigins, origin)
+		}
+	}
+
+	// The CORS middleware panics on a malformed origin, so fail here with a message that names the variable
+	for _, origin := range AllowedOrigins {
+		originURL, err := url.Parse(origin)
+		if err != nil || (originURL.Scheme != "http" && originURL.Scheme != "https") || originURL.Host == "" || originURL.Path != "" || originURL.RawQuery != "" {
+			log.Fatalf("Invalid FRONT_END_URL or ALLOWED_ORIGINS entry %q: must be an origin like https://fictsu.example", origin)
+		}
+	}
+
 	CoverPath 			= os.Getenv("COVER_PATH")
+	AvatarPath 			= os.Getenv("AVATAR_PATH")
 	BucketName 			= os.Getenv("BUCKET_NAME")
 
 	CharImagePath 		= os.Getenv("CHAR_IMG_PATH")
 	BGImagePath 		= os.Getenv("BG_IMG_PATH")
+	PageImagePath 		= os.Getenv("PAGE_IMG_PATH")
 
 	// Fail fast if any required environment variable is missing
-	if OpenAIKey == "" || OpenAIOrgID == "" || OpenAIProjID == "" ||
-	ClientID == "" || ClientSecret == "" || ClientCallbackURL == "" ||
-	SessionKey == "" || FrontEndURL == "" || CoverPath == "" || BucketName == "" ||
-	CharImagePath == "" || BGImagePath == "" {
+	if ClientID == "" || ClientSecret == "" || ClientCallbackURL == "" ||
+	SessionKey == "" || FrontEndURL == "" || CoverPath == "" || AvatarPath == "" || BucketName == "" ||
+	CharImagePath == "" || BGImagePath == "" || PageImagePath == "" {
 		log.Fatal("Missing one or more required environment variables")
 	}
+
+	switch LLMProvider {
+	case "openai":
+		if OpenAIKey == "" || OpenAIOrgID == "" || OpenAIProjID == "" {
+			log.Fatal("LLM_PROVIDER=openai requires OPENAI_KEY, OPENAI_ORG_ID and OPENAI_PROJ_ID")
+		}
+	case "local":
+		if LLMBaseURL == "" {
+			log.Fatal("LLM_PROVIDER=local requires LLM_BASE_URL")
+		}
+	default:
+		log.Fatalf("Invalid LLM_PROVIDER: must be openai or local")
+	}
+
+	// Browsers drop SameSite=None cookies that are not Secure
+	if CookieSameSite == http.SameSiteNoneMode && !CookieSecure {
+		log.Fatal("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+	}
+}
+
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid duration for %s: %q", key, value)
+	}
+
+	return duration
+}
+
+func GetEnvDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	integer, err := strconv.Atoi(value)
+	if err != nil || integer < 0 {
+		log.Fatalf("Invalid integer for %s: %q", key, value)
+	}
+
+	return integer
+}
+
+func GetEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	boolean, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid boolean for %s: %q", key, value)
+	}
+
+	return boolean
+}
+
+func GetEnvSameSite(key string, fallback http.SameSite) http.SameSite {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "":
+		return fallback
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		log.Fatalf("Invalid SameSite for %s: must be lax, strict or none", key)
+	}
+
+	return fallback
 }
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type RateLimitResult struct {
+	Count int
+	Reset time.Time
+}
+
+// Fixed-window counters, the window of a key starts with its first request
+type RateLimiter interface {
+	Hit(key string, window time.Duration) (RateLimitResult, error)
+	PeriodicCleanup(interval time.Duration)
+}
+
+// Keeps counters in process memory, only correct when a single backend instance is running
+type MemoryRateLimiter struct {
+	mutex    sync.Mutex
+	counters map[string]*RateLimitResult
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		counters: map[string]*RateLimitResult{},
+	}
+}
+
+func (limiter *MemoryRateLimiter) Hit(key string, window time.Duration) (RateLimitResult, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	counter, ok := limiter.counters[key]
+	if !ok || !counter.Reset.After(now) {
+		counter = &RateLimitResult{Reset: now.Add(window)}
+		limiter.counters[key] = counter
+	}
+
+	counter.Count++
+	return *counter, nil
+}
+
+func (limiter *MemoryRateLimiter) PeriodicCleanup(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		limiter.mutex.Lock()
+		now := time.Now()
+		for key, counter := range limiter.counters {
+			if !counter.Reset.After(now) {
+				delete(limiter.counters, key)
+			}
+		}
+
+		limiter.mutex.Unlock()
+	}
+}
+
+// Keeps counters in the RateLimits table so every backend instance shares them
+type PostgresRateLimiter struct{}
+
+func NewPostgresRateLimiter() *PostgresRateLimiter {
+	return &PostgresRateLimiter{}
+}
+
+func (limiter *PostgresRateLimiter) Hit(key string, window time.Duration) (RateLimitResult, error) {
+	now := time.Now().UTC()
+	result := RateLimitResult{}
+	err := DB.QueryRow(
+		`
+		INSERT INTO RateLimits (Key, Count, Reset)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (Key) DO UPDATE
+		SET
+			Count = CASE WHEN RateLimits.Reset <= $3 THEN 1 ELSE RateLimits.Count + 1 END,
+			Reset = CASE WHEN RateLimits.Reset <= $3 THEN EXCLUDED.Reset ELSE RateLimits.Reset END
+		RETURNING Count, Reset
+		`,
+		key,
+		now.Add(window),
+		now,
+	).Scan(
+		&result.Count,
+		&result.Reset,
+	)
+
+	return result, err
+}
+
+func (limiter *PostgresRateLimiter) PeriodicCleanup(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		if _, err := DB.Exec("DELETE FROM RateLimits WHERE Reset <= $1", time.Now().UTC()); err != nil {
+			log.Printf("Error cleaning up rate limits: %v", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"sync"
+	"time"
+	"testing"
+)
+
+func TestMemoryRateLimiterHit(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      []string
+		wantCount []int
+	}{
+		{name: "counts one key", keys: []string{"a", "a", "a"}, wantCount: []int{1, 2, 3}},
+		{name: "keys count apart", keys: []string{"a", "b", "a", "b", "c"}, wantCount: []int{1, 1, 2, 2, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewMemoryRateLimiter()
+			for i, key := range test.keys {
+				result, err := limiter.Hit(key, time.Minute)
+				if err != nil || result.Count != test.wantCount[i] {
+					t.Fatalf("hit %d on %q = %d, %v, want %d", i + 1, key, result.Count, err, test.wantCount[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimiterWindowReset(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	window := 20 * time.Millisecond
+	first, _ := limiter.Hit("a", window)
+	second, _ := limiter.Hit("a", window)
+	if second.Count != 2 || !second.Reset.Equal(first.Reset) {
+		t.Fatalf("second hit = %+v, want count 2 in the window ending %v", second, first.Reset)
+	}
+
+	time.Sleep(window + 5 * time.Millisecond)
+	third, _ := limiter.Hit("a", window)
+	if third.Count != 1 || !third.Reset.After(first.Reset) {
+		t.Fatalf("hit after the window = %+v, want a new window with count 1", third)
+	}
+}
+
+func TestMemoryRateLimiterConcurrentHits(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	group := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			limiter.Hit("a", time.Minute)
+		}()
+	}
+
+	group.Wait()
+	if result, _ := limiter.Hit("a", time.Minute); result.Count != 101 {
+		t.Fatalf("got count %d, want 101", result.Count)
+	}
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"log"
+	"net"
+	"time"
+	"bytes"
+	"context"
+	"net/http"
+	"crypto/rand"
+	"database/sql"
+	"encoding/gob"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/base64"
+	"github.com/gorilla/sessions"
+	"github.com/gorilla/securecookie"
+)
+
+// PostgresStore keeps session data in the Sessions table, the cookie only carries a signed random token.
+// Only the SHA-256 hash of the token is stored, so a leaked table can not be replayed as cookies.
+type PostgresStore struct {
+	Codecs          []securecookie.Codec
+	Options         *sessions.Options
+	SameSite        http.SameSite
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+func NewPostgresStore(idleTimeout time.Duration, absoluteTimeout time.Duration, keyPairs ...[]byte) *PostgresStore {
+	return &PostgresStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(absoluteTimeout.Seconds()),
+			HttpOnly: true,
+		},
+		SameSite:        http.SameSiteLaxMode,
+		IdleTimeout:     idleTimeout,
+		AbsoluteTimeout: absoluteTimeout,
+	}
+}
+
+func (store *PostgresStore) Get(request *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(request).Get(store, name)
+}
+
+func (store *PostgresStore) New(request *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(store, name)
+	options := *store.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	// A tampered, expired or revoked cookie simply starts a fresh, logged-out session
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, store.Codecs...); err != nil {
+		return session, nil
+	}
+
+	var sessionID int
+	var data []byte
+	var stale bool
+	errLoad := DB.QueryRow(
+		`
+		SELECT
+			ID, Data, Last_Seen < NOW() - INTERVAL '1 minute' OR IP IS DISTINCT FROM $2 OR User_Agent IS DISTINCT FROM $3
+		FROM
+			Sessions
+		WHERE
+			Token_Hash = $1 AND Last_Seen > $4 AND Created > $5
+		`,
+		HashSessionToken(token),
+		ClientIP(request),
+		request.UserAgent(),
+		time.Now().Add(-store.IdleTimeout),
+		time.Now().Add(-store.AbsoluteTimeout),
+	).Scan(
+		&sessionID,
+		&data,
+		&stale,
+	)
+
+	if errLoad != nil {
+		if errLoad != sql.ErrNoRows {
+			log.Printf("Error loading session: %v", errLoad)
+		}
+
+		return session, nil
+	}
+
+	// Only write the row once a minute, or when the client moved, so reads and streams do not update it every time
+	if stale {
+		_, errTouch := DB.Exec(
+			"UPDATE Sessions SET Last_Seen = NOW(), IP = $1, User_Agent = $2 WHERE ID = $3",
+			ClientIP(request),
+			request.UserAgent(),
+			sessionID,
+		)
+
+		if errTouch != nil {
+			log.Printf("Error updating session activity: %v", errTouch)
+		}
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, nil
+	}
+
+	session.ID = token
+	session.IsNew = false
+	return session, nil
+}
+
+func (store *PostgresStore) Save(request *http.Request, writer http.ResponseWriter, session *sessions.Session) error {
+	// MaxAge < 0 is how handlers log out, drop the row as well as the cookie
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := DB.Exec("DELETE FROM Sessions WHERE Token_Hash = $1", HashSessionToken(session.ID)); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(writer, store.newCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		token, err := GenerateSessionToken()
+		if err != nil {
+			return err
+		}
+
+		session.ID = token
+	}
+
+	buffer := bytes.Buffer{}
+	if err := gob.NewEncoder(&buffer).Encode(session.Values); err != nil {
+		return err
+	}
+
+	var userID interface{}
+	if ID, ok := session.Values["ID"].(int); ok {
+		userID = ID
+	}
+
+	_, err := DB.Exec(
+		`
+		INSERT INTO Sessions (Token_Hash, User_ID, Data, IP, User_Agent)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (Token_Hash) DO UPDATE
+		SET User_ID = EXCLUDED.User_ID, Data = EXCLUDED.Data, Last_Seen = NOW()
+		`,
+		HashSessionToken(session.ID),
+		userID,
+		buffer.Bytes(),
+		ClientIP(request),
+		request.UserAgent(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(writer, store.newCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Drops the current row and gives the session a new token, the values are kept.
+// Called on login so a token planted before authentication is worthless afterwards.
+func (store *PostgresStore) Regenerate(request *http.Request, writer http.ResponseWriter, session *sessions.Session) error {
+	if session.ID != "" {
+		if _, err := DB.Exec("DELETE FROM Sessions WHERE Token_Hash = $1", HashSessionToken(session.ID)); err != nil {
+			return err
+		}
+	}
+
+	session.ID = ""
+	return store.Save(request, writer, session)
+}
+
+// Removes expired rows every interval, meant to run in its own goroutine
+func (store *PostgresStore) PeriodicCleanup(interval time.Duration) {
+	for {
+		_, err := DB.Exec(
+			"DELETE FROM Sessions WHERE Last_Seen < $1 OR Created < $2",
+			time.Now().Add(-store.IdleTimeout),
+			time.Now().Add(-store.AbsoluteTimeout),
+		)
+
+		if err != nil {
+			log.Printf("Error cleaning up sessions: %v", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (store *PostgresStore) newCookie(name string, value string, options *sessions.Options) *http.Cookie {
+	cookie := sessions.NewCookie(name, value, options)
+	cookie.SameSite = store.SameSite
+	if value == "" {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(1, 0)
+	}
+
+	return cookie
+}
+
+func GenerateSessionToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+func HashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type clientIPKey struct{}
+
+// The store only sees the *http.Request, so the IP gin resolved with its trusted proxies is handed over in the context
+func WithClientIP(request *http.Request, IP string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), clientIPKey{}, IP))
+}
+
+// X-Forwarded-For is never read here, a request that skipped WithClientIP falls back to the connection's address
+func ClientIP(request *http.Request) string {
+	if IP, ok := request.Context().Value(clientIPKey{}).(string); ok && IP != "" {
+		return IP
+	}
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+	"bytes"
+	"regexp"
+	"strconv"
+	"net/http"
+	"archive/zip"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const DELETED_CONTRIBUTOR_NAME string = "Deleted user"
+
+func ExportUserData(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to export your data."})
+		return
+	}
+
+	IDToDB := IDFromSession.(int)
+	export, err := CollectUserData(IDToDB)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to collect user data"})
+		return
+	}
+
+	if export == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+		return
+	}
+
+	fileName := "fictsu-export-" + strconv.Itoa(IDToDB) + "-" + export.Exported.Format("20060102")
+	if ctx.Query("format") == "json" {
+		ctx.Header("Content-Disposition", "attachment; filename=\"" + fileName + ".json\"")
+		ctx.IndentedJSON(http.StatusOK, export)
+		return
+	}
+
+	archive, err := BuildUserDataArchive(export)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to build export archive"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", "attachment; filename=\"" + fileName + ".zip\"")
+	ctx.Data(http.StatusOK, "application/zip", archive)
+}
+
+// Returns which form field has to be typed and its expected value. Accounts linked only through a provider
+// that shared no email confirm with their name, or display name, and failing both with the word DELETE.
+func AccountDeletionConfirmation(user *models.UserModel) (string, string) {
+	if user.Email != "" {
+		return "confirm_email", user.Email
+	}
+
+	if user.Name != "" {
+		return "confirm_name", user.Name
+	}
+
+	if user.Display_Name != "" {
+		return "confirm_name", user.Display_Name
+	}
+
+	return "confirm_name", "DELETE"
+}
+
+func DeleteAccount(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to delete your account."})
+		return
+	}
+
+	IDToDB := IDFromSession.(int)
+	deletionRequest := models.AccountDeletionForm{}
+	if err := ctx.ShouldBindJSON(&deletionRequest); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid data provided for account deletion"})
+		return
+	}
+
+	user, err := GetUserByID(IDToDB)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve user details"})
+		return
+	}
+
+	if user == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+		return
+	}
+
+	// Typing the email again guards against accidental deletion, an empty confirmation never matches
+	field, expected := AccountDeletionConfirmation(user)
+	confirmation := deletionRequest.Confirm_Email
+	if field == "confirm_name" {
+		confirmation = deletionRequest.Confirm_Name
+	}
+
+	if confirmation == "" || confirmation != expected {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Confirmation does not match your account, send " + field})
+		return
+	}
+
+	var transferTo *models.UserModel
+	switch deletionRequest.Fictions {
+	case models.DeleteFictions, models.OrphanFictions:
+	case models.TransferFictions:
+		if deletionRequest.Transfer_To == IDToDB {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Fictions cannot be transferred to yourself"})
+			return
+		}
+
+		transferTo, err = GetUserByID(deletionRequest.Transfer_To)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve transfer recipient"})
+			return
+		}
+
+		if transferTo == nil {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Transfer recipient not found"})
+			return
+		}
+	default:
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Fictions must be one of: delete, orphan, transfer"})
+		return
+	}
+
+	// Remember the covers before the rows are gone so the images can be cleaned up
+	fictionIDs := []int{}
+	if deletionRequest.Fictions == models.DeleteFictions {
+		rows, err := db.DB.Query("SELECT ID FROM Fictions WHERE Contributor_ID = $1", IDToDB)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch fictions"})
+			return
+		}
+
+		for rows.Next() {
+			var fictionID int
+			if err := rows.Scan(&fictionID); err == nil {
+				fictionIDs = append(fictionIDs, fictionID)
+			}
+		}
+
+		rows.Close()
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete account"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	switch deletionRequest.Fictions {
+	case models.DeleteFictions:
+		_, err = tx.Exec("DELETE FROM Fictions WHERE Contributor_ID = $1", IDToDB)
+	case models.OrphanFictions:
+		_, err = tx.Exec(
+			"UPDATE Fictions SET Contributor_ID = NULL, Contributor_Name = $1 WHERE Contributor_ID = $2",
+			DELETED_CONTRIBUTOR_NAME,
+			IDToDB,
+		)
+	case models.TransferFictions:
+		_, err = tx.Exec(
+			"UPDATE Fictions SET Contributor_ID = $1, Contributor_Name = $2 WHERE Contributor_ID = $3",
+			transferTo.ID,
+			transferTo.Name,
+			IDToDB,
+		)
+	}
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to process fictions of the account"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM Users WHERE ID = $1", IDToDB); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete account"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete account"})
+		return
+	}
+
+	// Image cleanup is best effort, the account is already gone at this point
+	go func() {
+		DeleteImageFromFirebase(configs.AvatarPath + strconv.Itoa(IDToDB), configs.BucketName)
+		for _, fictionID := range fictionIDs {
+			DeleteImageFromFirebase(configs.CoverPath + strconv.Itoa(fictionID), configs.BucketName)
+		}
+	}()
+
+	session.Options.MaxAge = -1
+	session.Save(ctx.Request, ctx.Writer)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Account deleted successfully"})
+}
+
+func CollectUserData(userID int) (*models.UserDataExport, error) {
+	user, err := GetUserByID(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	favFictions, err := GetFavFictions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve favorite fictions: %v", err)
+	}
+
+	contriFictions, err := GetContributedFictions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve contributed fictions: %v", err)
+	}
+
+	identities, err := GetUserIdentitiesOf(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve linked accounts: %v", err)
+	}
+
+	// The assistant conversations are text the user wrote, so they come with every message
+	threads, err := GetAIThreadsOf(userID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve assistant threads: %v", err)
+	}
+
+	for index, thread := range threads {
+		threads[index].Messages, err = GetAIThreadMessages(thread.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve assistant messages: %v", err)
+		}
+	}
+
+	tokens, err := GetPersonalAccessTokensOf(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve access tokens: %v", err)
+	}
+
+	imageURLs := []string{}
+	if user.Avatar_URL != "" {
+		imageURLs = append(imageURLs, user.Avatar_URL)
+	}
+
+	for index, fiction := range contriFictions {
+		genres, err := GetAllGenres(strconv.Itoa(fiction.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		contriFictions[index].Genres = genres
+		if fiction.Cover != "" && fiction.Cover != "/default-cover.png" {
+			imageURLs = append(imageURLs, fiction.Cover)
+		}
+
+		for _, chapter := range fiction.Chapters {
+			imageURLs = append(imageURLs, FindStorageImageURLs(chapter.Content)...)
+		}
+	}
+
+	return &models.UserDataExport{
+		Exported:      time.Now().UTC(),
+		Profile:       *user,
+		Identities:    identities,
+		Favorites:     favFictions,
+		Fictions:      contriFictions,
+		AI_Threads:    threads,
+		Access_Tokens: tokens,
+		Image_URLs:    imageURLs,
+	}, nil
+}
+
+func BuildUserDataArchive(export *models.UserDataExport) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	files := map[string]interface{}{
+		"profile.json":       export.Profile,
+		"identities.json":    export.Identities,
+		"favorites.json":     export.Favorites,
+		"fictions.json":      export.Fictions,
+		"ai-threads.json":    export.AI_Threads,
+		"access-tokens.json": export.Access_Tokens,
+		"images.json":        export.Image_URLs,
+	}
+
+	for name, content := range files {
+		JSONBody, err := json.MarshalIndent(content, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: export.Exported})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := file.Write(JSONBody); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Images uploaded through the editor are only referenced from chapter HTML
+func FindStorageImageURLs(content string) []string {
+	pattern := regexp.MustCompile(`https://storage\.googleapis\.com/` + regexp.QuoteMeta(configs.BucketName) + `/[^"'\s<>)]+`)
+	return pattern.FindAllString(content, -1)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+// Lets a client that lost its stream fetch the stored result afterwards
+func GetAIGeneration(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	generation := models.AIGenerationModel{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			ID, User_ID, Feature, Model, Prompt, Content, Status, Created
+		FROM
+			AIGenerations
+		WHERE
+			ID = $1 AND User_ID = $2
+		`,
+		ctx.Param("generationID"),
+		IDFromSession.(int),
+	).Scan(
+		&generation.ID,
+		&generation.User_ID,
+		&generation.Feature,
+		&generation.Model,
+		&generation.Prompt,
+		&generation.Content,
+		&generation.Status,
+		&generation.Created,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Generation not found"})
+			return
+		}
+
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch generation"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, generation)
+}
+
+func CreateAIGeneration(userID int, feature models.AIFeature, model string, prompt string) (*models.AIGenerationModel, error) {
+	generation := models.AIGenerationModel{
+		User_ID: userID,
+		Feature: feature,
+		Model:   model,
+		Prompt:  prompt,
+	}
+
+	err := db.DB.QueryRow(
+		`
+		INSERT INTO AIGenerations (User_ID, Feature, Model, Prompt)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ID, Created
+		`,
+		userID,
+		feature,
+		model,
+		prompt,
+	).Scan(
+		&generation.ID,
+		&generation.Created,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &generation, nil
+}
+
+// Runs after the request may already be gone, so failures are only logged
+func FinishAIGeneration(generationID int, content string, status models.AIGenerationStatus) {
+	_, err := db.DB.Exec(
+		`
+		UPDATE AIGenerations
+		SET Content = $1, Status = $2
+		WHERE ID = $3
+		`,
+		content,
+		status,
+		generationID,
+	)
+
+	if err != nil {
+		log.Printf("Error saving AI generation %d: %v", generationID, err)
+	}
+}
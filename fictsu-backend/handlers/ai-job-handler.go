@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"log"
+	"time"
+	"context"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_CONCURRENT_AI_JOBS     int           = 4
+	AI_JOB_TIMEOUT             time.Duration = 5 * time.Minute
+	AI_TRANSLATION_JOB_TIMEOUT time.Duration = 6 * time.Hour
+)
+
+// Limits how many jobs talk to the provider at once, the rest wait as pending
+var aiJobSlots = make(chan struct{}, MAX_CONCURRENT_AI_JOBS)
+
+// Does the actual work of a job, the returned value is stored as the job result
+type AIJobRunner func(ctx context.Context, job *models.AIJobModel) (interface{}, error)
+
+func GetAIJob(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	job := models.AIJobModel{}
+	var input []byte
+	var result []byte
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			ID, User_ID, Fiction_ID, Kind, Status, Input, Result, Error, Created, Updated
+		FROM
+			AIJobs
+		WHERE
+			ID = $1 AND User_ID = $2
+		`,
+		ctx.Param("jobID"),
+		IDFromSession.(int),
+	).Scan(
+		&job.ID,
+		&job.User_ID,
+		&job.Fiction_ID,
+		&job.Kind,
+		&job.Status,
+		&input,
+		&result,
+		&job.Error,
+		&job.Created,
+		&job.Updated,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Job not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch job"})
+		}
+
+		return
+	}
+
+	job.Input = input
+	if result != nil {
+		job.Result = result
+	}
+
+	ctx.IndentedJSON(http.StatusOK, job)
+}
+
+// Stores the job as pending and runs it in the background, the caller answers 202 with the returned job
+func StartAIJob(userID int, fictionID int, kind models.AIJobKind, input interface{}, runner AIJobRunner) (*models.AIJobModel, error) {
+	return StartAIJobWithTimeout(userID, fictionID, kind, input, AI_JOB_TIMEOUT, runner)
+}
+
+// For jobs made of many provider calls, the runner is then expected to bound each call itself
+func StartAIJobWithTimeout(userID int, fictionID int, kind models.AIJobKind, input interface{}, timeout time.Duration, runner AIJobRunner) (*models.AIJobModel, error) {
+	JSONInput, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.AIJobModel{
+		User_ID:    userID,
+		Fiction_ID: fictionID,
+		Kind:       kind,
+		Status:     models.AIJobPending,
+		Input:      JSONInput,
+	}
+
+	err = db.DB.QueryRow(
+		`
+		INSERT INTO AIJobs (User_ID, Fiction_ID, Kind, Input)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ID, Created, Updated
+		`,
+		userID,
+		fictionID,
+		kind,
+		string(JSONInput),
+	).Scan(
+		&job.ID,
+		&job.Created,
+		&job.Updated,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	go RunAIJob(job, timeout, runner)
+	return &job, nil
+}
+
+func RunAIJob(job models.AIJobModel, timeout time.Duration, runner AIJobRunner) {
+	aiJobSlots <- struct{}{}
+	defer func() { <-aiJobSlots }()
+
+	UpdateAIJob(job.ID, models.AIJobRunning, nil, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := runner(ctx, &job)
+	if err != nil {
+		log.Printf("AI job %d (%s) failed: %v", job.ID, job.Kind, err)
+		UpdateAIJob(job.ID, models.AIJobFailed, nil, "The job failed. Please try again.")
+		return
+	}
+
+	UpdateAIJob(job.ID, models.AIJobComplete, result, "")
+}
+
+func UpdateAIJob(jobID int, status models.AIJobStatus, result interface{}, message string) {
+	// Left NULL unless there is a result, so a failed update never wipes an earlier one
+	var JSONResult interface{}
+	if result != nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("Error encoding result of AI job %d: %v", jobID, err)
+			status = models.AIJobFailed
+			message = "The job failed. Please try again."
+		} else {
+			JSONResult = string(encoded)
+		}
+	}
+
+	_, err := db.DB.Exec(
+		`
+		UPDATE AIJobs
+		SET Status = $1, Result = COALESCE($2::JSONB, Result), Error = $3, Updated = NOW()
+		WHERE ID = $4
+		`,
+		status,
+		JSONResult,
+		message,
+		jobID,
+	)
+
+	if err != nil {
+		log.Printf("Error updating AI job %d: %v", jobID, err)
+	}
+}
+
+// Jobs only live in goroutines, so anything unfinished when the server stopped will never complete
+func RecoverAIJobs() {
+	_, err := db.DB.Exec(
+		`
+		UPDATE AIJobs
+		SET Status = $1, Error = 'The job was interrupted by a server restart. Please try again.', Updated = NOW()
+		WHERE Status IN ($2, $3)
+		`,
+		models.AIJobFailed,
+		models.AIJobPending,
+		models.AIJobRunning,
+	)
+
+	if err != nil {
+		log.Printf("Error recovering AI jobs: %v", err)
+	}
+}
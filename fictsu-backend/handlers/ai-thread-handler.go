@@ -0,0 +1,763 @@
+package handlers
+
+import (
+	"log"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	llm "github.com/Fictsu/Fictsu/llm"
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	DEFAULT_THREAD_TITLE        string = "New thread"
+	MAX_THREAD_TITLE_LENGTH     int    = 255
+	MAX_THREAD_MESSAGE_LENGTH   int    = 8000
+	MAX_THREAD_CONTEXT_CHAPTERS int    = 20
+	ASSISTANT_REPLY_TOKENS      int    = 2048
+)
+
+var HTMLTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func GetAIThreads(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	// ?fiction_id= narrows the list down to the threads about one fiction
+	var fictionID interface{}
+	if rawFictionID := ctx.Query("fiction_id"); rawFictionID != "" {
+		parsedFictionID, err := strconv.Atoi(rawFictionID)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+			return
+		}
+
+		fictionID = parsedFictionID
+	}
+
+	threads, err := GetAIThreadsOf(IDFromSession.(int), fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch threads"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, threads)
+}
+
+// A nil fiction ID lists every thread of the user, the messages are not loaded
+func GetAIThreadsOf(userID int, fictionID interface{}) ([]models.AIThreadModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, User_ID, Fiction_ID, Title, Chapter_IDs, Created, Updated
+		FROM
+			AIThreads
+		WHERE
+			User_ID = $1 AND ($2::INT IS NULL OR Fiction_ID = $2)
+		ORDER BY Updated DESC
+		`,
+		userID,
+		fictionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	threads := []models.AIThreadModel{}
+	for rows.Next() {
+		thread := models.AIThreadModel{}
+		var threadFictionID sql.NullInt64
+		if err := rows.Scan(
+			&thread.ID,
+			&thread.User_ID,
+			&threadFictionID,
+			&thread.Title,
+			pq.Array(&thread.Chapter_IDs),
+			&thread.Created,
+			&thread.Updated,
+		); err != nil {
+			return nil, err
+		}
+
+		if threadFictionID.Valid {
+			ID := int(threadFictionID.Int64)
+			thread.Fiction_ID = &ID
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return threads, rows.Err()
+}
+
+func GetAIThread(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	thread, ok := GetOwnedAIThread(ctx, ctx.Param("threadID"), IDFromSession.(int))
+	if !ok {
+		return
+	}
+
+	messages, err := GetAIThreadMessages(thread.ID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch messages"})
+		return
+	}
+
+	thread.Messages = messages
+	ctx.IndentedJSON(http.StatusOK, thread)
+}
+
+func CreateAIThread(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to use the assistant."})
+		return
+	}
+
+	threadForm := models.AIThreadForm{}
+	if err := ctx.ShouldBindJSON(&threadForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	title := DEFAULT_THREAD_TITLE
+	if threadForm.Title != nil {
+		title = strings.TrimSpace(*threadForm.Title)
+	}
+
+	if !ValidateAIThreadTitle(ctx, title) {
+		return
+	}
+
+	if threadForm.Chapter_IDs == nil {
+		threadForm.Chapter_IDs = []int64{}
+	}
+
+	if !ValidateAIThreadContext(ctx, threadForm.Fiction_ID, threadForm.Chapter_IDs, IDFromSession.(int)) {
+		return
+	}
+
+	thread := models.AIThreadModel{
+		User_ID:     IDFromSession.(int),
+		Fiction_ID:  threadForm.Fiction_ID,
+		Title:       title,
+		Chapter_IDs: threadForm.Chapter_IDs,
+	}
+
+	err := db.DB.QueryRow(
+		`
+		INSERT INTO AIThreads (User_ID, Fiction_ID, Title, Chapter_IDs)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ID, Created, Updated
+		`,
+		thread.User_ID,
+		thread.Fiction_ID,
+		thread.Title,
+		pq.Array(thread.Chapter_IDs),
+	).Scan(
+		&thread.ID,
+		&thread.Created,
+		&thread.Updated,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create thread"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, thread)
+}
+
+// Renames the thread or changes which chapters the assistant sees, the fiction is fixed at creation
+func EditAIThread(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	thread, ok := GetOwnedAIThread(ctx, ctx.Param("threadID"), IDFromSession.(int))
+	if !ok {
+		return
+	}
+
+	threadForm := models.AIThreadForm{}
+	if err := ctx.ShouldBindJSON(&threadForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if threadForm.Fiction_ID != nil && (thread.Fiction_ID == nil || *threadForm.Fiction_ID != *thread.Fiction_ID) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "The fiction of a thread can not be changed"})
+		return
+	}
+
+	if threadForm.Title != nil {
+		thread.Title = strings.TrimSpace(*threadForm.Title)
+		if !ValidateAIThreadTitle(ctx, thread.Title) {
+			return
+		}
+	}
+
+	if threadForm.Chapter_IDs != nil {
+		if !ValidateAIThreadContext(ctx, thread.Fiction_ID, threadForm.Chapter_IDs, IDFromSession.(int)) {
+			return
+		}
+
+		thread.Chapter_IDs = threadForm.Chapter_IDs
+	}
+
+	err := db.DB.QueryRow(
+		`
+		UPDATE AIThreads
+		SET Title = $1, Chapter_IDs = $2, Updated = NOW()
+		WHERE ID = $3
+		RETURNING Updated
+		`,
+		thread.Title,
+		pq.Array(thread.Chapter_IDs),
+		thread.ID,
+	).Scan(
+		&thread.Updated,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update thread"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, thread)
+}
+
+func DeleteAIThread(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		"DELETE FROM AIThreads WHERE ID = $1 AND User_ID = $2",
+		ctx.Param("threadID"),
+		IDFromSession.(int),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete thread"})
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Thread not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Thread deleted"})
+}
+
+// Sends a message to the thread and waits for the whole reply, runs behind RequireAIQuota
+func SendAIThreadMessage(ctx *gin.Context) {
+	thread, template, request, message, ok := PrepareAIThreadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	response, err := llm.Client.Chat(ctx.Request.Context(), request)
+	if err != nil {
+		log.Printf("Error sending assistant message: %v", err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "Failed to get a response from the AI provider"})
+		return
+	}
+
+	RecordAITemplateUsage(
+		thread.User_ID,
+		models.AIFeatureAssistant,
+		template.ID,
+		response.Model,
+		response.Usage.Prompt_Tokens,
+		response.Usage.Completion_Tokens,
+		0,
+	)
+
+	reply, err := SaveAIThreadExchange(thread.ID, message, response.Content)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save messages"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, reply)
+}
+
+// Streaming variant of SendAIThreadMessage, same events as OpenAIStreamStoryline.
+// A reply cut short by a disconnect is kept so the history matches what the user saw.
+func StreamAIThreadMessage(ctx *gin.Context) {
+	thread, template, request, message, ok := PrepareAIThreadRequest(ctx)
+	if !ok {
+		return
+	}
+
+	StartEventStream(ctx)
+	response, status, err := RelayChatStream(ctx, request)
+
+	var reply *models.AIThreadMessageModel
+	if status == models.AIGenerationComplete || response.Content != "" {
+		RecordAITemplateUsage(
+			thread.User_ID,
+			models.AIFeatureAssistant,
+			template.ID,
+			response.Model,
+			response.Usage.Prompt_Tokens,
+			response.Usage.Completion_Tokens,
+			0,
+		)
+
+		reply, err = SaveAIThreadExchange(thread.ID, message, response.Content)
+		if err != nil {
+			status = models.AIGenerationFailed
+		}
+	}
+
+	switch status {
+	case models.AIGenerationComplete:
+		ctx.SSEvent("done", reply)
+	case models.AIGenerationFailed:
+		log.Printf("Error streaming assistant message: %v", err)
+		ctx.SSEvent("error", gin.H{"Error": "Failed to get a response from the AI provider"})
+	default:
+		return
+	}
+
+	ctx.Writer.Flush()
+}
+
+// Validates the message and builds the model request from the user's assistant template, writes the error response itself when it returns false
+func PrepareAIThreadRequest(ctx *gin.Context) (*models.AIThreadModel, models.PromptTemplateModel, llm.ChatRequest, string, bool) {
+	thread, ok := GetOwnedAIThread(ctx, ctx.Param("threadID"), ctx.GetInt("ai_user_ID"))
+	if !ok {
+		return nil, models.PromptTemplateModel{}, llm.ChatRequest{}, "", false
+	}
+
+	messageForm := models.AIThreadMessageForm{}
+	if err := ctx.ShouldBindJSON(&messageForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return nil, models.PromptTemplateModel{}, llm.ChatRequest{}, "", false
+	}
+
+	message := strings.TrimSpace(messageForm.Message)
+	if message == "" || len(message) > MAX_THREAD_MESSAGE_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Message must be between 1 and " + strconv.Itoa(MAX_THREAD_MESSAGE_LENGTH) + " characters"})
+		return nil, models.PromptTemplateModel{}, llm.ChatRequest{}, "", false
+	}
+
+	template := SelectPromptTemplate(models.PromptAssistant, thread.User_ID)
+	messages, err := BuildAIThreadPrompt(thread, template, message)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to load thread context"})
+		return nil, models.PromptTemplateModel{}, llm.ChatRequest{}, "", false
+	}
+
+	request := llm.ChatRequest{
+		Model:       PromptModel(template, configs.AssistantModel),
+		Messages:    messages,
+		Temperature: template.Temperature,
+		Max_Tokens:  ASSISTANT_REPLY_TOKENS,
+	}
+
+	return thread, template, request, message, true
+}
+
+// System prompt with the fiction context, then as much recent history as fits the token budget, then the new message
+func BuildAIThreadPrompt(thread *models.AIThreadModel, template models.PromptTemplateModel, message string) ([]llm.Message, error) {
+	budget := configs.AssistantContextTokens - ASSISTANT_REPLY_TOKENS - llm.EstimateTokens(message)
+
+	variables := map[string]string{"message": message}
+	if thread.Fiction_ID != nil {
+		variables = FictionPromptVariables(*thread.Fiction_ID, message)
+	}
+
+	systemPrompt := RenderPromptTemplate(template, variables)
+	if thread.Fiction_ID != nil {
+		// The fiction may take at most half of the budget, the conversation itself needs the rest
+		fictionContext, err := BuildFictionContext(*thread.Fiction_ID, thread.Chapter_IDs, budget / 2)
+		if err != nil {
+			return nil, err
+		}
+
+		systemPrompt += "\n\nThe user is writing the following fiction, use it as context for your answers.\n\n" + fictionContext
+	}
+
+	budget -= llm.EstimateTokens(systemPrompt)
+
+	history, err := GetAIThreadMessages(thread.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back from the newest message and stop at the first one that no longer fits
+	first := len(history)
+	for first > 0 {
+		tokens := llm.EstimateTokens(history[first - 1].Content)
+		if tokens > budget {
+			break
+		}
+
+		budget -= tokens
+		first--
+	}
+
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: systemPrompt}}
+	for _, historyMessage := range history[first:] {
+		messages = append(messages, llm.Message{Role: llm.Role(historyMessage.Role), Content: historyMessage.Content})
+	}
+
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: message}), nil
+}
+
+// Title, genres, synopsis and the selected chapters as plain text, cut off once maxTokens is reached
+func BuildFictionContext(fictionID int, chapterIDs []int64, maxTokens int) (string, error) {
+	var title string
+	var synopsis string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Title, COALESCE(Synopsis, '')
+		FROM
+			Fictions
+		WHERE
+			ID = $1
+		`,
+		fictionID,
+	).Scan(
+		&title,
+		&synopsis,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	genres, err := GetAllGenres(strconv.Itoa(fictionID))
+	if err != nil {
+		return "", err
+	}
+
+	genreNames := []string{}
+	for _, genre := range genres {
+		genreNames = append(genreNames, genre.Genre_Name)
+	}
+
+	context := strings.Builder{}
+	context.WriteString("Title: " + title + "\n")
+	if len(genreNames) > 0 {
+		context.WriteString("Genres: " + strings.Join(genreNames, ", ") + "\n")
+	}
+
+	context.WriteString("Synopsis: " + StripHTML(synopsis) + "\n")
+	if len(chapterIDs) == 0 {
+		return context.String(), nil
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Title, COALESCE(Content, '')
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = ANY($2)
+		ORDER BY ID
+		`,
+		fictionID,
+		pq.Array(chapterIDs),
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var chapterID int
+		var chapterTitle string
+		var content string
+		if err := rows.Scan(&chapterID, &chapterTitle, &content); err != nil {
+			return "", err
+		}
+
+		chapter := "\nChapter " + strconv.Itoa(chapterID) + ": " + chapterTitle + "\n" + StripHTML(content) + "\n"
+		remaining := maxTokens - llm.EstimateTokens(context.String())
+		if llm.EstimateTokens(chapter) > remaining {
+			// Keep the beginning of the chapter that no longer fits and drop the rest
+			if remaining > 0 {
+				context.WriteString(TruncateText(chapter, remaining * 4) + "\n[...]\n")
+			}
+
+			break
+		}
+
+		context.WriteString(chapter)
+	}
+
+	return context.String(), rows.Err()
+}
+
+func GetOwnedAIThread(ctx *gin.Context, threadID string, userID int) (*models.AIThreadModel, bool) {
+	thread := models.AIThreadModel{}
+	var fictionID sql.NullInt64
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			ID, User_ID, Fiction_ID, Title, Chapter_IDs, Created, Updated
+		FROM
+			AIThreads
+		WHERE
+			ID = $1 AND User_ID = $2
+		`,
+		threadID,
+		userID,
+	).Scan(
+		&thread.ID,
+		&thread.User_ID,
+		&fictionID,
+		&thread.Title,
+		pq.Array(&thread.Chapter_IDs),
+		&thread.Created,
+		&thread.Updated,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Thread not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch thread"})
+		}
+
+		return nil, false
+	}
+
+	if fictionID.Valid {
+		ID := int(fictionID.Int64)
+		thread.Fiction_ID = &ID
+	}
+
+	return &thread, true
+}
+
+func GetAIThreadMessages(threadID int) ([]models.AIThreadMessageModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Thread_ID, Role, Content, Created
+		FROM
+			AIThreadMessages
+		WHERE
+			Thread_ID = $1
+		ORDER BY ID
+		`,
+		threadID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	messages := []models.AIThreadMessageModel{}
+	for rows.Next() {
+		message := models.AIThreadMessageModel{}
+		if err := rows.Scan(
+			&message.ID,
+			&message.Thread_ID,
+			&message.Role,
+			&message.Content,
+			&message.Created,
+		); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// Stores the user message and the reply together, so a failed request leaves no dangling message behind
+func SaveAIThreadExchange(threadID int, message string, reply string) (*models.AIThreadMessageModel, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO AIThreadMessages (Thread_ID, Role, Content) VALUES ($1, $2, $3)",
+		threadID,
+		llm.RoleUser,
+		message,
+	); err != nil {
+		return nil, err
+	}
+
+	replyMessage := models.AIThreadMessageModel{
+		Thread_ID: threadID,
+		Role:      string(llm.RoleAssistant),
+		Content:   reply,
+	}
+
+	if err := tx.QueryRow(
+		`
+		INSERT INTO AIThreadMessages (Thread_ID, Role, Content)
+		VALUES ($1, $2, $3)
+		RETURNING ID, Created
+		`,
+		threadID,
+		llm.RoleAssistant,
+		reply,
+	).Scan(
+		&replyMessage.ID,
+		&replyMessage.Created,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE AIThreads SET Updated = NOW() WHERE ID = $1", threadID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &replyMessage, nil
+}
+
+func ValidateAIThreadTitle(ctx *gin.Context, title string) bool {
+	if title == "" || len(title) > MAX_THREAD_TITLE_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Title must be between 1 and " + strconv.Itoa(MAX_THREAD_TITLE_LENGTH) + " characters"})
+		return false
+	}
+
+	return true
+}
+
+// Only the contributor can hand a fiction to the assistant, and the chapters must belong to it
+func ValidateAIThreadContext(ctx *gin.Context, fictionID *int, chapterIDs []int64, userID int) bool {
+	if fictionID == nil {
+		if len(chapterIDs) > 0 {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Chapters can only be selected for a thread about a fiction"})
+			return false
+		}
+
+		return true
+	}
+
+	if !CheckFictionOwner(ctx, strconv.Itoa(*fictionID), userID, "use this fiction with the assistant") {
+		return false
+	}
+
+	if len(chapterIDs) > MAX_THREAD_CONTEXT_CHAPTERS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "At most " + strconv.Itoa(MAX_THREAD_CONTEXT_CHAPTERS) + " chapters can be selected"})
+		return false
+	}
+
+	if len(chapterIDs) == 0 {
+		return true
+	}
+
+	var found int
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			COUNT(DISTINCT ID)
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = ANY($2)
+		`,
+		*fictionID,
+		pq.Array(chapterIDs),
+	).Scan(
+		&found,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch chapters"})
+		return false
+	}
+
+	if found != len(UniqueChapterIDs(chapterIDs)) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "One or more chapters do not exist in this fiction"})
+		return false
+	}
+
+	return true
+}
+
+func UniqueChapterIDs(chapterIDs []int64) []int64 {
+	seen := map[int64]bool{}
+	unique := []int64{}
+	for _, chapterID := range chapterIDs {
+		if !seen[chapterID] {
+			seen[chapterID] = true
+			unique = append(unique, chapterID)
+		}
+	}
+
+	return unique
+}
+
+// Chapters and synopses are stored as editor HTML, the model only needs the text
+func StripHTML(content string) string {
+	content = strings.NewReplacer("</p>", "\n", "<br>", "\n", "<br/>", "\n", "<br />", "\n").Replace(content)
+	return strings.TrimSpace(html.UnescapeString(HTMLTagPattern.ReplaceAllString(content, "")))
+}
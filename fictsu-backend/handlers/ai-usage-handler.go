@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"log"
+	"time"
+	"strconv"
+	"net/http"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	DEFAULT_AI_USAGE_HISTORY_DAYS int = 30
+	MAX_AI_USAGE_HISTORY_DAYS     int = 90
+)
+
+// Logged-in users only, rejects the request with 429 once today's quota is spent.
+// The user ID is handed to the AI handlers as "ai_user_ID" so they can record usage.
+func RequireAIQuota(store sessions.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		session, errSess := GetSession(ctx, store)
+		if errSess != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+			return
+		}
+
+		IDFromSession := session.Values["ID"]
+		if IDFromSession == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to use the AI tools."})
+			return
+		}
+
+		userID := IDFromSession.(int)
+		exceeded, err := AIQuotaExceeded(userID)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI quota"})
+			return
+		}
+
+		if exceeded {
+			resets := StartOfAIDay(time.Now()).Add(24 * time.Hour)
+			ctx.Header("Retry-After", strconv.Itoa(int(time.Until(resets).Seconds()) + 1))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"Error": "Daily AI quota exceeded. Please try again tomorrow.",
+				"Resets": resets,
+			})
+			return
+		}
+
+		ctx.Set("ai_user_ID", userID)
+		ctx.Next()
+	}
+}
+
+func GetAIUsage(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	days := DEFAULT_AI_USAGE_HISTORY_DAYS
+	if rawDays := ctx.Query("days"); rawDays != "" {
+		parsedDays, err := strconv.Atoi(rawDays)
+		if err != nil || parsedDays < 1 || parsedDays > MAX_AI_USAGE_HISTORY_DAYS {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "days must be between 1 and " + strconv.Itoa(MAX_AI_USAGE_HISTORY_DAYS)})
+			return
+		}
+
+		days = parsedDays
+	}
+
+	userID := IDFromSession.(int)
+	quota, err := GetAIQuota(userID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI quota"})
+		return
+	}
+
+	startOfDay := StartOfAIDay(time.Now())
+	today, err := GetAIUsageSummary(userID, startOfDay)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI usage"})
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			DATE_TRUNC('day', Created), COUNT(*), COALESCE(SUM(Prompt_Tokens), 0),
+			COALESCE(SUM(Completion_Tokens), 0), COALESCE(SUM(Cost), 0)
+		FROM
+			AIUsage
+		WHERE
+			User_ID = $1 AND Created >= $2
+		GROUP BY DATE_TRUNC('day', Created)
+		ORDER BY DATE_TRUNC('day', Created) DESC
+		`,
+		userID,
+		startOfDay.AddDate(0, 0, -(days - 1)),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI usage"})
+		return
+	}
+
+	defer rows.Close()
+	report := models.AIUsageReport{
+		Quota:   quota,
+		Today:   today,
+		Resets:  startOfDay.Add(24 * time.Hour),
+		History: []models.AIDailyUsage{},
+	}
+
+	for rows.Next() {
+		daily := models.AIDailyUsage{}
+		if err := rows.Scan(
+			&daily.Date,
+			&daily.Requests,
+			&daily.Prompt_Tokens,
+			&daily.Completion_Tokens,
+			&daily.Cost,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing AI usage"})
+			return
+		}
+
+		report.History = append(report.History, daily)
+	}
+
+	if quota.Daily_Requests != nil {
+		remaining := max(*quota.Daily_Requests - today.Requests, 0)
+		report.Remaining_Requests = &remaining
+	}
+
+	if quota.Daily_Tokens != nil {
+		remaining := max(*quota.Daily_Tokens - today.Prompt_Tokens - today.Completion_Tokens, 0)
+		report.Remaining_Tokens = &remaining
+	}
+
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// Aggregate usage of every user between ?from= and ?to= (inclusive, YYYY-MM-DD), super users only
+func GetAIUsageAdminReport(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	if !CheckSuperUser(ctx, IDFromSession.(int), "view the AI usage report") {
+		return
+	}
+
+	to := StartOfAIDay(time.Now())
+	from := to.AddDate(0, 0, -(DEFAULT_AI_USAGE_HISTORY_DAYS - 1))
+	if rawFrom := ctx.Query("from"); rawFrom != "" {
+		parsedFrom, err := time.Parse("2006-01-02", rawFrom)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+
+		from = parsedFrom
+	}
+
+	if rawTo := ctx.Query("to"); rawTo != "" {
+		parsedTo, err := time.Parse("2006-01-02", rawTo)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+
+		to = parsedTo
+	}
+
+	if to.Before(from) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "to must not be before from"})
+		return
+	}
+
+	// "to" is inclusive, so the window ends at the start of the following day
+	until := to.Add(24 * time.Hour)
+	report := models.AIUsageAdminReport{
+		From:     from,
+		To:       to,
+		By_User:  []models.AIUserUsage{},
+		By_Model: []models.AIModelUsage{},
+	}
+
+	userRows, err := db.DB.Query(
+		`
+		SELECT
+			COALESCE(A.User_ID, 0), COALESCE(U.Name, 'Deleted user'), COUNT(*),
+			COALESCE(SUM(A.Prompt_Tokens), 0), COALESCE(SUM(A.Completion_Tokens), 0), COALESCE(SUM(A.Cost), 0)
+		FROM
+			AIUsage A
+		LEFT JOIN
+			Users U ON A.User_ID = U.ID
+		WHERE
+			A.Created >= $1 AND A.Created < $2
+		GROUP BY A.User_ID, U.Name
+		ORDER BY SUM(A.Cost) DESC
+		`,
+		from,
+		until,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI usage"})
+		return
+	}
+
+	defer userRows.Close()
+	for userRows.Next() {
+		usage := models.AIUserUsage{}
+		if err := userRows.Scan(
+			&usage.User_ID,
+			&usage.Name,
+			&usage.Requests,
+			&usage.Prompt_Tokens,
+			&usage.Completion_Tokens,
+			&usage.Cost,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing AI usage"})
+			return
+		}
+
+		report.Total.Requests += usage.Requests
+		report.Total.Prompt_Tokens += usage.Prompt_Tokens
+		report.Total.Completion_Tokens += usage.Completion_Tokens
+		report.Total.Cost += usage.Cost
+		report.By_User = append(report.By_User, usage)
+	}
+
+	modelRows, err := db.DB.Query(
+		`
+		SELECT
+			Model, COUNT(*), COALESCE(SUM(Prompt_Tokens), 0),
+			COALESCE(SUM(Completion_Tokens), 0), COALESCE(SUM(Cost), 0)
+		FROM
+			AIUsage
+		WHERE
+			Created >= $1 AND Created < $2
+		GROUP BY Model
+		ORDER BY SUM(Cost) DESC
+		`,
+		from,
+		until,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI usage"})
+		return
+	}
+
+	defer modelRows.Close()
+	for modelRows.Next() {
+		usage := models.AIModelUsage{}
+		if err := modelRows.Scan(
+			&usage.Model,
+			&usage.Requests,
+			&usage.Prompt_Tokens,
+			&usage.Completion_Tokens,
+			&usage.Cost,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing AI usage"})
+			return
+		}
+
+		report.By_Model = append(report.By_Model, usage)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// Sets a per-user quota override, super users only. "unlimited": true lifts both limits.
+func SetAIQuota(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	if !CheckSuperUser(ctx, IDFromSession.(int), "change AI quotas") {
+		return
+	}
+
+	userID, err := strconv.Atoi(ctx.Param("userID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid user ID"})
+		return
+	}
+
+	quotaForm := models.AIQuotaForm{}
+	if err := ctx.ShouldBindJSON(&quotaForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if quotaForm.Unlimited {
+		quotaForm.Daily_Requests = nil
+		quotaForm.Daily_Tokens = nil
+	} else if quotaForm.Daily_Requests == nil || quotaForm.Daily_Tokens == nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "daily_requests and daily_tokens are required unless unlimited is set"})
+		return
+	} else if *quotaForm.Daily_Requests < 0 || *quotaForm.Daily_Tokens < 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Quota limits can not be negative"})
+		return
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+		return
+	}
+
+	if user == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+		return
+	}
+
+	_, err = db.DB.Exec(
+		`
+		INSERT INTO AIQuotas (User_ID, Daily_Requests, Daily_Tokens, Updated_By)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (User_ID) DO UPDATE
+		SET Daily_Requests = EXCLUDED.Daily_Requests, Daily_Tokens = EXCLUDED.Daily_Tokens,
+			Updated_By = EXCLUDED.Updated_By, Updated = NOW()
+		`,
+		userID,
+		quotaForm.Daily_Requests,
+		quotaForm.Daily_Tokens,
+		IDFromSession.(int),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save AI quota"})
+		return
+	}
+
+	quota, err := GetAIQuota(userID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch AI quota"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, quota)
+}
+
+// Drops the override so the user falls back to the configured defaults, super users only
+func DeleteAIQuota(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	if !CheckSuperUser(ctx, IDFromSession.(int), "change AI quotas") {
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM AIQuotas WHERE User_ID = $1", ctx.Param("userID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete AI quota"})
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "No AI quota override for this user"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "AI quota override removed"})
+}
+
+// Also used by long jobs between provider calls, so one request cannot spend far past the quota
+func AIQuotaExceeded(userID int) (bool, error) {
+	quota, err := GetAIQuota(userID)
+	if err != nil {
+		return false, err
+	}
+
+	today, err := GetAIUsageSummary(userID, StartOfAIDay(time.Now()))
+	if err != nil {
+		return false, err
+	}
+
+	requestsExceeded := quota.Daily_Requests != nil && today.Requests >= *quota.Daily_Requests
+	tokensExceeded := quota.Daily_Tokens != nil && today.Prompt_Tokens + today.Completion_Tokens >= *quota.Daily_Tokens
+	return requestsExceeded || tokensExceeded, nil
+}
+
+// Super users are unlimited, an AIQuotas row overrides the configured defaults
+func GetAIQuota(userID int) (models.AIQuotaModel, error) {
+	var superUser bool
+	var dailyRequests sql.NullInt64
+	var dailyTokens sql.NullInt64
+	var overridden bool
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			U.Super_User, Q.Daily_Requests, Q.Daily_Tokens, Q.User_ID IS NOT NULL
+		FROM
+			Users U
+		LEFT JOIN
+			AIQuotas Q ON Q.User_ID = U.ID
+		WHERE
+			U.ID = $1
+		`,
+		userID,
+	).Scan(
+		&superUser,
+		&dailyRequests,
+		&dailyTokens,
+		&overridden,
+	)
+
+	if err != nil {
+		return models.AIQuotaModel{}, err
+	}
+
+	quota := models.AIQuotaModel{Overridden: overridden}
+	if overridden {
+		if dailyRequests.Valid {
+			limit := int(dailyRequests.Int64)
+			quota.Daily_Requests = &limit
+		}
+
+		if dailyTokens.Valid {
+			limit := int(dailyTokens.Int64)
+			quota.Daily_Tokens = &limit
+		}
+	} else if !superUser {
+		requestLimit := configs.AIDailyRequestLimit
+		tokenLimit := configs.AIDailyTokenLimit
+		quota.Daily_Requests = &requestLimit
+		quota.Daily_Tokens = &tokenLimit
+	}
+
+	return quota, nil
+}
+
+func GetAIUsageSummary(userID int, since time.Time) (models.AIUsageSummary, error) {
+	summary := models.AIUsageSummary{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			COUNT(*), COALESCE(SUM(Prompt_Tokens), 0), COALESCE(SUM(Completion_Tokens), 0), COALESCE(SUM(Cost), 0)
+		FROM
+			AIUsage
+		WHERE
+			User_ID = $1 AND Created >= $2
+		`,
+		userID,
+		since,
+	).Scan(
+		&summary.Requests,
+		&summary.Prompt_Tokens,
+		&summary.Completion_Tokens,
+		&summary.Cost,
+	)
+
+	return summary, err
+}
+
+// Failing to record must not fail the user's request, the error is only logged
+func RecordAIUsage(userID int, feature models.AIFeature, model string, promptTokens int, completionTokens int, images int) {
+	RecordAITemplateUsage(userID, feature, 0, model, promptTokens, completionTokens, images)
+}
+
+// Same as RecordAIUsage for features driven by a prompt template, a template ID of 0 is the built-in default
+func RecordAITemplateUsage(userID int, feature models.AIFeature, templateID int, model string, promptTokens int, completionTokens int, images int) {
+	var storedTemplateID interface{}
+	if templateID != 0 {
+		storedTemplateID = templateID
+	}
+
+	_, err := db.DB.Exec(
+		`
+		INSERT INTO AIUsage (User_ID, Feature, Template_ID, Model, Prompt_Tokens, Completion_Tokens, Cost, Created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+		userID,
+		feature,
+		storedTemplateID,
+		model,
+		promptTokens,
+		completionTokens,
+		models.EstimateAICost(model, promptTokens, completionTokens, images),
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		log.Printf("Error recording AI usage for user %d: %v", userID, err)
+	}
+}
+
+// Quotas reset at midnight UTC
+func StartOfAIDay(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,996 @@
+package handlers
+
+import (
+	"sort"
+	"regexp"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_BRANCH_VARIABLES   int = 100
+	MAX_CHAPTER_CHOICES    int = 20
+	MAX_CHOICE_TEXT_LENGTH int = 500
+	MAX_CHOICE_RULES       int = 10
+	MAX_READER_PATH_LENGTH int = 1000
+)
+
+var BranchVariablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,49}$`)
+
+var branchConditionOperators = map[string]bool{"eq": true, "ne": true, "lt": true, "lte": true, "gt": true, "gte": true}
+var branchEffectOperators = map[string]bool{"set": true, "add": true}
+
+// Public so readers without a path can still navigate, readers with a path also learn which choices their state allows
+func GetChapterChoices(ctx *gin.Context, store sessions.Store) {
+	fictionID := ctx.Param("fictionID")
+	choices, err := GetChapterChoicesOf(fictionID, ctx.Param("chapterID"))
+	if err != nil {
+		if err == ErrChapterNotFound {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch choices"})
+		}
+
+		return
+	}
+
+	if session, err := GetSession(ctx, store); err == nil {
+		if IDFromSession, ok := session.Values["ID"].(int); ok {
+			if path, err := GetReaderPathOf(IDFromSession, fictionID); err == nil {
+				MarkAvailableChoices(choices.Choices, path.State)
+			}
+		}
+	}
+
+	ctx.IndentedJSON(http.StatusOK, choices)
+}
+
+// Replaces every choice of the chapter and whether it is an ending
+func EditChapterChoices(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit choices."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the choices of this fiction") {
+		return
+	}
+
+	choicesForm := models.ChapterChoicesForm{}
+	if err := ctx.ShouldBindJSON(&choicesForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if len(choicesForm.Choices) > MAX_CHAPTER_CHOICES {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A chapter can have at most " + strconv.Itoa(MAX_CHAPTER_CHOICES) + " choices"})
+		return
+	}
+
+	variables, err := GetBranchVariablesOf(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch variables"})
+		return
+	}
+
+	defaults := BranchDefaults(variables)
+	targetIDs := []int64{}
+	for i := range choicesForm.Choices {
+		choice := &choicesForm.Choices[i]
+		choice.Text = strings.TrimSpace(choice.Text)
+		if choice.Text == "" || len([]rune(choice.Text)) > MAX_CHOICE_TEXT_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Choice texts must be between 1 and " + strconv.Itoa(MAX_CHOICE_TEXT_LENGTH) + " characters"})
+			return
+		}
+
+		if len(choice.Conditions) > MAX_CHOICE_RULES || len(choice.Effects) > MAX_CHOICE_RULES {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A choice can have at most " + strconv.Itoa(MAX_CHOICE_RULES) + " conditions and effects"})
+			return
+		}
+
+		for _, condition := range choice.Conditions {
+			if _, ok := defaults[condition.Variable]; !ok || !branchConditionOperators[condition.Operator] {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Conditions need a known variable and one of eq, ne, lt, lte, gt or gte"})
+				return
+			}
+		}
+
+		for _, effect := range choice.Effects {
+			if _, ok := defaults[effect.Variable]; !ok || !branchEffectOperators[effect.Operator] {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Effects need a known variable and set or add"})
+				return
+			}
+		}
+
+		if choice.Conditions == nil {
+			choice.Conditions = []models.BranchConditionModel{}
+		}
+
+		if choice.Effects == nil {
+			choice.Effects = []models.BranchEffectModel{}
+		}
+
+		targetIDs = append(targetIDs, int64(choice.Target_ID))
+	}
+
+	var chapterExists bool
+	var targets int
+	err = db.DB.QueryRow(
+		`
+		SELECT
+			EXISTS (SELECT 1 FROM Chapters WHERE Fiction_ID = $1 AND ID = $2),
+			(SELECT COUNT(*) FROM Chapters WHERE Fiction_ID = $1 AND ID = ANY($3))
+		`,
+		fictionID,
+		chapterID,
+		pq.Array(UniqueChapterIDs(targetIDs)),
+	).Scan(
+		&chapterExists,
+		&targets,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check chapters"})
+		return
+	}
+
+	if !chapterExists {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		return
+	}
+
+	if targets != len(UniqueChapterIDs(targetIDs)) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Some choices point to chapters that do not exist in this fiction"})
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update choices"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM ChapterChoices WHERE Fiction_ID = $1 AND Chapter_ID = $2", fictionID, chapterID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update choices"})
+		return
+	}
+
+	for i, choice := range choicesForm.Choices {
+		conditions, _ := json.Marshal(choice.Conditions)
+		effects, _ := json.Marshal(choice.Effects)
+		_, err := tx.Exec(
+			`
+			INSERT INTO ChapterChoices (Fiction_ID, Chapter_ID, Position, Text, Target_ID, Conditions, Effects)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`,
+			fictionID,
+			chapterID,
+			i + 1,
+			choice.Text,
+			choice.Target_ID,
+			string(conditions),
+			string(effects),
+		)
+
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update choices"})
+			return
+		}
+	}
+
+	if choicesForm.Ending {
+		_, err = tx.Exec("INSERT INTO ChapterEndings (Fiction_ID, Chapter_ID) VALUES ($1, $2) ON CONFLICT DO NOTHING", fictionID, chapterID)
+	} else {
+		_, err = tx.Exec("DELETE FROM ChapterEndings WHERE Fiction_ID = $1 AND Chapter_ID = $2", fictionID, chapterID)
+	}
+
+	if err != nil || tx.Commit() != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update choices"})
+		return
+	}
+
+	choices, err := GetChapterChoicesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch choices"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, choices)
+}
+
+func GetBranchVariables(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view variables."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view the variables of this fiction") {
+		return
+	}
+
+	variables, err := GetBranchVariablesOf(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch variables"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, variables)
+}
+
+// Replaces every variable of the fiction. Choices still using a removed variable show up in the graph report
+// and read it as 0.
+func EditBranchVariables(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit variables."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the variables of this fiction") {
+		return
+	}
+
+	variables := []models.BranchVariableModel{}
+	if err := ctx.ShouldBindJSON(&variables); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if len(variables) > MAX_BRANCH_VARIABLES {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A fiction can have at most " + strconv.Itoa(MAX_BRANCH_VARIABLES) + " variables"})
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, variable := range variables {
+		if !BranchVariablePattern.MatchString(variable.Name) || seen[variable.Name] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Variable names must be unique, start with a letter or _ and only use letters, digits and _"})
+			return
+		}
+
+		seen[variable.Name] = true
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update variables"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM BranchVariables WHERE Fiction_ID = $1", fictionID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update variables"})
+		return
+	}
+
+	for _, variable := range variables {
+		if _, err := tx.Exec("INSERT INTO BranchVariables (Fiction_ID, Name, Default_Value) VALUES ($1, $2, $3)", fictionID, variable.Name, variable.Default_Value); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update variables"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update variables"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, variables)
+}
+
+// Checks the chapter graph from the first chapter. Cycles are allowed, they are listed so the author can make
+// sure readers have a way out.
+func GetBranchGraphReport(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to check the chapter graph."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "check the chapter graph of this fiction") {
+		return
+	}
+
+	report, err := BuildBranchGraphReport(fictionID)
+	if err != nil {
+		if err == ErrChapterNotFound {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "The fiction has no chapters"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check the chapter graph"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+func GetReaderPath(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to track your path."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	path, err := GetReaderPathOf(IDFromSession.(int), fictionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "You have not started this fiction"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch path"})
+		}
+
+		return
+	}
+
+	RespondBranchStep(ctx, http.StatusOK, fictionID, path)
+}
+
+// Starts the reader over at the first chapter with every variable at its default, an existing path is replaced
+func StartReaderPath(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to track your path."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	var startID sql.NullInt64
+	if err := db.DB.QueryRow("SELECT MIN(ID) FROM Chapters WHERE Fiction_ID = $1", fictionID).Scan(&startID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start path"})
+		return
+	}
+
+	if !startID.Valid {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "The fiction has no chapters"})
+		return
+	}
+
+	variables, err := GetBranchVariablesOf(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start path"})
+		return
+	}
+
+	state, _ := json.Marshal(BranchDefaults(variables))
+	row := db.DB.QueryRow(
+		`
+		INSERT INTO ReaderPaths (User_ID, Fiction_ID, Chapter_ID, State, Path)
+		VALUES ($1, $2, $3, $4, ARRAY[$3::INT])
+		ON CONFLICT (User_ID, Fiction_ID) DO UPDATE
+		SET Chapter_ID = EXCLUDED.Chapter_ID, State = EXCLUDED.State, Path = EXCLUDED.Path, Created = NOW(), Updated = NOW()
+		RETURNING Fiction_ID, Chapter_ID, State, Path, Created, Updated
+		`,
+		IDFromSession.(int),
+		fictionID,
+		startID.Int64,
+		string(state),
+	)
+
+	path, err := ScanReaderPath(row)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start path"})
+		return
+	}
+
+	RespondBranchStep(ctx, http.StatusCreated, fictionID, path)
+}
+
+// Follows a choice of the chapter the reader is at, applies its effects and returns the next chapter
+func ChooseChapterChoice(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to track your path."})
+		return
+	}
+
+	userID := IDFromSession.(int)
+	fictionID := ctx.Param("fictionID")
+	path, err := GetReaderPathOf(userID, fictionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "You have not started this fiction"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch path"})
+		}
+
+		return
+	}
+
+	if strconv.Itoa(path.Chapter_ID) != ctx.Param("chapterID") {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "You are not at this chapter", "Chapter_ID": path.Chapter_ID})
+		return
+	}
+
+	choice := models.ChapterChoiceModel{}
+	var conditions, effects []byte
+	err = db.DB.QueryRow(
+		`
+		SELECT
+			Target_ID, Conditions, Effects
+		FROM
+			ChapterChoices
+		WHERE
+			ID = $1 AND Fiction_ID = $2 AND Chapter_ID = $3
+		`,
+		ctx.Param("choiceID"),
+		fictionID,
+		path.Chapter_ID,
+	).Scan(
+		&choice.Target_ID,
+		&conditions,
+		&effects,
+	)
+
+	if err == nil {
+		err = json.Unmarshal(conditions, &choice.Conditions)
+	}
+
+	if err == nil {
+		err = json.Unmarshal(effects, &choice.Effects)
+	}
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Choice not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch choice"})
+		}
+
+		return
+	}
+
+	if !BranchConditionsMet(choice.Conditions, path.State) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{"Error": "This choice is not available on your path"})
+		return
+	}
+
+	ApplyBranchEffects(choice.Effects, path.State)
+	visited := []int64{}
+	for _, chapterID := range append(path.Path, choice.Target_ID) {
+		visited = append(visited, int64(chapterID))
+	}
+
+	if len(visited) > MAX_READER_PATH_LENGTH {
+		visited = visited[len(visited) - MAX_READER_PATH_LENGTH:]
+	}
+
+	state, _ := json.Marshal(path.State)
+
+	// Matching the current chapter keeps two tabs from both following a choice out of the same chapter
+	row := db.DB.QueryRow(
+		`
+		UPDATE ReaderPaths
+		SET Chapter_ID = $1, State = $2, Path = $3, Updated = NOW()
+		WHERE User_ID = $4 AND Fiction_ID = $5 AND Chapter_ID = $6
+		RETURNING Fiction_ID, Chapter_ID, State, Path, Created, Updated
+		`,
+		choice.Target_ID,
+		string(state),
+		pq.Array(visited),
+		userID,
+		fictionID,
+		path.Chapter_ID,
+	)
+
+	path, err = ScanReaderPath(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "Your path changed meanwhile, fetch it again"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update path"})
+		}
+
+		return
+	}
+
+	RespondBranchStep(ctx, http.StatusOK, fictionID, path)
+}
+
+// Responds with the reader's current chapter and the choices out of it
+func RespondBranchStep(ctx *gin.Context, status int, fictionID string, path *models.ReaderPathModel) {
+	chapter, err := GetChapterOf(fictionID, path.Chapter_ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The chapter you were at was removed, start the fiction again"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return
+	}
+
+	choices, err := GetChapterChoicesOf(fictionID, path.Chapter_ID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch choices"})
+		return
+	}
+
+	MarkAvailableChoices(choices.Choices, path.State)
+	step := models.BranchStepModel{Path: *path, Chapter: chapter}
+	step.Ending = choices.Ending
+	step.Choices = choices.Choices
+	ctx.IndentedJSON(status, step)
+}
+
+func BuildBranchGraphReport(fictionID string) (*models.BranchGraphReportModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			C.ID, EXISTS (SELECT 1 FROM ChapterEndings E WHERE E.Fiction_ID = C.Fiction_ID AND E.Chapter_ID = C.ID)
+		FROM
+			Chapters C
+		WHERE
+			C.Fiction_ID = $1
+		ORDER BY C.ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	chapterIDs := []int{}
+	endings := map[int]bool{}
+	for rows.Next() {
+		var chapterID int
+		var ending bool
+		if err := rows.Scan(&chapterID, &ending); err != nil {
+			return nil, err
+		}
+
+		chapterIDs = append(chapterIDs, chapterID)
+		endings[chapterID] = ending
+	}
+
+	if len(chapterIDs) == 0 {
+		return nil, ErrChapterNotFound
+	}
+
+	variables, err := GetBranchVariablesOf(fictionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := BranchDefaults(variables)
+	choiceRows, err := db.DB.Query("SELECT Chapter_ID, Target_ID, Conditions, Effects FROM ChapterChoices WHERE Fiction_ID = $1", fictionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer choiceRows.Close()
+	edges := map[int][]int{}
+	reverse := map[int][]int{}
+	unknown := map[string]bool{}
+	for choiceRows.Next() {
+		var from, to int
+		var conditions, effects []byte
+		if err := choiceRows.Scan(
+			&from,
+			&to,
+			&conditions,
+			&effects,
+		); err != nil {
+			return nil, err
+		}
+
+		edges[from] = append(edges[from], to)
+		reverse[to] = append(reverse[to], from)
+
+		rules := []models.BranchConditionModel{}
+		if err := json.Unmarshal(conditions, &rules); err != nil {
+			return nil, err
+		}
+
+		changes := []models.BranchEffectModel{}
+		if err := json.Unmarshal(effects, &changes); err != nil {
+			return nil, err
+		}
+
+		for _, rule := range rules {
+			if _, ok := defaults[rule.Variable]; !ok {
+				unknown[rule.Variable] = true
+			}
+		}
+
+		for _, change := range changes {
+			if _, ok := defaults[change.Variable]; !ok {
+				unknown[change.Variable] = true
+			}
+		}
+	}
+
+	report := models.BranchGraphReportModel{
+		Start_Chapter_ID:  chapterIDs[0],
+		Unreachable:       []int{},
+		Dead_Ends:         []int{},
+		No_Ending:         []int{},
+		Cycles:            FindChapterCycles(chapterIDs, edges),
+		Unknown_Variables: []string{},
+	}
+
+	reachable := WalkChapterGraph([]int{report.Start_Chapter_ID}, edges)
+	endingIDs := []int{}
+	for _, chapterID := range chapterIDs {
+		if endings[chapterID] {
+			endingIDs = append(endingIDs, chapterID)
+		}
+	}
+
+	leadsToEnding := WalkChapterGraph(endingIDs, reverse)
+	for _, chapterID := range chapterIDs {
+		deadEnd := !endings[chapterID] && len(edges[chapterID]) == 0
+		if !reachable[chapterID] {
+			report.Unreachable = append(report.Unreachable, chapterID)
+		}
+
+		if deadEnd {
+			report.Dead_Ends = append(report.Dead_Ends, chapterID)
+		} else if reachable[chapterID] && !leadsToEnding[chapterID] {
+			report.No_Ending = append(report.No_Ending, chapterID)
+		}
+	}
+
+	for variable := range unknown {
+		report.Unknown_Variables = append(report.Unknown_Variables, variable)
+	}
+
+	sort.Strings(report.Unknown_Variables)
+	return &report, nil
+}
+
+// Every chapter reachable from the given ones, the given ones included
+func WalkChapterGraph(from []int, edges map[int][]int) map[int]bool {
+	seen := map[int]bool{}
+	queue := append([]int{}, from...)
+	for _, chapterID := range from {
+		seen[chapterID] = true
+	}
+
+	for len(queue) > 0 {
+		chapterID := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[chapterID] {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return seen
+}
+
+// Strongly connected components with more than one chapter, or a chapter linking to itself (Tarjan)
+func FindChapterCycles(chapterIDs []int, edges map[int][]int) [][]int {
+	index := map[int]int{}
+	lowLink := map[int]int{}
+	onStack := map[int]bool{}
+	stack := []int{}
+	cycles := [][]int{}
+	counter := 0
+
+	var connect func(chapterID int)
+	connect = func(chapterID int) {
+		index[chapterID] = counter
+		lowLink[chapterID] = counter
+		counter++
+		stack = append(stack, chapterID)
+		onStack[chapterID] = true
+
+		selfLoop := false
+		for _, next := range edges[chapterID] {
+			if next == chapterID {
+				selfLoop = true
+			}
+
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowLink[next] < lowLink[chapterID] {
+					lowLink[chapterID] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[chapterID] {
+				lowLink[chapterID] = index[next]
+			}
+		}
+
+		if lowLink[chapterID] != index[chapterID] {
+			return
+		}
+
+		component := []int{}
+		for {
+			last := stack[len(stack) - 1]
+			stack = stack[:len(stack) - 1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == chapterID {
+				break
+			}
+		}
+
+		if len(component) > 1 || selfLoop {
+			sort.Ints(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, chapterID := range chapterIDs {
+		if _, visited := index[chapterID]; !visited {
+			connect(chapterID)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+
+	return cycles
+}
+
+func BranchConditionsMet(conditions []models.BranchConditionModel, state map[string]int) bool {
+	for _, condition := range conditions {
+		value := state[condition.Variable]
+		met := false
+		switch condition.Operator {
+		case "eq":
+			met = value == condition.Value
+		case "ne":
+			met = value != condition.Value
+		case "lt":
+			met = value < condition.Value
+		case "lte":
+			met = value <= condition.Value
+		case "gt":
+			met = value > condition.Value
+		case "gte":
+			met = value >= condition.Value
+		}
+
+		if !met {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ApplyBranchEffects(effects []models.BranchEffectModel, state map[string]int) {
+	for _, effect := range effects {
+		switch effect.Operator {
+		case "set":
+			state[effect.Variable] = effect.Value
+		case "add":
+			state[effect.Variable] += effect.Value
+		}
+	}
+}
+
+func MarkAvailableChoices(choices []models.ChapterChoiceModel, state map[string]int) {
+	for i := range choices {
+		available := BranchConditionsMet(choices[i].Conditions, state)
+		choices[i].Available = &available
+	}
+}
+
+func BranchDefaults(variables []models.BranchVariableModel) map[string]int {
+	defaults := map[string]int{}
+	for _, variable := range variables {
+		defaults[variable.Name] = variable.Default_Value
+	}
+
+	return defaults
+}
+
+func GetBranchVariablesOf(fictionID string) ([]models.BranchVariableModel, error) {
+	rows, err := db.DB.Query("SELECT Name, Default_Value FROM BranchVariables WHERE Fiction_ID = $1 ORDER BY Name", fictionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	variables := []models.BranchVariableModel{}
+	for rows.Next() {
+		variable := models.BranchVariableModel{}
+		if err := rows.Scan(&variable.Name, &variable.Default_Value); err != nil {
+			return nil, err
+		}
+
+		variables = append(variables, variable)
+	}
+
+	return variables, nil
+}
+
+// Returns ErrChapterNotFound when the chapter does not exist
+func GetChapterChoicesOf(fictionID string, chapterID interface{}) (*models.ChapterChoicesModel, error) {
+	choices := models.ChapterChoicesModel{Choices: []models.ChapterChoiceModel{}}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Fiction_ID, ID, EXISTS (SELECT 1 FROM ChapterEndings E WHERE E.Fiction_ID = C.Fiction_ID AND E.Chapter_ID = C.ID)
+		FROM
+			Chapters C
+		WHERE
+			Fiction_ID = $1 AND ID = $2
+		`,
+		fictionID,
+		chapterID,
+	).Scan(
+		&choices.Fiction_ID,
+		&choices.Chapter_ID,
+		&choices.Ending,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrChapterNotFound
+		}
+
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			C.ID, C.Chapter_ID, C.Position, C.Text, C.Target_ID, T.Title, C.Conditions, C.Effects
+		FROM
+			ChapterChoices C
+		JOIN
+			Chapters T
+		ON
+			T.Fiction_ID = C.Fiction_ID AND T.ID = C.Target_ID
+		WHERE
+			C.Fiction_ID = $1 AND C.Chapter_ID = $2
+		ORDER BY C.Position
+		`,
+		fictionID,
+		chapterID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		choice := models.ChapterChoiceModel{}
+		var conditions, effects []byte
+		if err := rows.Scan(
+			&choice.ID,
+			&choice.Chapter_ID,
+			&choice.Position,
+			&choice.Text,
+			&choice.Target_ID,
+			&choice.Target_Title,
+			&conditions,
+			&effects,
+		); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(conditions, &choice.Conditions); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(effects, &choice.Effects); err != nil {
+			return nil, err
+		}
+
+		choices.Choices = append(choices.Choices, choice)
+	}
+
+	return &choices, nil
+}
+
+func GetReaderPathOf(userID int, fictionID string) (*models.ReaderPathModel, error) {
+	row := db.DB.QueryRow(
+		`
+		SELECT
+			Fiction_ID, Chapter_ID, State, Path, Created, Updated
+		FROM
+			ReaderPaths
+		WHERE
+			User_ID = $1 AND Fiction_ID = $2
+		`,
+		userID,
+		fictionID,
+	)
+
+	return ScanReaderPath(row)
+}
+
+func ScanReaderPath(row interface{ Scan(...interface{}) error }) (*models.ReaderPathModel, error) {
+	path := models.ReaderPathModel{}
+	var state []byte
+	var visited pq.Int64Array
+	if err := row.Scan(
+		&path.Fiction_ID,
+		&path.Chapter_ID,
+		&state,
+		&visited,
+		&path.Created,
+		&path.Updated,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(state, &path.State); err != nil {
+		return nil, err
+	}
+
+	if path.State == nil {
+		path.State = map[string]int{}
+	}
+
+	path.Path = []int{}
+	for _, chapterID := range visited {
+		path.Path = append(path.Path, int(chapterID))
+	}
+
+	return &path, nil
+}
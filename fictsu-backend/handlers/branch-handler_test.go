@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+func TestFindChapterCycles(t *testing.T) {
+	tests := []struct {
+		name       string
+		chapterIDs []int
+		edges      map[int][]int
+		want       [][]int
+	}{
+		{
+			name:       "linear story",
+			chapterIDs: []int{1, 2, 3},
+			edges:      map[int][]int{1: {2}, 2: {3}},
+			want:       [][]int{},
+		},
+		{
+			name:       "diamond without a loop",
+			chapterIDs: []int{1, 2, 3, 4},
+			edges:      map[int][]int{1: {2, 3}, 2: {4}, 3: {4}},
+			want:       [][]int{},
+		},
+		{
+			name:       "self loop",
+			chapterIDs: []int{1, 2},
+			edges:      map[int][]int{1: {2}, 2: {2}},
+			want:       [][]int{{2}},
+		},
+		{
+			name:       "two chapter loop",
+			chapterIDs: []int{1, 2, 3},
+			edges:      map[int][]int{1: {2}, 2: {3}, 3: {2}},
+			want:       [][]int{{2, 3}},
+		},
+		{
+			name:       "separate loops sorted by first chapter",
+			chapterIDs: []int{1, 2, 3, 4, 5},
+			edges:      map[int][]int{1: {4, 2}, 4: {5}, 5: {4}, 2: {3}, 3: {2}},
+			want:       [][]int{{2, 3}, {4, 5}},
+		},
+		{
+			name:       "loop back to the start",
+			chapterIDs: []int{3, 1, 2},
+			edges:      map[int][]int{1: {2}, 2: {3}, 3: {1}},
+			want:       [][]int{{1, 2, 3}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FindChapterCycles(test.chapterIDs, test.edges); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWalkChapterGraph(t *testing.T) {
+	edges := map[int][]int{1: {2, 3}, 2: {4}, 3: {4}, 5: {6}, 6: {5}}
+	tests := []struct {
+		name string
+		from []int
+		want map[int]bool
+	}{
+		{name: "from the first chapter", from: []int{1}, want: map[int]bool{1: true, 2: true, 3: true, 4: true}},
+		{name: "from a leaf", from: []int{4}, want: map[int]bool{4: true}},
+		{name: "from a loop", from: []int{5}, want: map[int]bool{5: true, 6: true}},
+		{name: "from several chapters", from: []int{3, 6}, want: map[int]bool{3: true, 4: true, 5: true, 6: true}},
+		{name: "from nothing", from: []int{}, want: map[int]bool{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := WalkChapterGraph(test.from, edges); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBranchConditionsMet(t *testing.T) {
+	state := map[string]int{"trust": 3}
+	tests := []struct {
+		name       string
+		conditions []models.BranchConditionModel
+		want       bool
+	}{
+		{name: "no conditions", want: true},
+		{name: "eq", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "eq", Value: 3}}, want: true},
+		{name: "ne", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "ne", Value: 3}}, want: false},
+		{name: "lt", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "lt", Value: 3}}, want: false},
+		{name: "lte", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "lte", Value: 3}}, want: true},
+		{name: "gt", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "gt", Value: 2}}, want: true},
+		{name: "gte", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "gte", Value: 4}}, want: false},
+		{name: "unset variable is zero", conditions: []models.BranchConditionModel{{Variable: "fear", Operator: "eq", Value: 0}}, want: true},
+		{name: "unknown operator fails", conditions: []models.BranchConditionModel{{Variable: "trust", Operator: "like", Value: 3}}, want: false},
+		{
+			name: "all must hold",
+			conditions: []models.BranchConditionModel{
+				{Variable: "trust", Operator: "gte", Value: 1},
+				{Variable: "trust", Operator: "lt", Value: 3},
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := BranchConditionsMet(test.conditions, state); got != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyBranchEffects(t *testing.T) {
+	state := map[string]int{"trust": 3, "fear": 1}
+	ApplyBranchEffects([]models.BranchEffectModel{
+		{Variable: "trust", Operator: "add", Value: -2},
+		{Variable: "fear", Operator: "set", Value: 5},
+		{Variable: "gold", Operator: "add", Value: 10},
+		{Variable: "fear", Operator: "multiply", Value: 2},
+	}, state)
+
+	want := map[string]int{"trust": 1, "fear": 5, "gold": 10}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("got %v, want %v", state, want)
+	}
+}
@@ -7,11 +7,19 @@ import (
 	"strconv"
 	"net/http"
 	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 
 	db "github.com/Fictsu/Fictsu/database"
 	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+var (
+	ErrChapterNotFound  = fmt.Errorf("chapter not found")
+	ErrNoChapterChanges = fmt.Errorf("no valid fields provided for update")
 )
 
 func GetAllChapters(fictionID string) ([]models.ChapterModel, error) {
@@ -53,13 +61,31 @@ func GetAllChapters(fictionID string) ([]models.ChapterModel, error) {
 }
 
 func GetChapter(ctx *gin.Context) {
-	fictionID := ctx.Param("fictionID")
-	chapterID := ctx.Param("chapterID")
+	chapter, err := GetChapterOf(ctx.Param("fictionID"), ctx.Param("chapterID"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, chapter)
+}
+
+// Loads a chapter the way readers see it, with its notes, pages and codex mentions. Every handler that serves
+// a chapter to a reader goes through here so they all return the same fields.
+func GetChapterOf(fictionID string, chapterID interface{}) (models.ChapterModel, error) {
 	chapter := models.ChapterModel{}
+	var preNote, postNote string
+	var footnotes []byte
+	var warnings pq.StringArray
 	err := db.DB.QueryRow(
 		`
 		SELECT
-			Fiction_ID, ID, Title, Content, Created
+			Fiction_ID, ID, Title, Content, Format, Pre_Note, Post_Note, Footnotes, Content_Warnings, Created
 		FROM
 			Chapters
 		WHERE
@@ -72,24 +98,38 @@ func GetChapter(ctx *gin.Context) {
 		&chapter.ID,
 		&chapter.Title,
 		&chapter.Content,
+		&chapter.Format,
+		&preNote,
+		&postNote,
+		&footnotes,
+		&warnings,
 		&chapter.Created,
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
-		} else {
-			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
-		}
+		return chapter, err
+	}
 
-		return
+	chapter.Pre_Note = &preNote
+	chapter.Post_Note = &postNote
+	chapter.Content_Warnings = []string(warnings)
+	chapter.Footnotes = []models.ChapterFootnoteModel{}
+	if err := json.Unmarshal(footnotes, &chapter.Footnotes); err != nil {
+		return chapter, err
 	}
 
-	ctx.IndentedJSON(http.StatusOK, chapter)
+	if chapter.Format == models.ChapterPages {
+		if chapter.Pages, err = GetChapterPagesOf(fictionID, chapterID); err != nil {
+			return chapter, err
+		}
+	}
+
+	AttachCodexMentions(&chapter)
+	return chapter, nil
 }
 
-func CreateChapter(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func CreateChapter(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -109,7 +149,7 @@ func CreateChapter(ctx *gin.Context, store *sessions.CookieStore) {
 	errMatch := db.DB.QueryRow(
 		`
 		SELECT
-			Contributor_ID
+			COALESCE(Contributor_ID, 0)
 		FROM
 			Fictions
 		WHERE
@@ -142,6 +182,39 @@ func CreateChapter(ctx *gin.Context, store *sessions.CookieStore) {
 		return
 	}
 
+	script, ok := PrepareChapterFormat(ctx, &chapterCreateRequest)
+	if !ok {
+		return
+	}
+
+	// A new chapter has nothing stored, so every footnote problem is rejected and there are no warnings
+	if _, ok := PrepareChapterNotes(ctx, fictionID, "", &chapterCreateRequest); !ok {
+		return
+	}
+
+	// Notes and lists left out of the request start empty
+	if chapterCreateRequest.Pre_Note == nil {
+		chapterCreateRequest.Pre_Note = new(string)
+	}
+
+	if chapterCreateRequest.Post_Note == nil {
+		chapterCreateRequest.Post_Note = new(string)
+	}
+
+	if chapterCreateRequest.Footnotes == nil {
+		chapterCreateRequest.Footnotes = []models.ChapterFootnoteModel{}
+	}
+
+	if chapterCreateRequest.Content_Warnings == nil {
+		chapterCreateRequest.Content_Warnings = []string{}
+	}
+
+	footnotes, errFootnotes := json.Marshal(chapterCreateRequest.Footnotes)
+	if errFootnotes != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid footnotes"})
+		return
+	}
+
 	var nextChapterID int
 	errNextChapterID := db.DB.QueryRow(
 		`
@@ -165,14 +238,20 @@ func CreateChapter(ctx *gin.Context, store *sessions.CookieStore) {
 	var newCreatedTS time.Time
 	errInsert := db.DB.QueryRow(
 		`
-		INSERT INTO Chapters (Fiction_ID, ID, Title, Content)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO Chapters (Fiction_ID, ID, Title, Content, Format, Script, Pre_Note, Post_Note, Footnotes, Content_Warnings)
+		VALUES ($1, $2, $3, $4, $5, $6::JSONB, $7, $8, $9::JSONB, $10)
 		RETURNING Created
 		`,
 		fictionID,
 		nextChapterID,
 		chapterCreateRequest.Title,
 		chapterCreateRequest.Content,
+		chapterCreateRequest.Format,
+		script,
+		*chapterCreateRequest.Pre_Note,
+		*chapterCreateRequest.Post_Note,
+		string(footnotes),
+		pq.Array(chapterCreateRequest.Content_Warnings),
 	).Scan(
 		&newCreatedTS,
 	)
@@ -191,11 +270,12 @@ func CreateChapter(ctx *gin.Context, store *sessions.CookieStore) {
 	chapterCreateRequest.Fiction_ID = fictionIDInt
 	chapterCreateRequest.ID = nextChapterID
 	chapterCreateRequest.Created = newCreatedTS
+	DispatchWebhookEvent(fictionID, models.ChapterCreated, chapterCreateRequest)
 	ctx.IndentedJSON(http.StatusCreated, chapterCreateRequest)
 }
 
-func EditChapter(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func EditChapter(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -216,7 +296,7 @@ func EditChapter(ctx *gin.Context, store *sessions.CookieStore) {
 	errMatch := db.DB.QueryRow(
 		`
 		SELECT
-			Contributor_ID
+			COALESCE(Contributor_ID, 0)
 		FROM
 			Fictions
 		WHERE
@@ -249,46 +329,120 @@ func EditChapter(ctx *gin.Context, store *sessions.CookieStore) {
 		return
 	}
 
+	// Sending a script or a format converts the chapter, without them only the title and content change
+	formatChanged := chapterUpdateRequest.Format != "" || chapterUpdateRequest.Script != nil
+	var script interface{}
+	if formatChanged {
+		var ok bool
+		if script, ok = PrepareChapterFormat(ctx, &chapterUpdateRequest); !ok {
+			return
+		}
+	}
+
+	notesChanged := chapterUpdateRequest.Pre_Note != nil || chapterUpdateRequest.Post_Note != nil || chapterUpdateRequest.Footnotes != nil || chapterUpdateRequest.Content_Warnings != nil
+	warnings, ok := PrepareChapterNotes(ctx, fictionID, chapterID, &chapterUpdateRequest)
+	if !ok {
+		return
+	}
+
+	// One transaction so the text, format and notes never end up half saved, webhooks only hear about a commit
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	storedTitle, err := UpdateChapterText(tx, fictionID, chapterID, chapterUpdateRequest.Title, chapterUpdateRequest.Content)
+	if err == ErrNoChapterChanges && (formatChanged || notesChanged) {
+		err = nil
+	}
+
+	if err == nil && formatChanged {
+		storedTitle, err = SaveChapterFormat(tx, fictionID, chapterID, chapterUpdateRequest.Format, script)
+	}
+
+	if err == nil && notesChanged {
+		storedTitle, err = SaveChapterNotes(tx, fictionID, chapterID, chapterUpdateRequest)
+	}
+
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		switch err {
+		case ErrNoChapterChanges:
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No valid fields provided for update"})
+		case ErrChapterNotFound:
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		default:
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
+		}
+
+		return
+	}
+
+	DispatchWebhookEvent(fictionID, models.ChapterUpdated, gin.H{"chapter_id": chapterID, "title": storedTitle})
+	if len(warnings) > 0 {
+		ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Chapter updated successfully", "Warnings": warnings})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Chapter updated successfully"})
+}
+
+// Updates the non-empty fields of a chapter and notifies webhooks, shared by every feature that edits chapters
+func SaveChapterUpdate(fictionID string, chapterID string, title string, content string) error {
+	storedTitle, err := UpdateChapterText(db.DB, fictionID, chapterID, title, content)
+	if err != nil {
+		return err
+	}
+
+	DispatchWebhookEvent(fictionID, models.ChapterUpdated, gin.H{"chapter_id": chapterID, "title": storedTitle})
+	return nil
+}
+
+// The part of SaveChapterUpdate that can run inside a transaction, the caller notifies webhooks once it commits.
+// Returns the stored title since content-only edits leave title empty.
+func UpdateChapterText(querier Querier, fictionID string, chapterID string, title string, content string) (string, error) {
 	query := "UPDATE Chapters SET "
 	params := []interface{}{}
 	paramIndex := 1
-	if chapterUpdateRequest.Title != "" {
+	if title != "" {
 		query += "Title = $" + strconv.Itoa(paramIndex) + ", "
-		params = append(params, chapterUpdateRequest.Title)
+		params = append(params, title)
 		paramIndex++
 	}
 
-	if chapterUpdateRequest.Content != "" {
+	if content != "" {
 		query += "Content = $" + strconv.Itoa(paramIndex) + ", "
-		params = append(params, chapterUpdateRequest.Content)
+		params = append(params, content)
 		paramIndex++
 	}
 
 	if len(params) == 0 {
-		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No valid fields provided for update"})
-		return
+		return "", ErrNoChapterChanges
 	}
 
-	query = strings.TrimSuffix(query, ", ") + " WHERE ID = $" + strconv.Itoa(paramIndex) + " AND Fiction_ID = $" + strconv.Itoa(paramIndex + 1)
+	query = strings.TrimSuffix(query, ", ") + " WHERE ID = $" + strconv.Itoa(paramIndex) + " AND Fiction_ID = $" + strconv.Itoa(paramIndex + 1) + " RETURNING Title"
 	params = append(params, chapterID, fictionID)
 
-	result, err := db.DB.Exec(query, params...)
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
-		return
-	}
+	var storedTitle string
+	if err := querier.QueryRow(query, params...).Scan(&storedTitle); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrChapterNotFound
+		}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
-		return
+		return "", err
 	}
 
-	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Chapter updated successfully"})
+	return storedTitle, nil
 }
 
-func DeleteChapter(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func DeleteChapter(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -309,7 +463,7 @@ func DeleteChapter(ctx *gin.Context, store *sessions.CookieStore) {
 	errMatch := db.DB.QueryRow(
 		`
 		SELECT
-			Contributor_ID
+			COALESCE(Contributor_ID, 0)
 		FROM
 			Fictions
 		WHERE
@@ -336,6 +490,12 @@ func DeleteChapter(ctx *gin.Context, store *sessions.CookieStore) {
 		return
 	}
 
+	pages, err := GetChapterPagesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete chapter"})
+		return
+	}
+
 	result, err := db.DB.Exec(
 		`
 		DELETE FROM
@@ -358,5 +518,13 @@ func DeleteChapter(ctx *gin.Context, store *sessions.CookieStore) {
 		return
 	}
 
+	// Page image cleanup is best effort, the chapter is already gone at this point
+	go func() {
+		for _, page := range pages {
+			DeleteImageFromFirebase(ChapterPagePath(page.Fiction_ID, page.ID), configs.BucketName)
+		}
+	}()
+
+	DispatchWebhookEvent(fictionID, models.ChapterDeleted, gin.H{"chapter_id": chapterID})
 	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Chapter deleted successfully"})
 }
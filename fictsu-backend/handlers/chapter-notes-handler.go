@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"strconv"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_CHAPTER_NOTE_LENGTH    int = 10000
+	MAX_CHAPTER_FOOTNOTES      int = 100
+	MAX_FOOTNOTE_LENGTH        int = 2000
+	MAX_CONTENT_WARNINGS       int = 10
+	MAX_CONTENT_WARNING_LENGTH int = 50
+)
+
+var FootnoteIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+var FootnoteMarkerPattern = regexp.MustCompile(`\[\^([A-Za-z0-9_-]{1,20})\]`)
+
+// Validates the author notes, footnotes and content warnings of a chapter being created or edited, and writes the
+// error response itself when it returns false. Warnings are trimmed, lowercased and deduplicated in place.
+// Footnotes are checked against the [^ID] markers in the content, on edits the side left out is loaded from the
+// chapter. A marker without a footnote or a footnote without a marker is rejected, unless the stored chapter
+// already had that problem, e.g. after a translation or an accepted suggestion, then it is only returned as a
+// warning so the author can still save.
+func PrepareChapterNotes(ctx *gin.Context, fictionID string, chapterID string, chapter *models.ChapterModel) ([]string, bool) {
+	for _, note := range []*string{chapter.Pre_Note, chapter.Post_Note} {
+		if note != nil && len([]rune(*note)) > MAX_CHAPTER_NOTE_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Author notes must be at most " + strconv.Itoa(MAX_CHAPTER_NOTE_LENGTH) + " characters"})
+			return nil, false
+		}
+	}
+
+	if chapter.Content_Warnings != nil {
+		if len(chapter.Content_Warnings) > MAX_CONTENT_WARNINGS {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A chapter can have at most " + strconv.Itoa(MAX_CONTENT_WARNINGS) + " content warnings"})
+			return nil, false
+		}
+
+		warnings := []string{}
+		seen := map[string]bool{}
+		for _, warning := range chapter.Content_Warnings {
+			warning = strings.ToLower(strings.Join(strings.Fields(warning), " "))
+			if warning == "" || len([]rune(warning)) > MAX_CONTENT_WARNING_LENGTH {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Content warnings must be between 1 and " + strconv.Itoa(MAX_CONTENT_WARNING_LENGTH) + " characters"})
+				return nil, false
+			}
+
+			if !seen[warning] {
+				seen[warning] = true
+				warnings = append(warnings, warning)
+			}
+		}
+
+		chapter.Content_Warnings = warnings
+	}
+
+	if chapter.Footnotes != nil {
+		if len(chapter.Footnotes) > MAX_CHAPTER_FOOTNOTES {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A chapter can have at most " + strconv.Itoa(MAX_CHAPTER_FOOTNOTES) + " footnotes"})
+			return nil, false
+		}
+
+		seen := map[string]bool{}
+		for i, footnote := range chapter.Footnotes {
+			if !FootnoteIDPattern.MatchString(footnote.ID) {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Footnote IDs may only use letters, digits, _ and -, up to 20 characters"})
+				return nil, false
+			}
+
+			if seen[footnote.ID] {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Footnote " + footnote.ID + " is defined twice"})
+				return nil, false
+			}
+
+			text := strings.TrimSpace(footnote.Text)
+			if text == "" || len([]rune(text)) > MAX_FOOTNOTE_LENGTH {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Footnote texts must be between 1 and " + strconv.Itoa(MAX_FOOTNOTE_LENGTH) + " characters"})
+				return nil, false
+			}
+
+			seen[footnote.ID] = true
+			chapter.Footnotes[i].Text = text
+		}
+	}
+
+	// Nothing that the markers depend on changes
+	if chapter.Footnotes == nil && chapter.Content == "" {
+		return nil, true
+	}
+
+	content := chapter.Content
+	footnotes := chapter.Footnotes
+	storedUndefined := map[string]bool{}
+	storedUnreferenced := map[string]bool{}
+	if chapterID != "" {
+		current, err := GetChapterFootnotesOf(fictionID, chapterID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+			} else {
+				ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+			}
+
+			return nil, false
+		}
+
+		if content == "" {
+			content = current.Content
+		}
+
+		if footnotes == nil {
+			footnotes = current.Footnotes
+		}
+
+		undefined, unreferenced := CheckFootnoteMarkers(current.Content, current.Footnotes)
+		for _, ID := range undefined {
+			storedUndefined[ID] = true
+		}
+
+		for _, ID := range unreferenced {
+			storedUnreferenced[ID] = true
+		}
+	}
+
+	warnings := []string{}
+	undefined, unreferenced := CheckFootnoteMarkers(content, footnotes)
+	for _, ID := range undefined {
+		problem := "The content references footnote " + ID + " which is not defined"
+		if !storedUndefined[ID] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": problem})
+			return nil, false
+		}
+
+		warnings = append(warnings, problem)
+	}
+
+	for _, ID := range unreferenced {
+		problem := "Footnote " + ID + " is never referenced, add [^" + ID + "] to the content"
+		if !storedUnreferenced[ID] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": problem})
+			return nil, false
+		}
+
+		warnings = append(warnings, problem)
+	}
+
+	return warnings, true
+}
+
+// Lists the markers with no footnote and the footnotes with no marker, each once and in the order they appear
+func CheckFootnoteMarkers(content string, footnotes []models.ChapterFootnoteModel) ([]string, []string) {
+	defined := map[string]bool{}
+	for _, footnote := range footnotes {
+		defined[footnote.ID] = true
+	}
+
+	undefined := []string{}
+	referenced := map[string]bool{}
+	for _, match := range FootnoteMarkerPattern.FindAllStringSubmatch(content, -1) {
+		if !defined[match[1]] && !referenced[match[1]] {
+			undefined = append(undefined, match[1])
+		}
+
+		referenced[match[1]] = true
+	}
+
+	unreferenced := []string{}
+	for _, footnote := range footnotes {
+		if !referenced[footnote.ID] {
+			unreferenced = append(unreferenced, footnote.ID)
+		}
+	}
+
+	return undefined, unreferenced
+}
+
+// Updates the notes, footnotes and content warnings sent with an edit, the ones left out keep their values.
+// Returns the stored title like SaveChapterFormat.
+func SaveChapterNotes(querier Querier, fictionID string, chapterID string, chapter models.ChapterModel) (string, error) {
+	query := "UPDATE Chapters SET "
+	params := []interface{}{}
+	paramIndex := 1
+	if chapter.Pre_Note != nil {
+		query += "Pre_Note = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, *chapter.Pre_Note)
+		paramIndex++
+	}
+
+	if chapter.Post_Note != nil {
+		query += "Post_Note = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, *chapter.Post_Note)
+		paramIndex++
+	}
+
+	if chapter.Footnotes != nil {
+		footnotes, err := json.Marshal(chapter.Footnotes)
+		if err != nil {
+			return "", err
+		}
+
+		query += "Footnotes = $" + strconv.Itoa(paramIndex) + "::JSONB, "
+		params = append(params, string(footnotes))
+		paramIndex++
+	}
+
+	if chapter.Content_Warnings != nil {
+		query += "Content_Warnings = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, pq.Array(chapter.Content_Warnings))
+		paramIndex++
+	}
+
+	if len(params) == 0 {
+		return "", ErrNoChapterChanges
+	}
+
+	query = strings.TrimSuffix(query, ", ") + " WHERE ID = $" + strconv.Itoa(paramIndex) + " AND Fiction_ID = $" + strconv.Itoa(paramIndex + 1) + " RETURNING Title"
+	params = append(params, chapterID, fictionID)
+
+	var storedTitle string
+	if err := querier.QueryRow(query, params...).Scan(&storedTitle); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrChapterNotFound
+		}
+
+		return "", err
+	}
+
+	return storedTitle, nil
+}
+
+// Only Content and Footnotes are filled in, enough to check the footnote markers of an edit
+func GetChapterFootnotesOf(fictionID string, chapterID string) (models.ChapterModel, error) {
+	chapter := models.ChapterModel{}
+	var footnotes []byte
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			COALESCE(Content, ''), Footnotes
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = $2
+		`,
+		fictionID,
+		chapterID,
+	).Scan(
+		&chapter.Content,
+		&footnotes,
+	)
+
+	if err != nil {
+		return chapter, err
+	}
+
+	chapter.Footnotes = []models.ChapterFootnoteModel{}
+	err = json.Unmarshal(footnotes, &chapter.Footnotes)
+	return chapter, err
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+func TestCheckFootnoteMarkers(t *testing.T) {
+	footnotes := func(IDs ...string) []models.ChapterFootnoteModel {
+		result := []models.ChapterFootnoteModel{}
+		for _, ID := range IDs {
+			result = append(result, models.ChapterFootnoteModel{ID: ID, Text: "Note " + ID})
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name             string
+		content          string
+		footnotes        []models.ChapterFootnoteModel
+		wantUndefined    []string
+		wantUnreferenced []string
+	}{
+		{
+			name:             "no markers or footnotes",
+			content:          "<p>Plain text</p>",
+			wantUndefined:    []string{},
+			wantUnreferenced: []string{},
+		},
+		{
+			name:             "every marker defined",
+			content:          "<p>One[^1] and two[^note-2]</p>",
+			footnotes:        footnotes("1", "note-2"),
+			wantUndefined:    []string{},
+			wantUnreferenced: []string{},
+		},
+		{
+			name:             "marker used twice",
+			content:          "<p>Here[^a], there[^a]</p>",
+			footnotes:        footnotes("a"),
+			wantUndefined:    []string{},
+			wantUnreferenced: []string{},
+		},
+		{
+			name:             "undefined markers listed once in order",
+			content:          "<p>[^z] then [^y] then [^z]</p>",
+			wantUndefined:    []string{"z", "y"},
+			wantUnreferenced: []string{},
+		},
+		{
+			name:             "unreferenced footnotes in order",
+			content:          "<p>Only [^b]</p>",
+			footnotes:        footnotes("c", "b", "a"),
+			wantUndefined:    []string{},
+			wantUnreferenced: []string{"c", "a"},
+		},
+		{
+			name:             "both problems",
+			content:          "<p>[^missing] and [^kept]</p>",
+			footnotes:        footnotes("kept", "orphan"),
+			wantUndefined:    []string{"missing"},
+			wantUnreferenced: []string{"orphan"},
+		},
+		{
+			name:             "invalid markers are plain text",
+			content:          "<p>[^] [^has space] [^toolongidentifier_123456]</p>",
+			wantUndefined:    []string{},
+			wantUnreferenced: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			undefined, unreferenced := CheckFootnoteMarkers(test.content, test.footnotes)
+			if !reflect.DeepEqual(undefined, test.wantUndefined) {
+				t.Fatalf("undefined = %q, want %q", undefined, test.wantUndefined)
+			}
+
+			if !reflect.DeepEqual(unreferenced, test.wantUnreferenced) {
+				t.Fatalf("unreferenced = %q, want %q", unreferenced, test.wantUnreferenced)
+			}
+		})
+	}
+}
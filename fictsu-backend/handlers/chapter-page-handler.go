@@ -0,0 +1,718 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"html"
+	"sort"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"net/http"
+	"archive/zip"
+	"database/sql"
+	"encoding/xml"
+	"path/filepath"
+	"mime/multipart"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	MAX_CHAPTER_PAGES    int   = 500
+	MAX_PAGE_IMAGE_SIZE  int64 = 10 << 20 // 10MB, same as the editor image upload
+	MAX_PAGE_UPLOAD_SIZE int64 = 200 << 20
+	MAX_PAGE_ALT_LENGTH  int   = 1000
+)
+
+// Archives are counted by the bytes actually decompressed, the sizes in the ZIP headers can lie
+const MAX_PAGE_UNCOMPRESSED_SIZE int64 = 300 << 20
+
+var ErrPageUploadTooLarge = errors.New("the images add up to more than " + strconv.FormatInt(MAX_PAGE_UNCOMPRESSED_SIZE >> 20, 10) + "MB")
+
+var ErrPageTooLarge = errors.New("page image is too large")
+
+var pageImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// A page waiting to be stored, read from a form file or an archive entry
+type pageUpload struct {
+	name        string
+	alt         string
+	data        []byte
+	contentType string
+}
+
+func GetChapterPages(ctx *gin.Context) {
+	pages, err := GetChapterPagesOf(ctx.Param("fictionID"), ctx.Param("chapterID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, pages)
+}
+
+// Appends pages to a page chapter. The multipart form takes "images" files, with an optional "alt" value per
+// image, and/or one "archive" ZIP or CBZ whose images are added in file name order.
+func UploadChapterPages(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to upload pages."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "upload pages to this fiction") || !CheckPageChapter(ctx, fictionID, chapterID) {
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MAX_PAGE_UPLOAD_SIZE)
+	if err := ctx.Request.ParseMultipartForm(32 << 20); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Could not parse form, uploads are limited to " + strconv.FormatInt(MAX_PAGE_UPLOAD_SIZE >> 20, 10) + "MB"})
+		return
+	}
+
+	uploads := []pageUpload{}
+	budget := MAX_PAGE_UNCOMPRESSED_SIZE
+	alts := ctx.Request.MultipartForm.Value["alt"]
+	for i, fileHeader := range ctx.Request.MultipartForm.File["images"] {
+		upload, err := ReadPageUpload(fileHeader)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": fileHeader.Filename + ": " + err.Error()})
+			return
+		}
+
+		if i < len(alts) {
+			upload.alt = strings.TrimSpace(alts[i])
+		}
+
+		budget -= int64(len(upload.data))
+		uploads = append(uploads, *upload)
+	}
+
+	for _, fileHeader := range ctx.Request.MultipartForm.File["archive"] {
+		archived, err := ReadPageArchive(fileHeader, &budget)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": fileHeader.Filename + ": " + err.Error()})
+			return
+		}
+
+		uploads = append(uploads, archived...)
+	}
+
+	if len(uploads) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No images found in request"})
+		return
+	}
+
+	// Either every page is saved or none is, images already uploaded for a failed batch are removed again
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to store pages"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	var pageCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM ChapterPages WHERE Fiction_ID = $1 AND Chapter_ID = $2", fictionID, chapterID).Scan(&pageCount); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	if pageCount + len(uploads) > MAX_CHAPTER_PAGES {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A chapter can have at most " + strconv.Itoa(MAX_CHAPTER_PAGES) + " pages"})
+		return
+	}
+
+	stored := []string{}
+	for i, upload := range uploads {
+		if len([]rune(upload.alt)) > MAX_PAGE_ALT_LENGTH {
+			upload.alt = string([]rune(upload.alt)[:MAX_PAGE_ALT_LENGTH])
+		}
+
+		path, err := SaveChapterPage(tx, fictionID, chapterID, pageCount + i + 1, upload)
+		if err != nil {
+			log.Printf("Error storing page %s of chapter %s of fiction %s: %v", upload.name, chapterID, fictionID, err)
+			DeletePageImages(stored)
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to store " + upload.name + ", no pages were saved"})
+			return
+		}
+
+		stored = append(stored, path)
+	}
+
+	if err := SyncChapterPagesContent(tx, fictionID, chapterID); err != nil || tx.Commit() != nil {
+		DeletePageImages(stored)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
+		return
+	}
+
+	pages, err := GetChapterPagesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, pages)
+}
+
+// Reorders the pages and updates their alt text, the body must list every page of the chapter once
+func EditChapterPages(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit pages."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit pages of this fiction") || !CheckPageChapter(ctx, fictionID, chapterID) {
+		return
+	}
+
+	pagesForm := models.ChapterPagesForm{}
+	if err := ctx.ShouldBindJSON(&pagesForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	pages, err := GetChapterPagesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	existing := map[int]bool{}
+	for _, page := range pages {
+		existing[page.ID] = true
+	}
+
+	for _, page := range pagesForm.Pages {
+		if !existing[page.ID] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Every page of the chapter must be listed exactly once"})
+			return
+		}
+
+		delete(existing, page.ID)
+		if len([]rune(page.Alt)) > MAX_PAGE_ALT_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Alt text must be at most " + strconv.Itoa(MAX_PAGE_ALT_LENGTH) + " characters"})
+			return
+		}
+	}
+
+	if len(existing) > 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Every page of the chapter must be listed exactly once"})
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update pages"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	for i, page := range pagesForm.Pages {
+		if _, err := tx.Exec("UPDATE ChapterPages SET Position = $1, Alt = $2 WHERE ID = $3", i + 1, strings.TrimSpace(page.Alt), page.ID); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update pages"})
+			return
+		}
+	}
+
+	if err := SyncChapterPagesContent(tx, fictionID, chapterID); err != nil || tx.Commit() != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update pages"})
+		return
+	}
+
+	pages, err = GetChapterPagesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, pages)
+}
+
+func DeleteChapterPage(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to delete pages."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "delete pages of this fiction") {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete page"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	var deletedID, deletedFictionID, position int
+	err = tx.QueryRow(
+		`
+		DELETE FROM ChapterPages
+		WHERE ID = $1 AND Fiction_ID = $2 AND Chapter_ID = $3
+		RETURNING ID, Fiction_ID, Position
+		`,
+		ctx.Param("pageID"),
+		fictionID,
+		chapterID,
+	).Scan(
+		&deletedID,
+		&deletedFictionID,
+		&position,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Page not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete page"})
+		}
+
+		return
+	}
+
+	_, err = tx.Exec(
+		`
+		UPDATE ChapterPages
+		SET Position = Position - 1
+		WHERE Fiction_ID = $1 AND Chapter_ID = $2 AND Position > $3
+		`,
+		fictionID,
+		chapterID,
+		position,
+	)
+
+	if err != nil || SyncChapterPagesContent(tx, fictionID, chapterID) != nil || tx.Commit() != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete page"})
+		return
+	}
+
+	if err := DeleteImageFromFirebase(ChapterPagePath(deletedFictionID, deletedID), configs.BucketName); err != nil {
+		log.Printf("Error deleting page image %d: %v", deletedID, err)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Page deleted"})
+}
+
+// Streams the pages as a CBZ, images are stored as they are since they are already compressed
+func DownloadChapterCBZ(ctx *gin.Context) {
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	var fictionTitle, chapterTitle string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			F.Title, C.Title
+		FROM
+			Chapters C
+		JOIN
+			Fictions F
+		ON
+			F.ID = C.Fiction_ID
+		WHERE
+			C.Fiction_ID = $1 AND C.ID = $2 AND C.Format = 'pages'
+		`,
+		fictionID,
+		chapterID,
+	).Scan(
+		&fictionTitle,
+		&chapterTitle,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Page chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return
+	}
+
+	pages, err := GetChapterPagesOf(fictionID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch pages"})
+		return
+	}
+
+	if len(pages) == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "The chapter has no pages"})
+		return
+	}
+
+	comicInfo, err := xml.MarshalIndent(struct {
+		XMLName   xml.Name `xml:"ComicInfo"`
+		Title     string   `xml:"Title"`
+		Series    string   `xml:"Series"`
+		Number    string   `xml:"Number"`
+		PageCount int      `xml:"PageCount"`
+	}{
+		Title:     chapterTitle,
+		Series:    fictionTitle,
+		Number:    chapterID,
+		PageCount: len(pages),
+	}, "", "    ")
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to build archive"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", "attachment; filename=\"fictsu-" + fictionID + "-" + chapterID + ".cbz\"")
+	ctx.Header("Content-Type", "application/vnd.comicbook+zip")
+	ctx.Status(http.StatusOK)
+
+	// The status is already sent, a failure past this point can only cut the archive short
+	writer := zip.NewWriter(ctx.Writer)
+	defer writer.Close()
+
+	for _, page := range pages {
+		image, contentType, err := DownloadImageFromFirebase(ChapterPagePath(page.Fiction_ID, page.ID), configs.BucketName)
+		if err != nil {
+			log.Printf("Error downloading page %d for CBZ: %v", page.ID, err)
+			return
+		}
+
+		name := PageFileName(page.Position, contentType)
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: page.Created})
+		if err != nil {
+			return
+		}
+
+		if _, err := file.Write(image); err != nil {
+			return
+		}
+	}
+
+	if file, err := writer.Create("ComicInfo.xml"); err == nil {
+		file.Write(append([]byte(xml.Header), comicInfo...))
+	}
+}
+
+// Writes the error response itself when the chapter does not exist or is not a page chapter
+func CheckPageChapter(ctx *gin.Context, fictionID string, chapterID string) bool {
+	var format models.ChapterFormat
+	err := db.DB.QueryRow("SELECT Format FROM Chapters WHERE Fiction_ID = $1 AND ID = $2", fictionID, chapterID).Scan(&format)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return false
+	}
+
+	if format != models.ChapterPages {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "Only page chapters have pages, set the chapter format to pages first"})
+		return false
+	}
+
+	return true
+}
+
+func ReadPageUpload(fileHeader *multipart.FileHeader) (*pageUpload, error) {
+	if fileHeader.Size > MAX_PAGE_IMAGE_SIZE {
+		return nil, ErrPageTooLarge
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ReadPageImage(fileHeader.Filename, file)
+}
+
+// Images inside the archive are taken in natural file name order, so 2.jpg comes before 10.jpg.
+// Folders are flattened and anything that is not an image is skipped. Budget is what is left of the
+// request's uncompressed allowance, it is reduced by every image read so a ZIP bomb stops early.
+func ReadPageArchive(fileHeader *multipart.FileHeader, budget *int64) ([]pageUpload, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, fileHeader.Size)
+	if err != nil {
+		return nil, errors.New("not a valid ZIP or CBZ archive")
+	}
+
+	entries := []*zip.File{}
+	for _, entry := range archive.File {
+		base := filepath.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+
+		if !IsPageImageName(base) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) > MAX_CHAPTER_PAGES {
+		return nil, errors.New("the archive has more than " + strconv.Itoa(MAX_CHAPTER_PAGES) + " images")
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return NaturalLess(strings.ToLower(entries[i].Name), strings.ToLower(entries[j].Name))
+	})
+
+	uploads := []pageUpload{}
+	for _, entry := range entries {
+		if entry.UncompressedSize64 > uint64(MAX_PAGE_IMAGE_SIZE) {
+			return nil, errors.New(entry.Name + ": " + ErrPageTooLarge.Error())
+		}
+
+		reader, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		upload, err := ReadPageImage(filepath.Base(entry.Name), reader)
+		reader.Close()
+		if err != nil {
+			return nil, errors.New(entry.Name + ": " + err.Error())
+		}
+
+		if *budget -= int64(len(upload.data)); *budget < 0 {
+			return nil, ErrPageUploadTooLarge
+		}
+
+		uploads = append(uploads, *upload)
+	}
+
+	return uploads, nil
+}
+
+// The type is sniffed from the bytes, the extension alone is not trusted
+func ReadPageImage(name string, reader io.Reader) (*pageUpload, error) {
+	if !IsPageImageName(name) {
+		return nil, errors.New("unsupported file type")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, MAX_PAGE_IMAGE_SIZE + 1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > MAX_PAGE_IMAGE_SIZE {
+		return nil, ErrPageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := pageImageExtensions[contentType]; !ok {
+		return nil, errors.New("the file is not a JPEG, PNG, GIF or WebP image")
+	}
+
+	return &pageUpload{name: name, data: data, contentType: contentType}, nil
+}
+
+// Same extensions as UploadChapterImage
+func IsPageImageName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".webp"
+}
+
+// Inserts the row first so the storage path can use the page ID, the caller rolls the row back if the upload fails.
+// Returns the storage path so the caller can remove the image when the rest of the batch fails.
+func SaveChapterPage(tx *sql.Tx, fictionID string, chapterID string, position int, upload pageUpload) (string, error) {
+	var pageID, pageFictionID int
+	err := tx.QueryRow(
+		`
+		INSERT INTO ChapterPages (Fiction_ID, Chapter_ID, Position, Alt)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ID, Fiction_ID
+		`,
+		fictionID,
+		chapterID,
+		position,
+		upload.alt,
+	).Scan(
+		&pageID,
+		&pageFictionID,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	path := ChapterPagePath(pageFictionID, pageID)
+	ref, err := UploadBytesToFirebase(bytes.NewReader(upload.data), upload.contentType, path, configs.BucketName)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec("UPDATE ChapterPages SET Ref = $1 WHERE ID = $2", ref, pageID); err != nil {
+		return path, err
+	}
+
+	return path, nil
+}
+
+// Best effort, like the cleanup in DeleteChapter
+func DeletePageImages(paths []string) {
+	go func() {
+		for _, path := range paths {
+			if err := DeleteImageFromFirebase(path, configs.BucketName); err != nil {
+				log.Printf("Error deleting page image %s: %v", path, err)
+			}
+		}
+	}()
+}
+
+// Keeps Content in sync with the pages as images, so readers and tools that only know text chapters still show them
+func SyncChapterPagesContent(querier Querier, fictionID string, chapterID string) error {
+	pages, err := QueryChapterPages(querier, fictionID, chapterID)
+	if err != nil {
+		return err
+	}
+
+	content := strings.Builder{}
+	for _, page := range pages {
+		content.WriteString(`<p><img src="` + html.EscapeString(page.Ref) + `" alt="` + html.EscapeString(page.Alt) + `"></p>`)
+	}
+
+	_, err = querier.Exec("UPDATE Chapters SET Content = $1 WHERE Fiction_ID = $2 AND ID = $3", content.String(), fictionID, chapterID)
+	return err
+}
+
+func GetChapterPagesOf(fictionID string, chapterID interface{}) ([]models.ChapterPageModel, error) {
+	return QueryChapterPages(db.DB, fictionID, chapterID)
+}
+
+func QueryChapterPages(querier Querier, fictionID string, chapterID interface{}) ([]models.ChapterPageModel, error) {
+	rows, err := querier.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Chapter_ID, Position, Ref, Alt, Created
+		FROM
+			ChapterPages
+		WHERE
+			Fiction_ID = $1 AND Chapter_ID = $2
+		ORDER BY Position, ID
+		`,
+		fictionID,
+		chapterID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	pages := []models.ChapterPageModel{}
+	for rows.Next() {
+		page := models.ChapterPageModel{}
+		if err := rows.Scan(
+			&page.ID,
+			&page.Fiction_ID,
+			&page.Chapter_ID,
+			&page.Position,
+			&page.Ref,
+			&page.Alt,
+			&page.Created,
+		); err != nil {
+			return nil, err
+		}
+
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
+
+// Zero padded so every reader sorts the pages right
+func PageFileName(position int, contentType string) string {
+	ext, ok := pageImageExtensions[contentType]
+	if !ok {
+		ext = ".jpg"
+	}
+
+	name := strconv.Itoa(position)
+	for len(name) < 3 {
+		name = "0" + name
+	}
+
+	return name + ext
+}
+
+// Compares runs of digits by their value, "page2" < "page10"
+func NaturalLess(a string, b string) bool {
+	for a != "" && b != "" {
+		aDigits := len(a) - len(strings.TrimLeft(a, "0123456789"))
+		bDigits := len(b) - len(strings.TrimLeft(b, "0123456789"))
+		if aDigits > 0 && bDigits > 0 {
+			aNumber := strings.TrimLeft(a[:aDigits], "0")
+			bNumber := strings.TrimLeft(b[:bDigits], "0")
+			if len(aNumber) != len(bNumber) {
+				return len(aNumber) < len(bNumber)
+			}
+
+			if aNumber != bNumber {
+				return aNumber < bNumber
+			}
+
+			a, b = a[aDigits:], b[bDigits:]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) < len(b)
+}
+
+func ChapterPagePath(fictionID int, pageID int) string {
+	return configs.PageImagePath + strconv.Itoa(fictionID) + "/" + strconv.Itoa(pageID)
+}
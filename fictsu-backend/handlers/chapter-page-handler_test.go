@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"sort"
+	"reflect"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{a: "page2", b: "page10", want: true},
+		{a: "page10", b: "page2", want: false},
+		{a: "page1", b: "page1", want: false},
+		{a: "page01", b: "page1", want: false},
+		{a: "page1", b: "page01", want: false},
+		{a: "page009", b: "page10", want: true},
+		{a: "a", b: "b", want: true},
+		{a: "page", b: "page1", want: true},
+		{a: "page1", b: "page", want: false},
+		{a: "1.png", b: "1a.png", want: true},
+		{a: "vol2/page9", b: "vol10/page1", want: true},
+		{a: "99999999999999999999", b: "100000000000000000000", want: true},
+		{a: "", b: "", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a + " < " + test.b, func(t *testing.T) {
+			if got := NaturalLess(test.a, test.b); got != test.want {
+				t.Fatalf("NaturalLess(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNaturalLessSortsArchivePages(t *testing.T) {
+	names := []string{"p10.png", "p2.png", "p1.png", "cover.png", "p11.png", "p02b.png"}
+	sort.SliceStable(names, func(i int, j int) bool {
+		return NaturalLess(names[i], names[j])
+	})
+
+	want := []string{"cover.png", "p1.png", "p2.png", "p02b.png", "p10.png", "p11.png"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+}
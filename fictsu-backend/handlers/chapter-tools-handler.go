@@ -0,0 +1,719 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"net/http"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	llm "github.com/Fictsu/Fictsu/llm"
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	INTRO_RECAP string = `You write the "previously on" recap shown at the top of a new chapter of a web novel.
+	Summarize the chapters below in one to three short paragraphs, in the past tense and in the voice of a narrator.
+	Only mention what happened in the given chapters and do not invent new events. Reply with the recap only.`
+
+	INTRO_PROOFREAD string = `You are a careful copy editor. Proofread the chapter below for grammar, spelling, punctuation and awkward style.
+	Do not rewrite the chapter and do not change the author's voice. The chapter is HTML, never change the tags.
+	Respond with a JSON object of the form {"edits": [{"original": "...", "replacement": "...", "reason": "..."}]}.
+	Each original must be a short excerpt copied exactly from the chapter text without any HTML tags, list the edits in the order they appear.
+	Return {"edits": []} if nothing needs fixing.`
+
+	INTRO_CONTINUE string = `You are helping an author write their web novel. Continue the chapter exactly where it stops,
+	keeping its voice, tense, point of view and pacing. Do not repeat the existing text, do not add a title or commentary.
+	Separate paragraphs with a blank line.`
+
+	DEFAULT_RECAP_CHAPTERS     int = 3
+	MAX_RECAP_CHAPTERS         int = 10
+	MAX_CONTINUE_INSTRUCTIONS  int = 2000
+	RECAP_REPLY_TOKENS         int = 800
+	PROOFREAD_REPLY_TOKENS     int = 4096
+	CONTINUE_REPLY_TOKENS      int = 1500
+)
+
+var (
+	ErrNoChapterEditsSelected = fmt.Errorf("no edits selected")
+	ErrChapterEditNotFound    = fmt.Errorf("edit not found")
+)
+
+// Owner check and chapter lookup shared by the chapter tools, writes the error response itself when it returns false
+func PrepareChapterTool(ctx *gin.Context, action string) (int, int, string, bool) {
+	fictionID, errFiction := strconv.Atoi(ctx.Param("fictionID"))
+	chapterID, errChapter := strconv.Atoi(ctx.Param("chapterID"))
+	if errFiction != nil || errChapter != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction or chapter ID"})
+		return 0, 0, "", false
+	}
+
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), ctx.GetInt("ai_user_ID"), action) {
+		return 0, 0, "", false
+	}
+
+	content, err := GetChapterContent(fictionID, chapterID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return 0, 0, "", false
+	}
+
+	return fictionID, chapterID, content, true
+}
+
+func GetChapterContent(fictionID int, chapterID int) (string, error) {
+	var content string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			COALESCE(Content, '')
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = $2
+		`,
+		fictionID,
+		chapterID,
+	).Scan(
+		&content,
+	)
+
+	return content, err
+}
+
+// Recaps the chapters right before this one, accepting it puts the recap at the top of the chapter
+func OpenAIRecapChapters(ctx *gin.Context) {
+	fictionID, chapterID, content, ok := PrepareChapterTool(ctx, "use AI tools on this fiction")
+	if !ok {
+		return
+	}
+
+	recapForm := models.ChapterRecapForm{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&recapForm); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+			return
+		}
+	}
+
+	if recapForm.Chapters == 0 {
+		recapForm.Chapters = DEFAULT_RECAP_CHAPTERS
+	}
+
+	if recapForm.Chapters < 1 || recapForm.Chapters > MAX_RECAP_CHAPTERS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Chapters must be between 1 and " + strconv.Itoa(MAX_RECAP_CHAPTERS)})
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID < $2
+		ORDER BY ID DESC
+		LIMIT $3
+		`,
+		fictionID,
+		chapterID,
+		recapForm.Chapters,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapters"})
+		return
+	}
+
+	defer rows.Close()
+	chapterIDs := []int64{}
+	for rows.Next() {
+		var previousID int64
+		if err := rows.Scan(&previousID); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing chapters"})
+			return
+		}
+
+		chapterIDs = append(chapterIDs, previousID)
+	}
+
+	if len(chapterIDs) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "There are no earlier chapters to recap"})
+		return
+	}
+
+	fictionContext, err := BuildFictionContext(fictionID, chapterIDs, configs.AssistantContextTokens - RECAP_REPLY_TOKENS)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapters"})
+		return
+	}
+
+	response, ok := SendChapterToolRequest(ctx, models.AIFeatureRecap, llm.ChatRequest{
+		Model: configs.ChapterToolsModel,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: INTRO_RECAP},
+			{Role: llm.RoleUser, Content: fictionContext},
+		},
+		Max_Tokens: RECAP_REPLY_TOKENS,
+	})
+
+	if !ok {
+		return
+	}
+
+	suggestion := models.ChapterSuggestionModel{
+		Kind:    models.ChapterSuggestionRecap,
+		Content: "<blockquote>" + ParagraphsToHTML(response.Content) + "</blockquote>",
+	}
+
+	SaveChapterSuggestion(ctx, fictionID, chapterID, content, &suggestion)
+}
+
+// Returns the proofreading pass as separate edits so the author can pick which ones to apply
+func OpenAIProofreadChapter(ctx *gin.Context) {
+	fictionID, chapterID, content, ok := PrepareChapterTool(ctx, "use AI tools on this fiction")
+	if !ok {
+		return
+	}
+
+	if strings.TrimSpace(StripHTML(content)) == "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "The chapter is empty"})
+		return
+	}
+
+	if llm.EstimateTokens(content) > configs.AssistantContextTokens - PROOFREAD_REPLY_TOKENS {
+		ctx.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"Error": "The chapter is too long to proofread at once"})
+		return
+	}
+
+	temperature := 0.2
+	response, ok := SendChapterToolRequest(ctx, models.AIFeatureProofread, llm.ChatRequest{
+		Model: configs.ChapterToolsModel,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: INTRO_PROOFREAD},
+			{Role: llm.RoleUser, Content: content},
+		},
+		Temperature: &temperature,
+		Max_Tokens: PROOFREAD_REPLY_TOKENS,
+		JSON: true,
+	})
+
+	if !ok {
+		return
+	}
+
+	edits, err := LocateChapterEdits(content, response.Content)
+	if err != nil {
+		log.Printf("Error parsing proofreading result: %v", err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "The AI provider returned an invalid proofreading result"})
+		return
+	}
+
+	suggestion := models.ChapterSuggestionModel{
+		Kind:  models.ChapterSuggestionProofread,
+		Edits: edits,
+	}
+
+	SaveChapterSuggestion(ctx, fictionID, chapterID, content, &suggestion)
+}
+
+// Drafts the next part of the chapter, accepting it appends the draft
+func OpenAIContinueChapter(ctx *gin.Context) {
+	fictionID, chapterID, content, ok := PrepareChapterTool(ctx, "use AI tools on this fiction")
+	if !ok {
+		return
+	}
+
+	continueForm := models.ChapterContinueForm{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&continueForm); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+			return
+		}
+	}
+
+	continueForm.Instructions = strings.TrimSpace(continueForm.Instructions)
+	if len(continueForm.Instructions) > MAX_CONTINUE_INSTRUCTIONS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Instructions must be at most " + strconv.Itoa(MAX_CONTINUE_INSTRUCTIONS) + " characters"})
+		return
+	}
+
+	budget := configs.AssistantContextTokens - CONTINUE_REPLY_TOKENS - llm.EstimateTokens(continueForm.Instructions)
+
+	// The fiction may take at most a quarter of the budget, the end of the chapter matters more
+	fictionContext, err := BuildFictionContext(fictionID, nil, budget / 4)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve fiction"})
+		return
+	}
+
+	budget -= llm.EstimateTokens(fictionContext)
+
+	text := StripHTML(content)
+	if maxLength := budget * 4; len(text) > maxLength {
+		text = strings.ToValidUTF8(text[len(text) - maxLength:], "")
+	}
+
+	userPrompt := "The chapter so far:\n\n" + text
+	if continueForm.Instructions != "" {
+		userPrompt += "\n\nThe author's instructions for what comes next: " + continueForm.Instructions
+	}
+
+	response, ok := SendChapterToolRequest(ctx, models.AIFeatureContinue, llm.ChatRequest{
+		Model: configs.ChapterToolsModel,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: INTRO_CONTINUE + "\n\n" + fictionContext},
+			{Role: llm.RoleUser, Content: userPrompt},
+		},
+		Max_Tokens: CONTINUE_REPLY_TOKENS,
+	})
+
+	if !ok {
+		return
+	}
+
+	suggestion := models.ChapterSuggestionModel{
+		Kind:    models.ChapterSuggestionContinue,
+		Content: ParagraphsToHTML(response.Content),
+	}
+
+	SaveChapterSuggestion(ctx, fictionID, chapterID, content, &suggestion)
+}
+
+func SendChapterToolRequest(ctx *gin.Context, feature models.AIFeature, request llm.ChatRequest) (*llm.ChatResponse, bool) {
+	response, err := llm.Client.Chat(ctx.Request.Context(), request)
+	if err != nil {
+		log.Printf("Error running chapter tool %s: %v", feature, err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "Failed to get a response from the AI provider"})
+		return nil, false
+	}
+
+	RecordAIUsage(
+		ctx.GetInt("ai_user_ID"),
+		feature,
+		response.Model,
+		response.Usage.Prompt_Tokens,
+		response.Usage.Completion_Tokens,
+		0,
+	)
+
+	return response, true
+}
+
+// Stores the suggestion as pending and answers with it, the content hash lets accepting detect later edits
+func SaveChapterSuggestion(ctx *gin.Context, fictionID int, chapterID int, content string, suggestion *models.ChapterSuggestionModel) {
+	suggestion.Fiction_ID = fictionID
+	suggestion.Chapter_ID = chapterID
+	suggestion.User_ID = ctx.GetInt("ai_user_ID")
+	suggestion.Status = models.ChapterSuggestionPending
+	suggestion.Source_Hash = HashChapterContent(content)
+
+	var JSONEdits interface{}
+	if suggestion.Edits != nil {
+		encoded, err := json.Marshal(suggestion.Edits)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save suggestion"})
+			return
+		}
+
+		JSONEdits = string(encoded)
+	}
+
+	err := db.DB.QueryRow(
+		`
+		INSERT INTO ChapterSuggestions (Fiction_ID, Chapter_ID, User_ID, Kind, Content, Edits, Source_Hash)
+		VALUES ($1, $2, $3, $4, $5, $6::JSONB, $7)
+		RETURNING ID, Created, Updated
+		`,
+		suggestion.Fiction_ID,
+		suggestion.Chapter_ID,
+		suggestion.User_ID,
+		suggestion.Kind,
+		suggestion.Content,
+		JSONEdits,
+		suggestion.Source_Hash,
+	).Scan(
+		&suggestion.ID,
+		&suggestion.Created,
+		&suggestion.Updated,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save suggestion"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, suggestion)
+}
+
+// Finds each excerpt in the chapter in order and turns it into offsets.
+// Edits that cannot be found, overlap an earlier one or touch the markup are dropped.
+func LocateChapterEdits(content string, result string) ([]models.ChapterEdit, error) {
+	proofread := struct {
+		Edits []struct {
+			Original    string `json:"original"`
+			Replacement string `json:"replacement"`
+			Reason      string `json:"reason"`
+		} `json:"edits"`
+	}{}
+
+	if err := json.Unmarshal([]byte(result), &proofread); err != nil {
+		return nil, err
+	}
+
+	edits := []models.ChapterEdit{}
+	cursor := 0
+	for _, proposed := range proofread.Edits {
+		if proposed.Original == "" || proposed.Original == proposed.Replacement {
+			continue
+		}
+
+		if strings.ContainsAny(proposed.Original + proposed.Replacement, "<>") {
+			continue
+		}
+
+		start := FindInChapterText(content, proposed.Original, cursor)
+		if start == -1 {
+			continue
+		}
+
+		edits = append(edits, models.ChapterEdit{
+			Index:       len(edits),
+			Start:       start,
+			End:         start + len(proposed.Original),
+			Original:    proposed.Original,
+			Replacement: proposed.Replacement,
+			Reason:      proposed.Reason,
+		})
+
+		cursor = start + len(proposed.Original)
+	}
+
+	return edits, nil
+}
+
+// Like strings.Index from the cursor on, but skips matches inside a tag such as an alt attribute
+func FindInChapterText(content string, excerpt string, cursor int) int {
+	for cursor <= len(content) {
+		offset := strings.Index(content[cursor:], excerpt)
+		if offset == -1 {
+			return -1
+		}
+
+		start := cursor + offset
+		if strings.LastIndex(content[:start], "<") <= strings.LastIndex(content[:start], ">") {
+			return start
+		}
+
+		cursor = start + 1
+	}
+
+	return -1
+}
+
+// ?status= narrows the list down to pending, accepted or rejected suggestions
+func GetChapterSuggestions(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view suggestions."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view suggestions of this fiction") {
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Chapter_ID, User_ID, Kind, Status, Content, Edits, Source_Hash, Created, Updated
+		FROM
+			ChapterSuggestions
+		WHERE
+			Fiction_ID = $1 AND Chapter_ID = $2 AND ($3 = '' OR Status = $3)
+		ORDER BY ID DESC
+		`,
+		fictionID,
+		ctx.Param("chapterID"),
+		ctx.Query("status"),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch suggestions"})
+		return
+	}
+
+	defer rows.Close()
+	suggestions := []models.ChapterSuggestionModel{}
+	for rows.Next() {
+		suggestion, err := ScanChapterSuggestion(rows)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing suggestions"})
+			return
+		}
+
+		suggestions = append(suggestions, *suggestion)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, suggestions)
+}
+
+// Applies the suggestion to the chapter through SaveChapterUpdate, the same way EditChapter saves
+func AcceptChapterSuggestion(ctx *gin.Context, store sessions.Store) {
+	suggestion, ok := GetPendingChapterSuggestion(ctx, store)
+	if !ok {
+		return
+	}
+
+	decisionForm := models.ChapterSuggestionDecisionForm{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&decisionForm); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+			return
+		}
+	}
+
+	content, err := GetChapterContent(suggestion.Fiction_ID, suggestion.Chapter_ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return
+	}
+
+	text := suggestion.Content
+	if decisionForm.Content != nil {
+		text = *decisionForm.Content
+	}
+
+	switch suggestion.Kind {
+	case models.ChapterSuggestionRecap:
+		content = text + content
+	case models.ChapterSuggestionContinue:
+		content = content + text
+	case models.ChapterSuggestionProofread:
+		// The offsets only hold for the content the chapter had when it was proofread
+		if HashChapterContent(content) != suggestion.Source_Hash {
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The chapter changed since it was proofread. Please proofread it again."})
+			return
+		}
+
+		edits, err := SelectChapterEdits(suggestion.Edits, decisionForm.Edits)
+		if err != nil {
+			if err == ErrNoChapterEditsSelected {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No edits selected, reject the suggestion instead"})
+			} else {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid edit index"})
+			}
+
+			return
+		}
+
+		content = ApplyChapterEdits(content, edits)
+	}
+
+	if err := SaveChapterUpdate(strconv.Itoa(suggestion.Fiction_ID), strconv.Itoa(suggestion.Chapter_ID), "", content); err != nil {
+		switch err {
+		case ErrNoChapterChanges:
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "The suggestion leaves the chapter empty"})
+		case ErrChapterNotFound:
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		default:
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
+		}
+
+		return
+	}
+
+	UpdateChapterSuggestionStatus(suggestion.ID, models.ChapterSuggestionAccepted)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Suggestion applied", "Content": content})
+}
+
+func RejectChapterSuggestion(ctx *gin.Context, store sessions.Store) {
+	suggestion, ok := GetPendingChapterSuggestion(ctx, store)
+	if !ok {
+		return
+	}
+
+	UpdateChapterSuggestionStatus(suggestion.ID, models.ChapterSuggestionRejected)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Suggestion rejected"})
+}
+
+// Session, owner check and lookup for accepting or rejecting, writes the error response itself when it returns false
+func GetPendingChapterSuggestion(ctx *gin.Context, store sessions.Store) (*models.ChapterSuggestionModel, bool) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return nil, false
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit a chapter."})
+		return nil, false
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit chapters of this fiction") {
+		return nil, false
+	}
+
+	row := db.DB.QueryRow(
+		`
+		SELECT
+			ID, Fiction_ID, Chapter_ID, User_ID, Kind, Status, Content, Edits, Source_Hash, Created, Updated
+		FROM
+			ChapterSuggestions
+		WHERE
+			ID = $1 AND Fiction_ID = $2 AND Chapter_ID = $3
+		`,
+		ctx.Param("suggestionID"),
+		fictionID,
+		ctx.Param("chapterID"),
+	)
+
+	suggestion, err := ScanChapterSuggestion(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Suggestion not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch suggestion"})
+		}
+
+		return nil, false
+	}
+
+	if suggestion.Status != models.ChapterSuggestionPending {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The suggestion was already " + string(suggestion.Status)})
+		return nil, false
+	}
+
+	return suggestion, true
+}
+
+func ScanChapterSuggestion(row interface{ Scan(...interface{}) error }) (*models.ChapterSuggestionModel, error) {
+	suggestion := models.ChapterSuggestionModel{}
+	var edits []byte
+	if err := row.Scan(
+		&suggestion.ID,
+		&suggestion.Fiction_ID,
+		&suggestion.Chapter_ID,
+		&suggestion.User_ID,
+		&suggestion.Kind,
+		&suggestion.Status,
+		&suggestion.Content,
+		&edits,
+		&suggestion.Source_Hash,
+		&suggestion.Created,
+		&suggestion.Updated,
+	); err != nil {
+		return nil, err
+	}
+
+	if edits != nil {
+		if err := json.Unmarshal(edits, &suggestion.Edits); err != nil {
+			return nil, err
+		}
+	}
+
+	return &suggestion, nil
+}
+
+func UpdateChapterSuggestionStatus(suggestionID int, status models.ChapterSuggestionStatus) {
+	_, err := db.DB.Exec(
+		`
+		UPDATE ChapterSuggestions
+		SET Status = $1, Updated = NOW()
+		WHERE ID = $2
+		`,
+		status,
+		suggestionID,
+	)
+
+	if err != nil {
+		log.Printf("Error updating chapter suggestion %d: %v", suggestionID, err)
+	}
+}
+
+// A nil selection keeps every edit, otherwise only the listed indexes
+func SelectChapterEdits(edits []models.ChapterEdit, selected []int) ([]models.ChapterEdit, error) {
+	if selected == nil {
+		return edits, nil
+	}
+
+	if len(selected) == 0 {
+		return nil, ErrNoChapterEditsSelected
+	}
+
+	chosen := []models.ChapterEdit{}
+	seen := map[int]bool{}
+	for _, index := range selected {
+		if index < 0 || index >= len(edits) {
+			return nil, ErrChapterEditNotFound
+		}
+
+		if !seen[index] {
+			seen[index] = true
+			chosen = append(chosen, edits[index])
+		}
+	}
+
+	return chosen, nil
+}
+
+// Applies the edits back to front so the offsets of the remaining ones stay valid
+func ApplyChapterEdits(content string, edits []models.ChapterEdit) string {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Start > edits[j].Start
+	})
+
+	for _, edit := range edits {
+		content = content[:edit.Start] + edit.Replacement + content[edit.End:]
+	}
+
+	return content
+}
+
+// Plain model output to HTML paragraphs, blank lines or single newlines both start a new paragraph
+func ParagraphsToHTML(text string) string {
+	paragraphs := strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			paragraphs.WriteString("<p>" + html.EscapeString(line) + "</p>")
+		}
+	}
+
+	return paragraphs.String()
+}
+
+func HashChapterContent(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
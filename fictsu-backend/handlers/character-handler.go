@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"net/http"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+func GetCharacterImages(ctx *gin.Context) {
+	fictionID := ctx.Param("fictionID")
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			Fiction_ID, ID, Name, Ref, Prompt, Created
+		FROM
+			CharacterImage
+		WHERE
+			Fiction_ID = $1
+		ORDER BY ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch characters"})
+		return
+	}
+
+	defer rows.Close()
+	characters := []models.CharacterImageModel{}
+	for rows.Next() {
+		character := models.CharacterImageModel{}
+		if err := rows.Scan(
+			&character.Fiction_ID,
+			&character.ID,
+			&character.Name,
+			&character.Ref,
+			&character.Prompt,
+			&character.Created,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing characters"})
+			return
+		}
+
+		characters = append(characters, character)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, characters)
+}
+
+func DeleteCharacterImage(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to delete characters."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "delete characters of this fiction") {
+		return
+	}
+
+	var deletedFictionID int
+	var deletedID int
+	err := db.DB.QueryRow(
+		`
+		DELETE FROM CharacterImage
+		WHERE Fiction_ID = $1 AND ID = $2
+		RETURNING Fiction_ID, ID
+		`,
+		fictionID,
+		ctx.Param("characterID"),
+	).Scan(
+		&deletedFictionID,
+		&deletedID,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Character not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete character"})
+		}
+
+		return
+	}
+
+	// The row is gone either way, a leftover file only costs storage
+	if err := DeleteImageFromFirebase(CharacterImagePath(deletedFictionID, deletedID), configs.BucketName); err != nil {
+		log.Printf("Error deleting character image: %v", err)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Character deleted"})
+}
+
+func CharacterImagePath(fictionID int, characterID int) string {
+	return configs.CharImagePath + strconv.Itoa(fictionID) + "/" + strconv.Itoa(characterID)
+}
@@ -0,0 +1,719 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"net/url"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_CODEX_NAME_LENGTH        int = 255
+	MAX_CODEX_ALIASES            int = 20
+	MAX_CODEX_DESCRIPTION_LENGTH int = 20000
+	MAX_CODEX_FIELDS             int = 30
+	MAX_CODEX_FIELD_NAME_LENGTH  int = 100
+	MAX_CODEX_FIELD_LENGTH       int = 2000
+	MAX_CODEX_IMAGE_URL_LENGTH   int = 2048
+	MAX_CODEX_RELATION_LENGTH    int = 100
+
+	// Passed as the reader's chapter to see every entry, spoilers included
+	CODEX_REVEAL_ALL int = -1
+)
+
+var codexEntryTypes = map[models.CodexEntryType]bool{
+	models.CodexCharacter: true,
+	models.CodexLocation:  true,
+	models.CodexFaction:   true,
+	models.CodexItem:      true,
+	models.CodexLore:      true,
+}
+
+// ?type= filters by entry type, ?chapter= is how far the reader got so entries revealed later stay hidden.
+// The owner always sees every entry.
+func GetCodex(ctx *gin.Context, store sessions.Store) {
+	fictionID := ctx.Param("fictionID")
+	revealedUntil, ok := GetCodexRevealedUntil(ctx, store, fictionID)
+	if !ok {
+		return
+	}
+
+	entryType := models.CodexEntryType(ctx.Query("type"))
+	if entryType != "" && !codexEntryTypes[entryType] {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown codex entry type"})
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Type, Name, Aliases, Description, Image, Fields, Reveal_Chapter, Created, Updated
+		FROM
+			CodexEntries
+		WHERE
+			Fiction_ID = $1 AND ($2 = '' OR Type = $2) AND ($3 < 0 OR Reveal_Chapter IS NULL OR Reveal_Chapter <= $3)
+		ORDER BY Type, Name
+		`,
+		fictionID,
+		entryType,
+		revealedUntil,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch codex"})
+		return
+	}
+
+	defer rows.Close()
+	entries := []models.CodexEntryModel{}
+	for rows.Next() {
+		entry, err := ScanCodexEntry(rows)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing codex"})
+			return
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, entries)
+}
+
+// Same spoiler rules as GetCodex, relations only show when the relation and the other entry are both revealed
+func GetCodexEntry(ctx *gin.Context, store sessions.Store) {
+	fictionID := ctx.Param("fictionID")
+	revealedUntil, ok := GetCodexRevealedUntil(ctx, store, fictionID)
+	if !ok {
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		SELECT
+			ID, Fiction_ID, Type, Name, Aliases, Description, Image, Fields, Reveal_Chapter, Created, Updated
+		FROM
+			CodexEntries
+		WHERE
+			Fiction_ID = $1 AND ID = $2 AND ($3 < 0 OR Reveal_Chapter IS NULL OR Reveal_Chapter <= $3)
+		`,
+		fictionID,
+		ctx.Param("entryID"),
+		revealedUntil,
+	)
+
+	entry, err := ScanCodexEntry(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Codex entry not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch codex entry"})
+		}
+
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			R.ID, R.From_ID, R.To_ID, E.Name, R.Kind, R.Reveal_Chapter
+		FROM
+			CodexRelations R
+		JOIN
+			CodexEntries E
+		ON
+			E.ID = R.To_ID
+		WHERE
+			R.From_ID = $1
+			AND ($2 < 0 OR R.Reveal_Chapter IS NULL OR R.Reveal_Chapter <= $2)
+			AND ($2 < 0 OR E.Reveal_Chapter IS NULL OR E.Reveal_Chapter <= $2)
+		ORDER BY R.Kind, E.Name
+		`,
+		entry.ID,
+		revealedUntil,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch codex relations"})
+		return
+	}
+
+	defer rows.Close()
+	entry.Relations = []models.CodexRelationModel{}
+	for rows.Next() {
+		relation := models.CodexRelationModel{}
+		var revealChapter sql.NullInt64
+		if err := rows.Scan(
+			&relation.ID,
+			&relation.From_ID,
+			&relation.To_ID,
+			&relation.To_Name,
+			&relation.Kind,
+			&revealChapter,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing codex relations"})
+			return
+		}
+
+		relation.Reveal_Chapter = NullableInt(revealChapter)
+		entry.Relations = append(entry.Relations, relation)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, entry)
+}
+
+func CreateCodexEntry(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the codex."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the codex of this fiction") {
+		return
+	}
+
+	entryForm, fields, ok := BindCodexEntry(ctx)
+	if !ok {
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		INSERT INTO CodexEntries (Fiction_ID, Type, Name, Aliases, Description, Image, Fields, Reveal_Chapter)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ID, Fiction_ID, Type, Name, Aliases, Description, Image, Fields, Reveal_Chapter, Created, Updated
+		`,
+		fictionID,
+		entryForm.Type,
+		entryForm.Name,
+		pq.Array(entryForm.Aliases),
+		entryForm.Description,
+		entryForm.Image,
+		fields,
+		entryForm.Reveal_Chapter,
+	)
+
+	entry, err := ScanCodexEntry(row)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The codex already has an entry with this name"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create codex entry"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, entry)
+}
+
+// Replaces the whole entry, the editor always sends every field
+func EditCodexEntry(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the codex."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the codex of this fiction") {
+		return
+	}
+
+	entryForm, fields, ok := BindCodexEntry(ctx)
+	if !ok {
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		UPDATE CodexEntries
+		SET Type = $1, Name = $2, Aliases = $3, Description = $4, Image = $5, Fields = $6, Reveal_Chapter = $7, Updated = NOW()
+		WHERE ID = $8 AND Fiction_ID = $9
+		RETURNING ID, Fiction_ID, Type, Name, Aliases, Description, Image, Fields, Reveal_Chapter, Created, Updated
+		`,
+		entryForm.Type,
+		entryForm.Name,
+		pq.Array(entryForm.Aliases),
+		entryForm.Description,
+		entryForm.Image,
+		fields,
+		entryForm.Reveal_Chapter,
+		ctx.Param("entryID"),
+		fictionID,
+	)
+
+	entry, err := ScanCodexEntry(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Codex entry not found"})
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The codex already has an entry with this name"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update codex entry"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, entry)
+}
+
+func DeleteCodexEntry(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the codex."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the codex of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM CodexEntries WHERE ID = $1 AND Fiction_ID = $2", ctx.Param("entryID"), fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete codex entry"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Codex entry not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Codex entry deleted"})
+}
+
+// Relations are directed, "sister of" from A to B says nothing about B to A
+func CreateCodexRelation(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the codex."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the codex of this fiction") {
+		return
+	}
+
+	relationForm := models.CodexRelationForm{}
+	if err := ctx.ShouldBindJSON(&relationForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	relationForm.Kind = strings.TrimSpace(relationForm.Kind)
+	if relationForm.Kind == "" || len([]rune(relationForm.Kind)) > MAX_CODEX_RELATION_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Kind must be between 1 and " + strconv.Itoa(MAX_CODEX_RELATION_LENGTH) + " characters"})
+		return
+	}
+
+	if relationForm.Reveal_Chapter != nil && *relationForm.Reveal_Chapter < 1 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "reveal_chapter must be a chapter number"})
+		return
+	}
+
+	fromID, err := strconv.Atoi(ctx.Param("entryID"))
+	if err != nil || fromID == relationForm.To_ID {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "An entry cannot be related to itself"})
+		return
+	}
+
+	// Both ends must belong to this fiction, entries of other fictions are never linked
+	relation := models.CodexRelationModel{From_ID: fromID, Kind: relationForm.Kind, Reveal_Chapter: relationForm.Reveal_Chapter}
+	err = db.DB.QueryRow(
+		`
+		INSERT INTO CodexRelations (From_ID, To_ID, Kind, Reveal_Chapter)
+		SELECT
+			F.ID, T.ID, $3, $4
+		FROM
+			CodexEntries F, CodexEntries T
+		WHERE
+			F.ID = $1 AND T.ID = $2 AND F.Fiction_ID = $5 AND T.Fiction_ID = $5
+		RETURNING ID, To_ID, (SELECT Name FROM CodexEntries WHERE ID = $2)
+		`,
+		fromID,
+		relationForm.To_ID,
+		relationForm.Kind,
+		relationForm.Reveal_Chapter,
+		fictionID,
+	).Scan(
+		&relation.ID,
+		&relation.To_ID,
+		&relation.To_Name,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Codex entry not found"})
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The entries already have this relation"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create codex relation"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, relation)
+}
+
+func DeleteCodexRelation(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the codex."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the codex of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec(
+		`
+		DELETE FROM CodexRelations
+		WHERE ID = $1 AND From_ID = $2 AND From_ID IN (SELECT ID FROM CodexEntries WHERE Fiction_ID = $3)
+		`,
+		ctx.Param("relationID"),
+		ctx.Param("entryID"),
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete codex relation"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Codex relation not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Codex relation deleted"})
+}
+
+// Validates the request body and encodes the custom fields, writes the error response itself when it returns false
+func BindCodexEntry(ctx *gin.Context) (*models.CodexEntryForm, string, bool) {
+	entryForm := models.CodexEntryForm{}
+	if err := ctx.ShouldBindJSON(&entryForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return nil, "", false
+	}
+
+	if !codexEntryTypes[entryForm.Type] {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Type must be one of character, location, faction, item or lore"})
+		return nil, "", false
+	}
+
+	entryForm.Name = strings.TrimSpace(entryForm.Name)
+	if entryForm.Name == "" || len([]rune(entryForm.Name)) > MAX_CODEX_NAME_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Name must be between 1 and " + strconv.Itoa(MAX_CODEX_NAME_LENGTH) + " characters"})
+		return nil, "", false
+	}
+
+	aliases := []string{}
+	seen := map[string]bool{strings.ToLower(entryForm.Name): true}
+	for _, alias := range entryForm.Aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || seen[strings.ToLower(alias)] {
+			continue
+		}
+
+		if len([]rune(alias)) > MAX_CODEX_NAME_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Aliases must be at most " + strconv.Itoa(MAX_CODEX_NAME_LENGTH) + " characters"})
+			return nil, "", false
+		}
+
+		seen[strings.ToLower(alias)] = true
+		aliases = append(aliases, alias)
+	}
+
+	if len(aliases) > MAX_CODEX_ALIASES {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "An entry can have at most " + strconv.Itoa(MAX_CODEX_ALIASES) + " aliases"})
+		return nil, "", false
+	}
+
+	entryForm.Aliases = aliases
+	if len(entryForm.Description) > MAX_CODEX_DESCRIPTION_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Description must be at most " + strconv.Itoa(MAX_CODEX_DESCRIPTION_LENGTH) + " characters"})
+		return nil, "", false
+	}
+
+	entryForm.Image = strings.TrimSpace(entryForm.Image)
+	if entryForm.Image != "" {
+		imageURL, err := url.Parse(entryForm.Image)
+		if err != nil || (imageURL.Scheme != "https" && imageURL.Scheme != "http") || len(entryForm.Image) > MAX_CODEX_IMAGE_URL_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Image must be an http or https URL"})
+			return nil, "", false
+		}
+	}
+
+	if len(entryForm.Fields) > MAX_CODEX_FIELDS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "An entry can have at most " + strconv.Itoa(MAX_CODEX_FIELDS) + " custom fields"})
+		return nil, "", false
+	}
+
+	for name, value := range entryForm.Fields {
+		if strings.TrimSpace(name) == "" || len([]rune(name)) > MAX_CODEX_FIELD_NAME_LENGTH || len([]rune(value)) > MAX_CODEX_FIELD_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Field names must be between 1 and " + strconv.Itoa(MAX_CODEX_FIELD_NAME_LENGTH) + " characters and values at most " + strconv.Itoa(MAX_CODEX_FIELD_LENGTH)})
+			return nil, "", false
+		}
+	}
+
+	if entryForm.Fields == nil {
+		entryForm.Fields = map[string]string{}
+	}
+
+	if entryForm.Reveal_Chapter != nil && *entryForm.Reveal_Chapter < 1 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "reveal_chapter must be a chapter number"})
+		return nil, "", false
+	}
+
+	fields, err := json.Marshal(entryForm.Fields)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid custom fields"})
+		return nil, "", false
+	}
+
+	return &entryForm, string(fields), true
+}
+
+// The owner sees everything, readers see what was revealed up to ?chapter=, writes the error response itself when it returns false
+func GetCodexRevealedUntil(ctx *gin.Context, store sessions.Store, fictionID string) (int, bool) {
+	if session, err := GetSession(ctx, store); err == nil {
+		if IDFromSession, ok := session.Values["ID"].(int); ok {
+			var contributorID int
+			err := db.DB.QueryRow("SELECT COALESCE(Contributor_ID, 0) FROM Fictions WHERE ID = $1", fictionID).Scan(&contributorID)
+			if err == nil && contributorID == IDFromSession {
+				return CODEX_REVEAL_ALL, true
+			}
+		}
+	}
+
+	rawChapter := ctx.Query("chapter")
+	if rawChapter == "" {
+		return 0, true
+	}
+
+	chapter, err := strconv.Atoi(rawChapter)
+	if err != nil || chapter < 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid chapter"})
+		return 0, false
+	}
+
+	return chapter, true
+}
+
+func ScanCodexEntry(row interface{ Scan(...interface{}) error }) (*models.CodexEntryModel, error) {
+	entry := models.CodexEntryModel{}
+	var aliases pq.StringArray
+	var fields []byte
+	var revealChapter sql.NullInt64
+	if err := row.Scan(
+		&entry.ID,
+		&entry.Fiction_ID,
+		&entry.Type,
+		&entry.Name,
+		&aliases,
+		&entry.Description,
+		&entry.Image,
+		&fields,
+		&revealChapter,
+		&entry.Created,
+		&entry.Updated,
+	); err != nil {
+		return nil, err
+	}
+
+	entry.Aliases = []string(aliases)
+	entry.Reveal_Chapter = NullableInt(revealChapter)
+	if err := json.Unmarshal(fields, &entry.Fields); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func NullableInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+
+	ID := int(value.Int64)
+	return &ID
+}
+
+// Finds the codex entries named in the chapter text. Entries revealed after this chapter are left out so the
+// links never spoil them. Longer terms win over shorter ones inside them, "Arin Vale" is not also counted as "Arin".
+func FindCodexMentions(fictionID int, chapterID int, content string) ([]models.CodexMentionModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Type, Name, Aliases
+		FROM
+			CodexEntries
+		WHERE
+			Fiction_ID = $1 AND (Reveal_Chapter IS NULL OR Reveal_Chapter <= $2)
+		`,
+		fictionID,
+		chapterID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	type codexTerm struct {
+		entry int
+		term  string
+	}
+
+	mentions := []models.CodexMentionModel{}
+	terms := []codexTerm{}
+	for rows.Next() {
+		mention := models.CodexMentionModel{}
+		var aliases pq.StringArray
+		if err := rows.Scan(
+			&mention.Entry_ID,
+			&mention.Type,
+			&mention.Name,
+			&aliases,
+		); err != nil {
+			return nil, err
+		}
+
+		for _, term := range append([]string{mention.Name}, aliases...) {
+			terms = append(terms, codexTerm{entry: len(mentions), term: term})
+		}
+
+		mention.Terms = []string{}
+		mentions = append(mentions, mention)
+	}
+
+	if len(terms) == 0 {
+		return mentions, nil
+	}
+
+	text := strings.ToLower(StripHTML(content))
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i].term) > len(terms[j].term)
+	})
+
+	claimed := make([]bool, len(text))
+	for _, term := range terms {
+		lowered := strings.ToLower(term.term)
+		found := false
+		for offset := 0; offset < len(text); {
+			index := strings.Index(text[offset:], lowered)
+			if index == -1 {
+				break
+			}
+
+			start := offset + index
+			end := start + len(lowered)
+			offset = start + 1
+			if claimed[start] || claimed[end - 1] || !IsWordBoundary(text, start, end) {
+				continue
+			}
+
+			for position := start; position < end; position++ {
+				claimed[position] = true
+			}
+
+			mentions[term.entry].Count++
+			found = true
+		}
+
+		if found {
+			mentions[term.entry].Terms = append(mentions[term.entry].Terms, term.term)
+		}
+	}
+
+	found := []models.CodexMentionModel{}
+	for _, mention := range mentions {
+		if mention.Count > 0 {
+			found = append(found, mention)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Count > found[j].Count
+	})
+
+	return found, nil
+}
+
+// Latin names need a word boundary so "Al" does not match inside "Also", scripts without spaces such as Thai do not
+func IsWordBoundary(text string, start int, end int) bool {
+	isWordByte := func(b byte) bool {
+		return (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9')
+	}
+
+	if isWordByte(text[start]) && start > 0 && isWordByte(text[start - 1]) {
+		return false
+	}
+
+	if isWordByte(text[end - 1]) && end < len(text) && isWordByte(text[end]) {
+		return false
+	}
+
+	return true
+}
+
+// Called by GetChapter, a failure only costs the links so the chapter is still served
+func AttachCodexMentions(chapter *models.ChapterModel) {
+	mentions, err := FindCodexMentions(chapter.Fiction_ID, chapter.ID, chapter.Content)
+	if err != nil {
+		log.Printf("Error finding codex mentions in chapter %d of fiction %d: %v", chapter.ID, chapter.Fiction_ID, err)
+		return
+	}
+
+	chapter.Mentions = mentions
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"log"
+	"bytes"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	llm "github.com/Fictsu/Fictsu/llm"
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	INTRO_COVER string = "Please generate a book cover illustration for a web novel, without any text, title, lettering or logos. "
+
+	DEFAULT_COVER_CANDIDATES int    = 3
+	MAX_COVER_CANDIDATES     int    = 4
+	DEFAULT_COVER_SIZE       string = "1024x1792"
+
+	// Image models only read a short prompt, the synopsis is cut to fit
+	MAX_COVER_SYNOPSIS_LENGTH int = 800
+)
+
+var ErrNoCoverCandidates = errors.New("no cover candidate could be generated")
+
+// Starts an async job that generates several cover candidates, poll GET /ai/jobs/:jobID for the result
+func OpenAICreateCoverCandidates(ctx *gin.Context) {
+	fictionID, err := strconv.Atoi(ctx.Param("fictionID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+		return
+	}
+
+	userID := ctx.GetInt("ai_user_ID")
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), userID, "generate covers for this fiction") {
+		return
+	}
+
+	coverForm := models.CoverCandidateForm{}
+	if err := ctx.ShouldBindJSON(&coverForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if coverForm.Count == 0 {
+		coverForm.Count = DEFAULT_COVER_CANDIDATES
+	}
+
+	if coverForm.Count < 1 || coverForm.Count > MAX_COVER_CANDIDATES {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Count must be between 1 and " + strconv.Itoa(MAX_COVER_CANDIDATES)})
+		return
+	}
+
+	coverForm.Style = strings.TrimSpace(coverForm.Style)
+	if len(coverForm.Style) > MAX_IMAGE_PROMPT_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Style must be at most " + strconv.Itoa(MAX_IMAGE_PROMPT_LENGTH) + " characters"})
+		return
+	}
+
+	if coverForm.Size == "" {
+		coverForm.Size = DEFAULT_COVER_SIZE
+	}
+
+	if !imageSizes[coverForm.Size] {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Size must be one of 1024x1024, 1792x1024 or 1024x1792"})
+		return
+	}
+
+	// The prompt is built now so the job does not depend on later edits of the fiction
+	prompt, err := BuildCoverPrompt(fictionID, coverForm.Style)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Fiction not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve fiction"})
+		}
+
+		return
+	}
+
+	job, err := StartAIJob(userID, fictionID, models.AIJobCover, coverForm, func(jobCtx context.Context, job *models.AIJobModel) (interface{}, error) {
+		return GenerateCoverCandidates(jobCtx, job, coverForm, prompt)
+	})
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start generation"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusAccepted, job)
+}
+
+// Title, subtitle, genres and the start of the synopsis, followed by the owner's style notes
+func BuildCoverPrompt(fictionID int, style string) (string, error) {
+	var title string
+	var subtitle string
+	var synopsis string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Title, COALESCE(Subtitle, ''), COALESCE(Synopsis, '')
+		FROM
+			Fictions
+		WHERE
+			ID = $1
+		`,
+		fictionID,
+	).Scan(
+		&title,
+		&subtitle,
+		&synopsis,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	genres, err := GetAllGenres(strconv.Itoa(fictionID))
+	if err != nil {
+		return "", err
+	}
+
+	genreNames := []string{}
+	for _, genre := range genres {
+		genreNames = append(genreNames, genre.Genre_Name)
+	}
+
+	synopsis = StripHTML(synopsis)
+	synopsis = TruncateText(synopsis, MAX_COVER_SYNOPSIS_LENGTH)
+
+	prompt := strings.Builder{}
+	prompt.WriteString(INTRO_COVER)
+	prompt.WriteString("The story is titled '" + title + "'")
+	if subtitle != "" {
+		prompt.WriteString(" with the subtitle '" + subtitle + "'")
+	}
+
+	prompt.WriteString(". ")
+	if len(genreNames) > 0 {
+		prompt.WriteString("Genres: " + strings.Join(genreNames, ", ") + ". ")
+	}
+
+	if synopsis != "" {
+		prompt.WriteString("Synopsis: " + synopsis + " ")
+	}
+
+	if style != "" {
+		prompt.WriteString("Style: " + style)
+	}
+
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+// Runs inside the job: a failed candidate is skipped, the job only fails when none could be made
+func GenerateCoverCandidates(ctx context.Context, job *models.AIJobModel, coverForm models.CoverCandidateForm, prompt string) ([]models.CoverCandidateModel, error) {
+	candidates := []models.CoverCandidateModel{}
+	for index := 0; index < coverForm.Count; index++ {
+		candidate, err := GenerateCoverCandidate(ctx, job, coverForm.Size, prompt)
+		if err != nil {
+			log.Printf("Error generating cover candidate for job %d: %v", job.ID, err)
+			if ctx.Err() != nil {
+				break
+			}
+
+			continue
+		}
+
+		candidates = append(candidates, *candidate)
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoCoverCandidates
+	}
+
+	return candidates, nil
+}
+
+func GenerateCoverCandidate(ctx context.Context, job *models.AIJobModel, size string, prompt string) (*models.CoverCandidateModel, error) {
+	response, err := llm.Client.GenerateImage(ctx, llm.ImageRequest{
+		Model: configs.CoverModel,
+		Prompt: prompt,
+		Size: size,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	RecordAIUsage(job.User_ID, models.AIFeatureCover, response.Model, 0, 0, 1)
+
+	image, contentType, err := FetchGeneratedImage(response)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	candidate := models.CoverCandidateModel{
+		Fiction_ID: job.Fiction_ID,
+		Job_ID:     job.ID,
+		Prompt:     prompt,
+	}
+
+	err = tx.QueryRow(
+		`
+		INSERT INTO CoverCandidates (Fiction_ID, Job_ID, Ref, Prompt)
+		VALUES ($1, $2, '', $3)
+		RETURNING ID, Created
+		`,
+		candidate.Fiction_ID,
+		candidate.Job_ID,
+		candidate.Prompt,
+	).Scan(
+		&candidate.ID,
+		&candidate.Created,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidate.Ref, err = UploadBytesToFirebase(bytes.NewReader(image), contentType, CoverCandidatePath(candidate.Fiction_ID, candidate.ID), configs.BucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE CoverCandidates SET Ref = $1 WHERE ID = $2", candidate.Ref, candidate.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &candidate, nil
+}
+
+// Candidates are only shown to the owner until one of them becomes the cover
+func GetCoverCandidates(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view cover candidates."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view cover candidates of this fiction") {
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, COALESCE(Job_ID, 0), Ref, Prompt, Created
+		FROM
+			CoverCandidates
+		WHERE
+			Fiction_ID = $1 AND Ref != ''
+		ORDER BY ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch cover candidates"})
+		return
+	}
+
+	defer rows.Close()
+	candidates := []models.CoverCandidateModel{}
+	for rows.Next() {
+		candidate := models.CoverCandidateModel{}
+		if err := rows.Scan(
+			&candidate.ID,
+			&candidate.Fiction_ID,
+			&candidate.Job_ID,
+			&candidate.Ref,
+			&candidate.Prompt,
+			&candidate.Created,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing cover candidates"})
+			return
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, candidates)
+}
+
+// Copies the chosen candidate to the regular cover path, the same place CreateFiction and EditFiction upload to
+func SelectCoverCandidate(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit a fiction."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit this fiction") {
+		return
+	}
+
+	var candidateFictionID int
+	var candidateID int
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Fiction_ID, ID
+		FROM
+			CoverCandidates
+		WHERE
+			Fiction_ID = $1 AND ID = $2 AND Ref != ''
+		`,
+		fictionID,
+		ctx.Param("candidateID"),
+	).Scan(
+		&candidateFictionID,
+		&candidateID,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Cover candidate not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch cover candidate"})
+		}
+
+		return
+	}
+
+	image, contentType, err := DownloadImageFromFirebase(CoverCandidatePath(candidateFictionID, candidateID), configs.BucketName)
+	if err != nil {
+		log.Printf("Error downloading cover candidate %d: %v", candidateID, err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to read cover candidate"})
+		return
+	}
+
+	coverPath := configs.CoverPath + fictionID
+	URL, err := UploadBytesToFirebase(bytes.NewReader(image), contentType, coverPath, configs.BucketName)
+	if err != nil {
+		log.Printf("Error uploading cover: %v", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to upload cover"})
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE Fictions SET Cover = $1 WHERE ID = $2", URL, fictionID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update fiction"})
+		return
+	}
+
+	DeleteCoverCandidates(candidateFictionID)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Cover updated successfully", "Cover": URL})
+}
+
+func DiscardCoverCandidates(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to discard cover candidates."})
+		return
+	}
+
+	fictionID, err := strconv.Atoi(ctx.Param("fictionID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+		return
+	}
+
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), IDFromSession.(int), "discard cover candidates of this fiction") {
+		return
+	}
+
+	DeleteCoverCandidates(fictionID)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Cover candidates discarded"})
+}
+
+// Best effort, a leftover file in storage is harmless and nothing points to it anymore
+func DeleteCoverCandidates(fictionID int) {
+	rows, err := db.DB.Query(
+		`
+		DELETE FROM CoverCandidates
+		WHERE Fiction_ID = $1
+		RETURNING ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		log.Printf("Error deleting cover candidates: %v", err)
+		return
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var candidateID int
+		if err := rows.Scan(&candidateID); err != nil {
+			log.Printf("Error processing deleted cover candidates: %v", err)
+			return
+		}
+
+		if err := DeleteImageFromFirebase(CoverCandidatePath(fictionID, candidateID), configs.BucketName); err != nil {
+			log.Printf("Error deleting cover candidate image: %v", err)
+		}
+	}
+}
+
+func CoverCandidatePath(fictionID int, candidateID int) string {
+	return configs.CoverPath + "candidates/" + strconv.Itoa(fictionID) + "/" + strconv.Itoa(candidateID)
+}
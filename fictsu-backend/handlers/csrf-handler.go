@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"strings"
+	"net/url"
+	"net/http"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	CSRF_COOKIE_NAME string = "fictsu-csrf"
+	CSRF_HEADER_NAME string = "X-CSRF-Token"
+)
+
+// Returns the CSRF token for the browser. The front-end runs on another origin and can not
+// read the API's cookies, so it fetches the token here and echoes it in the X-CSRF-Token header.
+// The token belongs to the current session, so it has to be fetched again after logging in or out.
+func GetCSRFToken(ctx *gin.Context, store sessions.Store) {
+	token, err := EnsureCSRFCookie(ctx, store)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate CSRF token"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"csrf_token": token})
+}
+
+// Signed double-submit protection for cookie-authenticated writes.
+// Unsafe requests must come from an allowed Origin/Referer and echo the fictsu-csrf cookie in X-CSRF-Token,
+// and that token must have been issued to the same session.
+// Bearer token requests are exempt since browsers never attach those on their own.
+func CSRFProtection(store sessions.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if IsSafeMethod(ctx.Request.Method) {
+			ctx.Next()
+			return
+		}
+
+		if _, isTokenRequest := ctx.Get("token_user_ID"); isTokenRequest {
+			ctx.Next()
+			return
+		}
+
+		if !IsAllowedRequestOrigin(ctx.Request) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "Request origin is not allowed"})
+			return
+		}
+
+		cookie, err := ctx.Cookie(CSRF_COOKIE_NAME)
+		header := ctx.GetHeader(CSRF_HEADER_NAME)
+		if err != nil || header == "" || !hmac.Equal([]byte(cookie), []byte(header)) || !IsValidCSRFToken(cookie, CSRFSessionID(ctx, store)) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "Missing or invalid CSRF token"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// Reuses the current cookie when it is still valid for this session, otherwise issues a new one
+func EnsureCSRFCookie(ctx *gin.Context, store sessions.Store) (string, error) {
+	sessionID := CSRFSessionID(ctx, store)
+	if cookie, err := ctx.Cookie(CSRF_COOKIE_NAME); err == nil && IsValidCSRFToken(cookie, sessionID) {
+		return cookie, nil
+	}
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(nonce) + "." + SignCSRFNonce(hex.EncodeToString(nonce), sessionID)
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     CSRF_COOKIE_NAME,
+		Value:    token,
+		Path:     "/",
+		Domain:   configs.CookieDomain,
+		MaxAge:   int(configs.SessionAbsoluteTimeout.Seconds()),
+		Secure:   configs.CookieSecure,
+		SameSite: configs.CookieSameSite,
+	})
+
+	return token, nil
+}
+
+// The signature covers the session, so a token fetched by someone else, or planted by a sibling subdomain,
+// does not pass for the victim's session. Logged-out visitors all share the empty session ID.
+func IsValidCSRFToken(token string, sessionID string) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	return hmac.Equal([]byte(parts[1]), []byte(SignCSRFNonce(parts[0], sessionID)))
+}
+
+func SignCSRFNonce(nonce string, sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(configs.SessionKey))
+	mac.Write([]byte("csrf:" + HashSessionID(sessionID) + ":" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The session token itself never goes into the signature input, only its hash
+func HashSessionID(sessionID string) string {
+	hash := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(hash[:])
+}
+
+// Empty when the request has no valid session cookie
+func CSRFSessionID(ctx *gin.Context, store sessions.Store) string {
+	session, err := store.Get(ctx.Request, "fictsu-session")
+	if err != nil || session.IsNew {
+		return ""
+	}
+
+	return session.ID
+}
+
+// Browsers send Origin on cross-site writes and usually Referer otherwise, one of them must name an allowed origin.
+// Cookie-authenticated writes that carry neither are refused, scripts should use a bearer token instead.
+func IsAllowedRequestOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		referer := request.Header.Get("Referer")
+		if referer == "" {
+			return false
+		}
+
+		parsedURL, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+
+		origin = parsedURL.Scheme + "://" + parsedURL.Host
+	}
+
+	for _, allowedOrigin := range configs.AllowedOrigins {
+		if strings.EqualFold(origin, allowedOrigin) {
+			return true
+		}
+	}
+
+	return false
+}
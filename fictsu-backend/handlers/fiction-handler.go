@@ -18,7 +18,7 @@ func GetAllFictions(ctx *gin.Context) {
 	rows, err := db.DB.Query(
 		`
 		SELECT
-			ID, Contributor_ID, Contributor_Name, Cover, Title,
+			ID, COALESCE(Contributor_ID, 0), Contributor_Name, Cover, Title,
 			Subtitle, Author, Artist, Status, Synopsis, Created
 		FROM
 			Fictions
@@ -63,7 +63,7 @@ func GetFiction(ctx *gin.Context) {
 	err := db.DB.QueryRow(
 		`
 		SELECT
-			ID, Contributor_ID, Contributor_Name, Cover, Title,
+			ID, COALESCE(Contributor_ID, 0), Contributor_Name, Cover, Title,
 			Subtitle, Author, Artist, Status, Synopsis, Created
 		FROM
 			Fictions
@@ -114,8 +114,8 @@ func GetFiction(ctx *gin.Context) {
 	ctx.IndentedJSON(http.StatusOK, gin.H{"Fiction": fiction})
 }
 
-func CreateFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func CreateFiction(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -190,8 +190,8 @@ func CreateFiction(ctx *gin.Context, store *sessions.CookieStore) {
 	ctx.IndentedJSON(http.StatusCreated, fiction)
 }
 
-func EditFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func EditFiction(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -208,10 +208,11 @@ func EditFiction(ctx *gin.Context, store *sessions.CookieStore) {
 
 	// Check if the fiction exists and if the contributor matches the logged-in user
 	var getContributorID int
+	var oldStatus models.Status
 	errMatch := db.DB.QueryRow(
 		`
 		SELECT
-			Contributor_ID
+			COALESCE(Contributor_ID, 0), COALESCE(Status, '')
 		FROM
 			Fictions
 		WHERE
@@ -220,6 +221,7 @@ func EditFiction(ctx *gin.Context, store *sessions.CookieStore) {
 		fictionID,
 	).Scan(
 		&getContributorID,
+		&oldStatus,
 	)
 
 	if errMatch != nil {
@@ -310,11 +312,15 @@ func EditFiction(ctx *gin.Context, store *sessions.CookieStore) {
 		}
 	}
 
+	if fictionUpdateRequest.Status != "" && fictionUpdateRequest.Status != oldStatus {
+		DispatchWebhookEvent(fictionID, models.FictionStatusChanged, gin.H{"old_status": oldStatus, "new_status": fictionUpdateRequest.Status})
+	}
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Fiction updated successfully"})
 }
 
-func DeleteFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func DeleteFiction(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -334,7 +340,7 @@ func DeleteFiction(ctx *gin.Context, store *sessions.CookieStore) {
 	errMatch := db.DB.QueryRow(
 		`
 		SELECT
-			Contributor_ID
+			COALESCE(Contributor_ID, 0)
 		FROM
 			Fictions
 		WHERE
@@ -385,11 +391,47 @@ func DeleteFiction(ctx *gin.Context, store *sessions.CookieStore) {
 	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Fiction deleted successfully"})
 }
 
+// Check if the fiction exists and if the contributor matches the logged-in user.
+// Writes the error response and returns false when the check fails.
+func CheckFictionOwner(ctx *gin.Context, fictionID string, userID int, action string) bool {
+	var getContributorID int
+	errMatch := db.DB.QueryRow(
+		`
+		SELECT
+			COALESCE(Contributor_ID, 0)
+		FROM
+			Fictions
+		WHERE
+			ID = $1
+		`,
+		fictionID,
+	).Scan(
+		&getContributorID,
+	)
+
+	if errMatch != nil {
+		if errMatch == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Fiction not found"})
+			return false
+		}
+
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch fiction data"})
+		return false
+	}
+
+	if getContributorID != userID {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{"Error": "You do not have permission to " + action})
+		return false
+	}
+
+	return true
+}
+
 func GetContributedFictions(user_ID int) ([]models.FictionModel, error) {
 	rows, err := db.DB.Query(
 		`
 		SELECT
-			ID, Contributor_ID, Contributor_Name, Cover, Title,
+			ID, COALESCE(Contributor_ID, 0), Contributor_Name, Cover, Title,
 			Subtitle, Author, Artist, Status, Synopsis, Created
 		FROM
 			Fictions
@@ -440,7 +482,7 @@ func GetFavFictions(user_ID int) ([]models.FictionModel, error) {
 	rows, err := db.DB.Query(
 		`
 		SELECT
-			F.ID, F.Contributor_ID, F.Contributor_Name, F.Cover, F.Title,
+			F.ID, COALESCE(F.Contributor_ID, 0), F.Contributor_Name, F.Cover, F.Title,
 			F.Subtitle, F.Author, F.Artist, F.Status, F.Synopsis, F.Created
 		FROM 
 			UserFavoriteFiction UF
@@ -489,8 +531,8 @@ func GetFavFictions(user_ID int) ([]models.FictionModel, error) {
 	return favFictions, nil
 }
 
-func AddFavoriteFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func AddFavoriteFiction(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -528,11 +570,27 @@ func AddFavoriteFiction(ctx *gin.Context, store *sessions.CookieStore) {
 		return
 	}
 
+	var favoriteCount int
+	db.DB.QueryRow(
+		`
+		SELECT
+			COUNT(*)
+		FROM
+			UserFavoriteFiction
+		WHERE
+			Fiction_ID = $1
+		`,
+		fictionID,
+	).Scan(
+		&favoriteCount,
+	)
+
+	DispatchWebhookEvent(fictionID, models.FictionFavorited, gin.H{"favorite_count": favoriteCount})
 	ctx.IndentedJSON(http.StatusCreated, gin.H{"is_favorited": true, "Message": "Fiction added to favorites"})
 }
 
-func CheckFavoriteFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+func CheckFavoriteFiction(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -573,8 +631,8 @@ func CheckFavoriteFiction(ctx *gin.Context, store *sessions.CookieStore) {
 	ctx.IndentedJSON(http.StatusOK, gin.H{"is_favorited": isFavorited})
 }
 
-func RemoveFavoriteFiction(ctx *gin.Context, store *sessions.CookieStore) {
-	session, err := store.Get(ctx.Request, "fictsu-session")
+func RemoveFavoriteFiction(ctx *gin.Context, store sessions.Store) {
+	session, err := GetSession(ctx, store)
 	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
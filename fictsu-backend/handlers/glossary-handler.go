@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"strings"
+	"net/http"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_GLOSSARY_TERM_LENGTH int = 255
+	MAX_GLOSSARY_NOTE_LENGTH int = 1000
+)
+
+func GetGlossary(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view the glossary."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view the glossary of this fiction") {
+		return
+	}
+
+	terms, err := GetGlossaryTerms(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch glossary"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, terms)
+}
+
+func GetGlossaryTerms(fictionID interface{}) ([]models.GlossaryTermModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Source_Term, Target_Term, Note, Created
+		FROM
+			TranslationGlossary
+		WHERE
+			Fiction_ID = $1
+		ORDER BY Source_Term
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	terms := []models.GlossaryTermModel{}
+	for rows.Next() {
+		term := models.GlossaryTermModel{}
+		if err := rows.Scan(
+			&term.ID,
+			&term.Fiction_ID,
+			&term.Source_Term,
+			&term.Target_Term,
+			&term.Note,
+			&term.Created,
+		); err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, term)
+	}
+
+	return terms, nil
+}
+
+func CreateGlossaryTerm(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the glossary."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the glossary of this fiction") {
+		return
+	}
+
+	term, ok := BindGlossaryTerm(ctx)
+	if !ok {
+		return
+	}
+
+	err := db.DB.QueryRow(
+		`
+		INSERT INTO TranslationGlossary (Fiction_ID, Source_Term, Target_Term, Note)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ID, Fiction_ID, Created
+		`,
+		fictionID,
+		term.Source_Term,
+		term.Target_Term,
+		term.Note,
+	).Scan(
+		&term.ID,
+		&term.Fiction_ID,
+		&term.Created,
+	)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The glossary already has this term"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create glossary term"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, term)
+}
+
+func EditGlossaryTerm(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the glossary."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the glossary of this fiction") {
+		return
+	}
+
+	term, ok := BindGlossaryTerm(ctx)
+	if !ok {
+		return
+	}
+
+	err := db.DB.QueryRow(
+		`
+		UPDATE TranslationGlossary
+		SET Source_Term = $1, Target_Term = $2, Note = $3
+		WHERE ID = $4 AND Fiction_ID = $5
+		RETURNING ID, Fiction_ID, Created
+		`,
+		term.Source_Term,
+		term.Target_Term,
+		term.Note,
+		ctx.Param("termID"),
+		fictionID,
+	).Scan(
+		&term.ID,
+		&term.Fiction_ID,
+		&term.Created,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Glossary term not found"})
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The glossary already has this term"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update glossary term"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, term)
+}
+
+func DeleteGlossaryTerm(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the glossary."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the glossary of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM TranslationGlossary WHERE ID = $1 AND Fiction_ID = $2", ctx.Param("termID"), fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete glossary term"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Glossary term not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Glossary term deleted"})
+}
+
+// Validates the request body, writes the error response itself when it returns false
+func BindGlossaryTerm(ctx *gin.Context) (*models.GlossaryTermModel, bool) {
+	termForm := models.GlossaryTermForm{}
+	if err := ctx.ShouldBindJSON(&termForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return nil, false
+	}
+
+	term := models.GlossaryTermModel{
+		Source_Term: strings.TrimSpace(termForm.Source_Term),
+		Target_Term: strings.TrimSpace(termForm.Target_Term),
+		Note:        strings.TrimSpace(termForm.Note),
+	}
+
+	if term.Source_Term == "" || term.Target_Term == "" || len([]rune(term.Source_Term)) > MAX_GLOSSARY_TERM_LENGTH || len([]rune(term.Target_Term)) > MAX_GLOSSARY_TERM_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Terms must be between 1 and 255 characters"})
+		return nil, false
+	}
+
+	if len([]rune(term.Note)) > MAX_GLOSSARY_NOTE_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Note must be at most 1000 characters"})
+		return nil, false
+	}
+
+	return &term, true
+}
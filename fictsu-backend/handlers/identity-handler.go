@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+// Satisfied by both *sql.DB and *sql.Tx
+type QueryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Satisfied by both *sql.DB and *sql.Tx, for helpers that run on their own or as part of a transaction
+type Querier interface {
+	QueryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+var ErrIdentityTaken = fmt.Errorf("this login is already linked to an account")
+
+func GetUserIdentities(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	identities, err := GetUserIdentitiesOf(IDFromSession.(int))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch linked accounts"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, identities)
+}
+
+func GetUserIdentitiesOf(userID int) ([]models.UserIdentityModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, User_ID, Provider, Provider_User_ID, COALESCE(Email, ''), Created
+		FROM
+			UserIdentities
+		WHERE
+			User_ID = $1
+		ORDER BY ID
+		`,
+		userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	identities := []models.UserIdentityModel{}
+	for rows.Next() {
+		identity := models.UserIdentityModel{}
+		if err := rows.Scan(
+			&identity.ID,
+			&identity.User_ID,
+			&identity.Provider,
+			&identity.Provider_User_ID,
+			&identity.Email,
+			&identity.Created,
+		); err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// Starts the provider login for an already logged-in user, the callback then links instead of logging in
+func LinkOpenAuthorization(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to link another account."})
+		return
+	}
+
+	session.Values["link_user_ID"] = IDFromSession.(int)
+	if err := session.Save(ctx.Request, ctx.Writer); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save session"})
+		return
+	}
+
+	GetOpenAuthorization(ctx, store)
+}
+
+func UnlinkUserIdentity(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to unlink an account."})
+		return
+	}
+
+	IDToDB := IDFromSession.(int)
+	provider := ctx.Param("provider")
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to unlink account"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	// Lock the user's identities so two concurrent unlinks cannot remove the last two at once
+	var identityCount int
+	errCount := tx.QueryRow(
+		`
+		SELECT
+			COUNT(*)
+		FROM (
+			SELECT
+				ID
+			FROM
+				UserIdentities
+			WHERE
+				User_ID = $1
+			FOR UPDATE
+		) AS Identities
+		`,
+		IDToDB,
+	).Scan(
+		&identityCount,
+	)
+
+	if errCount != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch linked accounts"})
+		return
+	}
+
+	if identityCount <= 1 {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "You cannot unlink your only login method"})
+		return
+	}
+
+	result, err := tx.Exec(
+		`
+		DELETE FROM
+			UserIdentities
+		WHERE
+			User_ID = $1 AND Provider = $2
+		`,
+		IDToDB,
+		provider,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to unlink account"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "No linked account for this provider"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to unlink account"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Account unlinked successfully"})
+}
+
+func InsertUserIdentity(queryRower QueryRower, identity *models.UserIdentityModel) error {
+	err := queryRower.QueryRow(
+		`
+		INSERT INTO UserIdentities (User_ID, Provider, Provider_User_ID, Email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING ID, Created
+		`,
+		identity.User_ID,
+		identity.Provider,
+		identity.Provider_User_ID,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.Created,
+	)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			return ErrIdentityTaken
+		}
+
+		return fmt.Errorf("failed to link account: %v", err)
+	}
+
+	return nil
+}
@@ -1,15 +1,101 @@
 package handlers
 
 import (
+	"log"
+	"errors"
+	"strings"
+	"net/url"
 	"net/http"
+	"html/template"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth/gothic"
 
+	db "github.com/Fictsu/Fictsu/database"
 	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
 )
 
-func GetOpenAuthorization(ctx *gin.Context) {
+// Implemented by stores that can issue a new session token, see db.PostgresStore
+type SessionRegenerator interface {
+	Regenerate(request *http.Request, writer http.ResponseWriter, session *sessions.Session) error
+}
+
+var ErrInvalidReturnTo = errors.New("return_to must be a path or URL on the front end")
+
+var popupTemplate = template.Must(template.New("popup").Parse(`
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Logging in...</title>
+		<script>
+			if (window.opener) {
+				window.opener.postMessage({{ .Message }}, {{ .Origin }});
+			}
+			window.close();
+		</script>
+	</head>
+	<body>
+		<p>Logging in... If this window does not close, please close it manually.</p>
+	</body>
+	</html>
+`))
+
+var errorTemplate = template.Must(template.New("error").Parse(`
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Login failed</title>
+		{{ if .Popup }}
+		<script>
+			if (window.opener) {
+				window.opener.postMessage("login-error", {{ .Origin }});
+			}
+		</script>
+		{{ end }}
+	</head>
+	<body style="font-family: sans-serif; max-width: 32rem; margin: 4rem auto; text-align: center;">
+		<h1>Login failed</h1>
+		<p>{{ .Message }}</p>
+		{{ if .Popup }}
+		<p><button onclick="window.close()">Close this window</button></p>
+		{{ else }}
+		<p><a href="{{ .ReturnTo }}">Back to Fictsu</a></p>
+		{{ end }}
+	</body>
+	</html>
+`))
+
+// Starts the provider login. Passing return_to switches to the redirect flow for clients that block popups.
+func GetOpenAuthorization(ctx *gin.Context, store sessions.Store) {
+	session, err := store.Get(ctx.Request, "fictsu-session")
+	if err != nil {
+		AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to start login. Please try again.", "")
+		return
+	}
+
+	// A link flow that was abandoned must not turn this plain login into a link
+	delete(session.Values, "link_user_ID")
+	delete(session.Values, "return_to")
+	if rawReturnTo := ctx.Query("return_to"); rawReturnTo != "" {
+		returnTo, err := ValidateReturnTo(rawReturnTo)
+		if err != nil {
+			AuthErrorResponse(ctx, http.StatusBadRequest, "The page to return to after login is not allowed.", "")
+			return
+		}
+
+		session.Values["return_to"] = returnTo
+	}
+
+	if err := session.Save(ctx.Request, ctx.Writer); err != nil {
+		AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to start login. Please try again.", "")
+		return
+	}
+
 	provider := ctx.Param("provider")
 	query := ctx.Request.URL.Query()
 	query.Add("provider", provider)
@@ -18,80 +104,238 @@ func GetOpenAuthorization(ctx *gin.Context) {
 	gothic.BeginAuthHandler(ctx.Writer, ctx.Request)
 }
 
-func AuthorizedCallback(ctx *gin.Context, store *sessions.CookieStore) {
+func AuthorizedCallback(ctx *gin.Context, store sessions.Store) {
 	provider := ctx.Param("provider")
 	query := ctx.Request.URL.Query()
 	query.Add("provider", provider)
 	ctx.Request.URL.RawQuery = query.Encode()
 
+	session, err := store.Get(ctx.Request, "fictsu-session")
+	if err != nil {
+		AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to create session. Please try again.", "")
+		return
+	}
+
+	// Set by GetOpenAuthorization when the redirect flow was requested, empty for the popup flow
+	returnTo, _ := session.Values["return_to"].(string)
+
+	// Set by LinkOpenAuthorization. It only applies to this one callback, so it is cleared before anything can fail.
+	linkUserID, isLinking := session.Values["link_user_ID"].(int)
+	if isLinking {
+		delete(session.Values, "link_user_ID")
+		delete(session.Values, "return_to")
+		session.Save(ctx.Request, ctx.Writer)
+	}
+
 	user, err := gothic.CompleteUserAuth(ctx.Writer, ctx.Request)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		log.Printf("Error completing %s login: %v", provider, err)
+		AuthErrorResponse(ctx, http.StatusBadRequest, "The login was cancelled or could not be verified. Please try again.", returnTo)
+		return
+	}
+
+	identity := &models.UserIdentityModel{
+		Provider: 			provider,
+		Provider_User_ID: 	user.UserID,
+		Email: 				user.Email,
+	}
+
+	// The flow was started from LinkOpenAuthorization, attach this login to the current account
+	if isLinking {
+		var alreadyLinked bool
+		db.DB.QueryRow(
+			`
+			SELECT EXISTS (
+				SELECT
+					1
+				FROM
+					UserIdentities
+				WHERE
+					User_ID = $1 AND Provider = $2
+			)
+			`,
+			linkUserID,
+			provider,
+		).Scan(
+			&alreadyLinked,
+		)
+
+		if alreadyLinked {
+			AuthErrorResponse(ctx, http.StatusConflict, "You have already linked an account from this provider.", returnTo)
+			return
+		}
+
+		identity.User_ID = linkUserID
+		if err := InsertUserIdentity(db.DB, identity); err != nil {
+			if err == ErrIdentityTaken {
+				AuthErrorResponse(ctx, http.StatusConflict, "This login is already linked to another account.", returnTo)
+			} else {
+				log.Printf("Error linking %s identity: %v", provider, err)
+				AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to link account. Please try again.", returnTo)
+			}
+
+			return
+		}
+
+		AuthSuccessResponse(ctx, "link-success", returnTo)
 		return
 	}
 
 	// Check if the user exists in the database
-	userInDB, err := GetUser(user.UserID)
+	userInDB, err := GetUserByIdentity(provider, user.UserID)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		log.Printf("Error looking up %s identity: %v", provider, err)
+		AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to log in. Please try again.", returnTo)
 		return
 	}
 
 	// Create a new user if not found
 	if userInDB == nil {
 		newUser := &models.UserModel{
-			User_ID: 	user.UserID,
 			Name: 		user.Name,
 			Email: 		user.Email,
 			Avatar_URL: user.AvatarURL,
 		}
 
-		createdUser, err := CreateUser(newUser)
+		// Some providers only return a nickname
+		if newUser.Name == "" {
+			newUser.Name = user.NickName
+		}
+
+		createdUser, err := CreateUser(newUser, identity)
 		if err != nil {
-			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			if err == ErrEmailTaken {
+				AuthErrorResponse(ctx, http.StatusConflict, "An account with this email already exists. Log in with your original provider and link this one from your profile.", returnTo)
+			} else {
+				log.Printf("Error creating user: %v", err)
+				AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to create your account. Please try again.", returnTo)
+			}
+
 			return
 		}
 
 		userInDB = createdUser
 	}
 
-	session, err := store.Get(ctx.Request, "fictsu-session")
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create session"})
-		return
-	}
-
+	// Start from a clean session so nothing set before authentication carries over
+	session.Values = map[interface{}]interface{}{}
 	session.Values["ID"] = userInDB.ID
 	session.Values["name"] = userInDB.Name
 	session.Values["email"] = userInDB.Email
 	session.Values["avatar_URL"] = userInDB.Avatar_URL
-	err = session.Save(ctx.Request, ctx.Writer)
+
+	// Rotate the token so one planted before login (session fixation) is useless afterwards
+	if regenerator, ok := store.(SessionRegenerator); ok {
+		err = regenerator.Regenerate(ctx.Request, ctx.Writer, session)
+	} else {
+		err = session.Save(ctx.Request, ctx.Writer)
+	}
+
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save session"})
+		AuthErrorResponse(ctx, http.StatusInternalServerError, "Failed to save session. Please try again.", returnTo)
+		return
+	}
+
+	AuthSuccessResponse(ctx, "login-success", returnTo)
+}
+
+// Redirects back to the front end in the redirect flow, otherwise notifies the popup opener
+func AuthSuccessResponse(ctx *gin.Context, message string, returnTo string) {
+	if returnTo == "" {
+		PopupResponse(ctx, message)
 		return
 	}
 
-	HTMLResponse := `
-		<!DOCTYPE html>
-		<html lang="en">
-		<head>
-			<meta charset="UTF-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-			<title>Logging in...</title>
-			<script>
-				window.opener.postMessage("login-success", "*");
-				window.close();
-			</script>
-		</head>
-		<body>
-			<p>Logging in... If this window does not close, please close it manually.</p>
-		</body>
-		</html>
-	`
-	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(HTMLResponse))
+	target, err := url.Parse(returnTo)
+	if err != nil {
+		PopupResponse(ctx, message)
+		return
+	}
+
+	query := target.Query()
+	query.Set("auth", message)
+	target.RawQuery = query.Encode()
+	ctx.Redirect(http.StatusSeeOther, target.String())
+}
+
+// Notifies the window that opened the login popup and closes the popup.
+// The message is only delivered to the front end origin, never to "*".
+func PopupResponse(ctx *gin.Context, message string) {
+	ctx.Status(http.StatusOK)
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	popupTemplate.Execute(ctx.Writer, gin.H{
+		"Message": message,
+		"Origin":  FrontEndOrigin(),
+	})
+}
+
+// Renders a readable error page for the browser instead of JSON, details go to the log only
+func AuthErrorResponse(ctx *gin.Context, status int, message string, returnTo string) {
+	popup := returnTo == ""
+	if popup {
+		returnTo = configs.FrontEndURL
+	}
+
+	ctx.Status(status)
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	errorTemplate.Execute(ctx.Writer, gin.H{
+		"Message":  message,
+		"Origin":   FrontEndOrigin(),
+		"ReturnTo": template.URL(returnTo),
+		"Popup":    popup,
+	})
+}
+
+// Accepts a path on the front end or an absolute URL on one of the allowed origins, returns an absolute URL
+func ValidateReturnTo(returnTo string) (string, error) {
+	// "//host" and "/\host" are protocol-relative in browsers and would leave the site
+	if strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") || strings.ContainsAny(returnTo, "\r\n") {
+		return "", ErrInvalidReturnTo
+	}
+
+	target, err := url.Parse(returnTo)
+	if err != nil {
+		return "", ErrInvalidReturnTo
+	}
+
+	if !target.IsAbs() {
+		if !strings.HasPrefix(returnTo, "/") || target.Host != "" {
+			return "", ErrInvalidReturnTo
+		}
+
+		base, err := url.Parse(FrontEndOrigin())
+		if err != nil {
+			return "", ErrInvalidReturnTo
+		}
+
+		return base.ResolveReference(target).String(), nil
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" || target.User != nil {
+		return "", ErrInvalidReturnTo
+	}
+
+	origin := target.Scheme + "://" + target.Host
+	for _, allowedOrigin := range configs.AllowedOrigins {
+		if strings.EqualFold(origin, allowedOrigin) {
+			return target.String(), nil
+		}
+	}
+
+	return "", ErrInvalidReturnTo
+}
+
+// Scheme and host of FRONT_END_URL, the only origin login popups report back to
+func FrontEndOrigin() string {
+	frontEnd, err := url.Parse(configs.FrontEndURL)
+	if err != nil || frontEnd.Host == "" {
+		return strings.TrimSuffix(configs.FrontEndURL, "/")
+	}
+
+	return frontEnd.Scheme + "://" + frontEnd.Host
 }
 
-func Logout(ctx *gin.Context, store *sessions.CookieStore) {
+func Logout(ctx *gin.Context, store sessions.Store) {
 	session, err := store.Get(ctx.Request, "fictsu-session")
 	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
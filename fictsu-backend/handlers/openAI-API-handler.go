@@ -2,14 +2,16 @@ package handlers
 
 import (
 	"io"
-	"os"
 	"fmt"
+	"log"
+	"time"
 	"bytes"
 	"strconv"
+	"strings"
 	"net/http"
-	"encoding/json"
 	"github.com/gin-gonic/gin"
 
+	llm "github.com/Fictsu/Fictsu/llm"
 	db "github.com/Fictsu/Fictsu/database"
 	models "github.com/Fictsu/Fictsu/models"
 	configs "github.com/Fictsu/Fictsu/configs"
@@ -26,13 +28,23 @@ const (
 
 	OUTRO_TEXT string = " Always ensure your response aligns with these rules and maintains coherence and creativity."
 	INTRO_CHAR string = "Please generate a character in a T-pose based on this prompt, so the image can be used as a reference for future generation. The prompt is: '"
+
+	DEFAULT_IMAGE_SIZE        string = "1024x1024"
+	MAX_IMAGE_PROMPT_LENGTH   int    = 1000
+	MAX_CHARACTER_NAME_LENGTH int    = 255
+	MAX_GENERATED_IMAGE_SIZE  int64  = 20 << 20
+
+	IMAGE_DOWNLOAD_TIMEOUT time.Duration = 60 * time.Second
 )
 
-func AddHeader(request *http.Request) {
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Authorization", "Bearer " + configs.OpenAIKey)
-	request.Header.Add("OpenAI-Organization", configs.OpenAIOrgID)
-	request.Header.Add("OpenAI-Project", configs.OpenAIProjID)
+// Provider image URLs are temporary storage links, a stalled one should not hold the job until it times out
+var imageDownloadClient = &http.Client{Timeout: IMAGE_DOWNLOAD_TIMEOUT}
+
+// The sizes DALL-E 3 accepts
+var imageSizes = map[string]bool{
+	"1024x1024": true,
+	"1792x1024": true,
+	"1024x1792": true,
 }
 
 func OpenAICreateStoryline(ctx *gin.Context) {
@@ -42,171 +54,291 @@ func OpenAICreateStoryline(ctx *gin.Context) {
 		return
 	}
 
-	// Prepare OpenAI request payload
-	URL := "https://api.openai.com/v1/chat/completions"
-	promptMessage := fmt.Sprintf("%s '%s' %s", INTRO_TEXT, requestBody.Message, OUTRO_TEXT)
-
-	openAIRequest := map[string]interface{}{
-		"model": "gpt-4o",
-		"messages": []map[string]string{
+	userID := ctx.GetInt("ai_user_ID")
+	template := SelectPromptTemplate(models.PromptStoryline, userID)
+	promptMessage := RenderPromptTemplate(template, map[string]string{"message": requestBody.Message})
+	response, err := llm.Client.Chat(ctx.Request.Context(), llm.ChatRequest{
+		Model: PromptModel(template, configs.StorylineModel),
+		Messages: []llm.Message{
 			{
-				"role": "user",
-				"content": promptMessage,
+				Role: llm.RoleUser,
+				Content: promptMessage,
 			},
 		},
-	}
+		Temperature: template.Temperature,
+	})
 
-	// Convert request body to JSON
-	JSONBody, err := json.Marshal(openAIRequest)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to encode request"})
+		log.Printf("Error creating storyline: %v", err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "Failed to get a response from the AI provider"})
 		return
 	}
 
-	// Create new HTTP request
-	request, err := http.NewRequest("POST", URL, bytes.NewBuffer(JSONBody))
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create request"})
+	RecordAITemplateUsage(
+		userID,
+		models.AIFeatureStoryline,
+		template.ID,
+		response.Model,
+		response.Usage.Prompt_Tokens,
+		response.Usage.Completion_Tokens,
+		0,
+	)
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Received_Message": response.Content})
+}
+
+// Same as OpenAICreateStoryline, but relays the completion as Server-Sent Events while it is generated.
+// Events: "generation" with the stored ID, "delta" per chunk, then "done" or "error".
+// A client disconnect cancels the upstream request, whatever was generated until then is still saved.
+func OpenAIStreamStoryline(ctx *gin.Context) {
+	requestBody := models.OpenAIRequestBodyText{}
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
 		return
 	}
 
-	AddHeader(request)
-
-	// Send request to OpenAI
-	client := &http.Client{}
-	response, err := client.Do(request)
+	userID := ctx.GetInt("ai_user_ID")
+	template := SelectPromptTemplate(models.PromptStoryline, userID)
+	model := PromptModel(template, configs.StorylineModel)
+	generation, err := CreateAIGeneration(userID, models.AIFeatureStoryline, model, requestBody.Message)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to send request"})
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start generation"})
 		return
 	}
 
-	defer response.Body.Close()
+	StartEventStream(ctx)
+	ctx.SSEvent("generation", gin.H{"ID": generation.ID})
+	ctx.Writer.Flush()
 
-	// Read response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to read response"})
-		return
+	promptMessage := RenderPromptTemplate(template, map[string]string{"message": requestBody.Message})
+	response, status, err := RelayChatStream(ctx, llm.ChatRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{
+				Role: llm.RoleUser,
+				Content: promptMessage,
+			},
+		},
+		Temperature: template.Temperature,
+	})
+
+	if status == models.AIGenerationComplete || response.Content != "" {
+		RecordAITemplateUsage(
+			userID,
+			models.AIFeatureStoryline,
+			template.ID,
+			response.Model,
+			response.Usage.Prompt_Tokens,
+			response.Usage.Completion_Tokens,
+			0,
+		)
 	}
 
-	// Unmarshal OpenAI response
-	responseBody := models.OpenAIResponseBody{}
-	if err := json.Unmarshal(body, &responseBody); err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode response"})
+	FinishAIGeneration(generation.ID, response.Content, status)
+
+	switch status {
+	case models.AIGenerationComplete:
+		ctx.SSEvent("done", gin.H{"ID": generation.ID, "Content": response.Content})
+	case models.AIGenerationFailed:
+		log.Printf("Error streaming storyline: %v", err)
+		ctx.SSEvent("error", gin.H{"Error": "Failed to get a response from the AI provider"})
+	default:
+		// The client is gone, there is nobody left to write to
 		return
 	}
 
-	// Check if the response has choices
-	if len(responseBody.Choices) == 0 {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "No choices returned from OpenAI"})
-		return
+	ctx.Writer.Flush()
+}
+
+func StartEventStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+}
+
+// Forwards every chunk of the completion as a "delta" event and reports how the stream ended.
+// The response is never nil, so callers can always record usage and save what was generated.
+func RelayChatStream(ctx *gin.Context, request llm.ChatRequest) (*llm.ChatResponse, models.AIGenerationStatus, error) {
+	response, err := llm.Client.ChatStream(ctx.Request.Context(), request, func(delta string) error {
+		ctx.SSEvent("delta", gin.H{"Content": delta})
+		ctx.Writer.Flush()
+		return ctx.Request.Context().Err()
+	})
+
+	if response == nil {
+		response = &llm.ChatResponse{Model: request.Model}
+	}
+
+	// A cancelled stream never receives the final usage chunk, estimate it so disconnecting does not dodge the quota.
+	// A request that failed before anything was generated is not charged.
+	if response.Usage.Prompt_Tokens == 0 && response.Usage.Completion_Tokens == 0 && response.Content != "" {
+		prompt := ""
+		for _, message := range request.Messages {
+			prompt += message.Content
+		}
+
+		response.Usage = llm.EstimateUsage(prompt, response.Content)
 	}
 
-	ctx.IndentedJSON(http.StatusOK, gin.H{"Received_Message": responseBody.Choices[0].Message.Content})
+	status := models.AIGenerationComplete
+	if ctx.Request.Context().Err() != nil {
+		status = models.AIGenerationCancelled
+	} else if err != nil {
+		status = models.AIGenerationFailed
+	}
+
+	return response, status, err
 }
 
+// Generates a reference image of a character for the fiction and adds it to the fiction's character gallery
 func OpenAICreateCharacter(ctx *gin.Context) {
+	fictionID := ctx.Param("fictionID")
+	userID := ctx.GetInt("ai_user_ID")
+	if !CheckFictionOwner(ctx, fictionID, userID, "add characters to this fiction") {
+		return
+	}
+
 	requestBody := models.OpenAIRequestBodyTextToImage{}
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
 		return
 	}
 
-	URL := "https://api.openai.com/v1/images/generations"
-	promptMessage := INTRO_CHAR + "'" + requestBody.Message + "'"
-
-	openAIRequest := map[string]interface{}{
-		"model": "dall-e-3",
-		"prompt": promptMessage,
-		"n": 1,
-		"size": requestBody.Size,
+	requestBody.Name = strings.TrimSpace(requestBody.Name)
+	requestBody.Message = strings.TrimSpace(requestBody.Message)
+	if requestBody.Name == "" || len(requestBody.Name) > MAX_CHARACTER_NAME_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Name must be between 1 and " + strconv.Itoa(MAX_CHARACTER_NAME_LENGTH) + " characters"})
+		return
 	}
 
-	// Convert request body to JSON
-	JSONBody, err := json.Marshal(openAIRequest)
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to encode request"})
+	if requestBody.Message == "" || len(requestBody.Message) > MAX_IMAGE_PROMPT_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Message must be between 1 and " + strconv.Itoa(MAX_IMAGE_PROMPT_LENGTH) + " characters"})
 		return
 	}
 
-	// Create new HTTP request
-	request, err := http.NewRequest("POST", URL, bytes.NewBuffer(JSONBody))
-	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create request"})
+	if requestBody.Size == "" {
+		requestBody.Size = DEFAULT_IMAGE_SIZE
+	}
+
+	if !imageSizes[requestBody.Size] {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Size must be one of 1024x1024, 1792x1024 or 1024x1792"})
 		return
 	}
 
-	AddHeader(request)
+	fictionIDInt, _ := strconv.Atoi(fictionID)
+	template := SelectPromptTemplate(models.PromptCharacter, userID)
+	promptMessage := RenderPromptTemplate(template, FictionPromptVariables(fictionIDInt, requestBody.Message))
+	response, err := llm.Client.GenerateImage(ctx.Request.Context(), llm.ImageRequest{
+		Model: PromptModel(template, configs.CharacterModel),
+		Prompt: promptMessage,
+		Size: requestBody.Size,
+	})
 
-	client := &http.Client{}
-	response, err := client.Do(request)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to send request"})
+		log.Printf("Error creating character: %v", err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "Failed to get a response from the AI provider"})
 		return
 	}
 
-	defer response.Body.Close()
+	RecordAITemplateUsage(userID, models.AIFeatureCharacter, template.ID, response.Model, 0, 0, 1)
 
-	body, err := io.ReadAll(response.Body)
+	image, contentType, err := FetchGeneratedImage(response)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to read response"})
+		log.Printf("Error fetching generated character: %v", err)
+		ctx.IndentedJSON(http.StatusBadGateway, gin.H{"Error": "Failed to download the generated image"})
 		return
 	}
 
-	responseBody := models.DalleImageResponse{}
-	if err := json.Unmarshal(body, &responseBody); err != nil {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode response"})
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save character"})
 		return
 	}
 
-	// Check if the response has Data
-	if len(responseBody.Data) == 0 {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "No choices returned from OpenAI"})
-		return
+	defer tx.Rollback()
+
+	// The row ID names the stored file, so concurrent generations never overwrite each other
+	character := models.CharacterImageModel{
+		Name:   requestBody.Name,
+		Prompt: requestBody.Message,
 	}
 
-	var count int
-	db.DB.QueryRow(
+	err = tx.QueryRow(
 		`
-		SELECT
-			COUNT(*)
-		FROM
-			CharacterImage
+		INSERT INTO CharacterImage (Fiction_ID, Name, Ref, Prompt)
+		VALUES ($1, $2, '', $3)
+		RETURNING Fiction_ID, ID, Created
 		`,
-	).Scan(&count)
+		fictionID,
+		character.Name,
+		character.Prompt,
+	).Scan(
+		&character.Fiction_ID,
+		&character.ID,
+		&character.Created,
+	)
 
-	imageURL := responseBody.Data[0].URL
-	filePath := configs.CharImagePath + strconv.Itoa(count+1) + ".png"
-	err = DownloadImage(imageURL, filePath)
 	if err != nil {
-		fmt.Println("Error saving image:", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save character"})
 		return
 	}
 
-	fmt.Println("Image saved successfully to", filePath)
-}
-
-func DownloadImage(url, file_path string) error {
-	// Send GET request
-	response, err := http.Get(url)
+	character.Ref, err = UploadBytesToFirebase(bytes.NewReader(image), contentType, CharacterImagePath(character.Fiction_ID, character.ID), configs.BucketName)
 	if err != nil {
-		fmt.Println("Error getting response: ", err)
-		return err
+		log.Printf("Error uploading character: %v", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to upload character image"})
+		return
 	}
 
-	defer response.Body.Close()
+	if _, err := tx.Exec("UPDATE CharacterImage SET Ref = $1 WHERE ID = $2", character.Ref, character.ID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save character"})
+		return
+	}
 
-	// Create a file
-	file, err := os.Create(file_path)
-	if err != nil {
-		fmt.Println("Error creating file: ", err)
-		return err
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save character"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, character)
+}
+
+// Returns the image bytes whether the provider answered with inline data or a temporary URL
+func FetchGeneratedImage(response *llm.ImageResponse) ([]byte, string, error) {
+	image := response.Data
+	if image == nil {
+		if response.URL == "" {
+			return nil, "", fmt.Errorf("provider returned neither image data nor a URL")
+		}
+
+		download, err := imageDownloadClient.Get(response.URL)
+		if err != nil {
+			return nil, "", err
+		}
+
+		defer download.Body.Close()
+
+		if download.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("image download returned %d", download.StatusCode)
+		}
+
+		// Reads one byte past the limit so an oversized image is refused instead of cut short
+		image, err = io.ReadAll(io.LimitReader(download.Body, MAX_GENERATED_IMAGE_SIZE + 1))
+		if err != nil {
+			return nil, "", err
+		}
+
+		if int64(len(image)) > MAX_GENERATED_IMAGE_SIZE {
+			return nil, "", fmt.Errorf("generated image is larger than %d bytes", MAX_GENERATED_IMAGE_SIZE)
+		}
 	}
 
-	defer file.Close()
+	contentType := http.DetectContentType(image)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("generated file is not an image: %s", contentType)
+	}
 
-	// Copy the image data to the file
-	_, err = io.Copy(file, response.Body)
-	fmt.Println("Error copying file: ", err)
-	return err
+	return image, contentType, nil
 }
@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"time"
+	"regexp"
+	"strconv"
+	"strings"
+	"net/http"
+	"hash/fnv"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_PROMPT_TEMPLATE_LENGTH int     = 20000
+	MAX_PROMPT_TEMPERATURE     float64 = 2
+)
+
+// Used while no stored version of a key has a weight, they are the prompts the features shipped with
+var DefaultPromptTemplates = map[models.PromptTemplateKey]string{
+	models.PromptStoryline: INTRO_TEXT + " '{{message}}' " + OUTRO_TEXT,
+	models.PromptAssistant: INTRO_TEXT + OUTRO_TEXT,
+	models.PromptCharacter: INTRO_CHAR + "{{message}}'",
+}
+
+// Every template can use these, the ones a feature does not know are left empty
+var PromptTemplateVariables = map[string]bool{
+	"fiction_title": true,
+	"genres":        true,
+	"message":       true,
+}
+
+var PromptVariablePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Picks the version of the key a user gets, weighted by Weight. The pick only depends on the user and the
+// active versions, so a user keeps the same version for as long as the rollout does not change.
+func SelectPromptTemplate(key models.PromptTemplateKey, userID int) models.PromptTemplateModel {
+	fallback := models.PromptTemplateModel{Key: key, Body: DefaultPromptTemplates[key]}
+	templates, err := GetPromptTemplates(key, true)
+	if err != nil {
+		log.Printf("Error fetching prompt templates for %s: %v", key, err)
+		return fallback
+	}
+
+	totalWeight := 0
+	for _, template := range templates {
+		totalWeight += template.Weight
+	}
+
+	if totalWeight == 0 {
+		return fallback
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(string(key) + ":" + strconv.Itoa(userID)))
+	pick := int(hash.Sum32() % uint32(totalWeight))
+	for _, template := range templates {
+		if pick < template.Weight {
+			return template
+		}
+
+		pick -= template.Weight
+	}
+
+	return fallback
+}
+
+// Replaces every {{variable}} in the body, unknown or missing variables become empty
+func RenderPromptTemplate(template models.PromptTemplateModel, variables map[string]string) string {
+	return PromptVariablePattern.ReplaceAllStringFunc(template.Body, func(placeholder string) string {
+		return variables[PromptVariablePattern.FindStringSubmatch(placeholder)[1]]
+	})
+}
+
+// The template's model when it sets one, otherwise the feature's configured model
+func PromptModel(template models.PromptTemplateModel, fallback string) string {
+	if template.Model != "" {
+		return template.Model
+	}
+
+	return fallback
+}
+
+// Title and genres of the fiction for the template variables, a missing fiction leaves them empty
+func FictionPromptVariables(fictionID int, message string) map[string]string {
+	variables := map[string]string{"message": message}
+
+	var title string
+	if err := db.DB.QueryRow("SELECT Title FROM Fictions WHERE ID = $1", fictionID).Scan(&title); err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching fiction %d for a prompt: %v", fictionID, err)
+		}
+
+		return variables
+	}
+
+	genres, err := GetAllGenres(strconv.Itoa(fictionID))
+	if err != nil {
+		log.Printf("Error fetching genres of fiction %d for a prompt: %v", fictionID, err)
+	}
+
+	genreNames := []string{}
+	for _, genre := range genres {
+		genreNames = append(genreNames, genre.Genre_Name)
+	}
+
+	variables["fiction_title"] = title
+	variables["genres"] = strings.Join(genreNames, ", ")
+	return variables
+}
+
+// activeOnly leaves out versions with no weight
+func GetPromptTemplates(key models.PromptTemplateKey, activeOnly bool) ([]models.PromptTemplateModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Key, Version, Body, Model, Temperature, Weight, Notes, Created_By, Created
+		FROM
+			PromptTemplates
+		WHERE
+			($1 = '' OR Key = $1) AND (NOT $2 OR Weight > 0)
+		ORDER BY Key, Version
+		`,
+		key,
+		activeOnly,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	templates := []models.PromptTemplateModel{}
+	for rows.Next() {
+		template, err := ScanPromptTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, *template)
+	}
+
+	return templates, nil
+}
+
+func ScanPromptTemplate(row interface{ Scan(...interface{}) error }) (*models.PromptTemplateModel, error) {
+	template := models.PromptTemplateModel{}
+	var temperature sql.NullFloat64
+	var createdBy sql.NullInt64
+	if err := row.Scan(
+		&template.ID,
+		&template.Key,
+		&template.Version,
+		&template.Body,
+		&template.Model,
+		&temperature,
+		&template.Weight,
+		&template.Notes,
+		&createdBy,
+		&template.Created,
+	); err != nil {
+		return nil, err
+	}
+
+	if temperature.Valid {
+		template.Temperature = &temperature.Float64
+	}
+
+	if createdBy.Valid {
+		ID := int(createdBy.Int64)
+		template.Created_By = &ID
+	}
+
+	return &template, nil
+}
+
+// ?key= narrows the list down to one feature, the built-in defaults are listed as version 0
+func GetPromptTemplatesAdmin(ctx *gin.Context, store sessions.Store) {
+	if !CheckPromptTemplateAdmin(ctx, store, "view prompt templates") {
+		return
+	}
+
+	key := models.PromptTemplateKey(ctx.Query("key"))
+	if _, ok := DefaultPromptTemplates[key]; key != "" && !ok {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown prompt template key"})
+		return
+	}
+
+	templates, err := GetPromptTemplates(key, false)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch prompt templates"})
+		return
+	}
+
+	defaults := []models.PromptTemplateModel{}
+	for defaultKey, body := range DefaultPromptTemplates {
+		if key == "" || key == defaultKey {
+			defaults = append(defaults, models.PromptTemplateModel{Key: defaultKey, Body: body})
+		}
+	}
+
+	sort.Slice(defaults, func(i, j int) bool {
+		return defaults[i].Key < defaults[j].Key
+	})
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Defaults": defaults, "Templates": templates})
+}
+
+// Saves the body as the next version of the key, a weight of 0 keeps it as a draft
+func CreatePromptTemplate(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	if !CheckSuperUser(ctx, IDFromSession.(int), "edit prompt templates") {
+		return
+	}
+
+	templateForm := models.PromptTemplateForm{}
+	if err := ctx.ShouldBindJSON(&templateForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if _, ok := DefaultPromptTemplates[templateForm.Key]; !ok {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown prompt template key"})
+		return
+	}
+
+	templateForm.Body = strings.TrimSpace(templateForm.Body)
+	if templateForm.Body == "" || len(templateForm.Body) > MAX_PROMPT_TEMPLATE_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Body must be between 1 and " + strconv.Itoa(MAX_PROMPT_TEMPLATE_LENGTH) + " characters"})
+		return
+	}
+
+	for _, match := range PromptVariablePattern.FindAllStringSubmatch(templateForm.Body, -1) {
+		if !PromptTemplateVariables[match[1]] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown variable {{" + match[1] + "}}, use fiction_title, genres or message"})
+			return
+		}
+	}
+
+	templateForm.Model = strings.TrimSpace(templateForm.Model)
+	if len(templateForm.Model) > 100 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Model must be at most 100 characters"})
+		return
+	}
+
+	if templateForm.Temperature != nil && (*templateForm.Temperature < 0 || *templateForm.Temperature > MAX_PROMPT_TEMPERATURE) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Temperature must be between 0 and 2"})
+		return
+	}
+
+	if templateForm.Weight < 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Weight must not be negative"})
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		INSERT INTO PromptTemplates (Key, Version, Body, Model, Temperature, Weight, Notes, Created_By)
+		SELECT
+			$1, COALESCE(MAX(Version), 0) + 1, $2, $3, $4, $5, $6, $7
+		FROM
+			PromptTemplates
+		WHERE
+			Key = $1
+		RETURNING ID, Key, Version, Body, Model, Temperature, Weight, Notes, Created_By, Created
+		`,
+		templateForm.Key,
+		templateForm.Body,
+		templateForm.Model,
+		templateForm.Temperature,
+		templateForm.Weight,
+		strings.TrimSpace(templateForm.Notes),
+		IDFromSession.(int),
+	)
+
+	template, err := ScanPromptTemplate(row)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create prompt template"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, template)
+}
+
+// Only the rollout can change, a different prompt is a new version
+func EditPromptTemplate(ctx *gin.Context, store sessions.Store) {
+	if !CheckPromptTemplateAdmin(ctx, store, "edit prompt templates") {
+		return
+	}
+
+	rolloutForm := models.PromptTemplateRolloutForm{}
+	if err := ctx.ShouldBindJSON(&rolloutForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if rolloutForm.Weight == nil && rolloutForm.Notes == nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No valid fields provided for update"})
+		return
+	}
+
+	if rolloutForm.Weight != nil && *rolloutForm.Weight < 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Weight must not be negative"})
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		UPDATE PromptTemplates
+		SET Weight = COALESCE($1, Weight), Notes = COALESCE($2, Notes)
+		WHERE ID = $3
+		RETURNING ID, Key, Version, Body, Model, Temperature, Weight, Notes, Created_By, Created
+		`,
+		rolloutForm.Weight,
+		rolloutForm.Notes,
+		ctx.Param("templateID"),
+	)
+
+	template, err := ScanPromptTemplate(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Prompt template not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update prompt template"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, template)
+}
+
+// Usage per template version between ?from= and ?to=, requests made with the built-in default are reported as version 0
+func GetPromptTemplateReport(ctx *gin.Context, store sessions.Store) {
+	if !CheckPromptTemplateAdmin(ctx, store, "view the prompt template report") {
+		return
+	}
+
+	to := StartOfAIDay(time.Now())
+	from := to.AddDate(0, 0, -(DEFAULT_AI_USAGE_HISTORY_DAYS - 1))
+	if rawFrom := ctx.Query("from"); rawFrom != "" {
+		parsedFrom, err := time.Parse("2006-01-02", rawFrom)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+
+		from = parsedFrom
+	}
+
+	if rawTo := ctx.Query("to"); rawTo != "" {
+		parsedTo, err := time.Parse("2006-01-02", rawTo)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+
+		to = parsedTo
+	}
+
+	if to.Before(from) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "to must not be before from"})
+		return
+	}
+
+	keys := []string{}
+	for key := range DefaultPromptTemplates {
+		if ctx.Query("key") == "" || ctx.Query("key") == string(key) {
+			keys = append(keys, string(key))
+		}
+	}
+
+	if len(keys) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown prompt template key"})
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			PT.ID, COALESCE(PT.Key, U.Feature), COALESCE(PT.Version, 0), COALESCE(PT.Weight, 0),
+			COUNT(U.ID), COUNT(DISTINCT U.User_ID),
+			COALESCE(SUM(U.Prompt_Tokens), 0), COALESCE(SUM(U.Completion_Tokens), 0), COALESCE(SUM(U.Cost), 0),
+			COALESCE(AVG(U.Completion_Tokens), 0)
+		FROM
+			AIUsage U
+		LEFT JOIN
+			PromptTemplates PT
+		ON
+			PT.ID = U.Template_ID
+		WHERE
+			U.Feature = ANY($1) AND U.Created >= $2 AND U.Created < $3
+		GROUP BY PT.ID, COALESCE(PT.Key, U.Feature), COALESCE(PT.Version, 0), COALESCE(PT.Weight, 0)
+		ORDER BY COALESCE(PT.Key, U.Feature), COALESCE(PT.Version, 0)
+		`,
+		pq.Array(keys),
+		from,
+		to.AddDate(0, 0, 1),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch prompt template report"})
+		return
+	}
+
+	defer rows.Close()
+	report := models.PromptTemplateReport{From: from, To: to, Templates: []models.PromptTemplateUsage{}}
+	for rows.Next() {
+		usage := models.PromptTemplateUsage{}
+		var templateID sql.NullInt64
+		if err := rows.Scan(
+			&templateID,
+			&usage.Key,
+			&usage.Version,
+			&usage.Weight,
+			&usage.Requests,
+			&usage.Users,
+			&usage.Prompt_Tokens,
+			&usage.Completion_Tokens,
+			&usage.Cost,
+			&usage.Avg_Completion_Tokens,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing prompt template report"})
+			return
+		}
+
+		if templateID.Valid {
+			ID := int(templateID.Int64)
+			usage.Template_ID = &ID
+		}
+
+		report.Templates = append(report.Templates, usage)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// Session and super user check for the admin endpoints, writes the error response itself when it returns false
+func CheckPromptTemplateAdmin(ctx *gin.Context, store sessions.Store, action string) bool {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return false
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return false
+	}
+
+	return CheckSuperUser(ctx, IDFromSession.(int), action)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log"
+	"time"
+	"strconv"
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+)
+
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+var (
+	RateLimitAI        = RateLimitPolicy{Name: "ai", Limit: 10, Window: time.Minute}
+	RateLimitUploads   = RateLimitPolicy{Name: "uploads", Limit: 10, Window: time.Minute}
+	RateLimitDownloads = RateLimitPolicy{Name: "downloads", Limit: 5, Window: time.Minute}
+	RateLimitWrites    = RateLimitPolicy{Name: "writes", Limit: 60, Window: time.Minute}
+	RateLimitReads     = RateLimitPolicy{Name: "reads", Limit: 300, Window: time.Minute}
+)
+
+// Counts the request against the policy, keyed by user ID when logged in and by client IP otherwise.
+// Policies stack, a route behind several of them has to stay within all of them.
+func RateLimit(limiter db.RateLimiter, store sessions.Store, policy RateLimitPolicy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !CheckRateLimit(ctx, limiter, store, policy) {
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// Safe methods are counted against the read policy, everything else against the write policy
+func RateLimitByMethod(limiter db.RateLimiter, store sessions.Store, readPolicy RateLimitPolicy, writePolicy RateLimitPolicy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := writePolicy
+		if IsSafeMethod(ctx.Request.Method) {
+			policy = readPolicy
+		}
+
+		if !CheckRateLimit(ctx, limiter, store, policy) {
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// Sets the RateLimit-* headers, aborts with 429 and returns false once the limit is exceeded
+func CheckRateLimit(ctx *gin.Context, limiter db.RateLimiter, store sessions.Store, policy RateLimitPolicy) bool {
+	// Preflight requests are answered by CORS and never reach a handler
+	if ctx.Request.Method == http.MethodOptions {
+		return true
+	}
+
+	result, err := limiter.Hit(policy.Name + ":" + RateLimitKey(ctx, store), policy.Window)
+	if err != nil {
+		// A broken limiter must not take the whole API down with it
+		log.Printf("Error checking rate limit: %v", err)
+		return true
+	}
+
+	resetSeconds := int(time.Until(result.Reset).Seconds()) + 1
+	remaining := max(policy.Limit - result.Count, 0)
+	ctx.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(resetSeconds))
+	ctx.Header("RateLimit-Policy", strconv.Itoa(policy.Limit) + ";w=" + strconv.Itoa(int(policy.Window.Seconds())))
+
+	if result.Count > policy.Limit {
+		ctx.Header("Retry-After", strconv.Itoa(resetSeconds))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"Error": "Too many requests. Please slow down and try again later."})
+		return false
+	}
+
+	return true
+}
+
+func RateLimitKey(ctx *gin.Context, store sessions.Store) string {
+	if tokenUserID, isTokenRequest := ctx.Get("token_user_ID"); isTokenRequest {
+		return "user:" + strconv.Itoa(tokenUserID.(int))
+	}
+
+	// Skip the session lookup entirely for requests without a session cookie
+	if _, err := ctx.Cookie("fictsu-session"); err == nil {
+		if session, err := store.Get(ctx.Request, "fictsu-session"); err == nil {
+			if ID, ok := session.Values["ID"].(int); ok {
+				return "user:" + strconv.Itoa(ID)
+			}
+		}
+	}
+
+	return "ip:" + ctx.ClientIP()
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"log"
+	"html"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	llm "github.com/Fictsu/Fictsu/llm"
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	INTRO_BG string = "Please generate a background illustration of a scene from a story, without any text, captions or speech bubbles. The scene is: '"
+
+	// How much of the chapter is used to seed the prompt, image models only read a short prompt
+	MAX_SCENE_SEED_LENGTH int = 1500
+)
+
+// Starts an async job that generates a scene image for the fiction, poll GET /ai/jobs/:jobID for the result
+func OpenAICreateSceneImage(ctx *gin.Context) {
+	fictionID, err := strconv.Atoi(ctx.Param("fictionID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+		return
+	}
+
+	userID := ctx.GetInt("ai_user_ID")
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), userID, "generate scenes for this fiction") {
+		return
+	}
+
+	sceneForm := models.SceneImageForm{}
+	if err := ctx.ShouldBindJSON(&sceneForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	sceneForm.Prompt = strings.TrimSpace(sceneForm.Prompt)
+	if len(sceneForm.Prompt) > MAX_IMAGE_PROMPT_LENGTH || (sceneForm.Prompt == "" && !sceneForm.Seed_From_Chapter) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Prompt must be between 1 and " + strconv.Itoa(MAX_IMAGE_PROMPT_LENGTH) + " characters"})
+		return
+	}
+
+	if sceneForm.Size == "" {
+		sceneForm.Size = DEFAULT_IMAGE_SIZE
+	}
+
+	if !imageSizes[sceneForm.Size] {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Size must be one of 1024x1024, 1792x1024 or 1024x1792"})
+		return
+	}
+
+	if sceneForm.Seed_From_Chapter && sceneForm.Chapter_ID == nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "seed_from_chapter requires a chapter_id"})
+		return
+	}
+
+	// The prompt is built now so the job does not depend on later edits of the chapter
+	prompt := sceneForm.Prompt
+	if sceneForm.Chapter_ID != nil {
+		var content string
+		err := db.DB.QueryRow(
+			`
+			SELECT
+				COALESCE(Content, '')
+			FROM
+				Chapters
+			WHERE
+				Fiction_ID = $1 AND ID = $2
+			`,
+			fictionID,
+			*sceneForm.Chapter_ID,
+		).Scan(
+			&content,
+		)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+			} else {
+				ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+			}
+
+			return
+		}
+
+		if sceneForm.Seed_From_Chapter {
+			seed := TruncateText(StripHTML(content), MAX_SCENE_SEED_LENGTH)
+			prompt = strings.TrimSpace(prompt + "\n\nBased on this passage: " + seed)
+		}
+	}
+
+	job, err := StartAIJob(userID, fictionID, models.AIJobBackground, sceneForm, func(jobCtx context.Context, job *models.AIJobModel) (interface{}, error) {
+		return GenerateSceneImage(jobCtx, job, sceneForm, prompt)
+	})
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start generation"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusAccepted, job)
+}
+
+// Runs inside the job: generates the image, stores it and records it in SceneImages
+func GenerateSceneImage(ctx context.Context, job *models.AIJobModel, sceneForm models.SceneImageForm, prompt string) (*models.SceneImageModel, error) {
+	response, err := llm.Client.GenerateImage(ctx, llm.ImageRequest{
+		Model: configs.BackgroundModel,
+		Prompt: INTRO_BG + prompt + "'",
+		Size: sceneForm.Size,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	RecordAIUsage(job.User_ID, models.AIFeatureBackground, response.Model, 0, 0, 1)
+
+	image, contentType, err := FetchGeneratedImage(response)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	scene := models.SceneImageModel{
+		Fiction_ID: job.Fiction_ID,
+		Chapter_ID: sceneForm.Chapter_ID,
+		Job_ID:     job.ID,
+		Prompt:     prompt,
+		Size:       sceneForm.Size,
+	}
+
+	err = tx.QueryRow(
+		`
+		INSERT INTO SceneImages (Fiction_ID, Chapter_ID, Job_ID, Ref, Prompt, Size)
+		VALUES ($1, $2, $3, '', $4, $5)
+		RETURNING ID, Created
+		`,
+		scene.Fiction_ID,
+		scene.Chapter_ID,
+		scene.Job_ID,
+		scene.Prompt,
+		scene.Size,
+	).Scan(
+		&scene.ID,
+		&scene.Created,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scene.Ref, err = UploadBytesToFirebase(bytes.NewReader(image), contentType, SceneImagePath(scene.Fiction_ID, scene.ID), configs.BucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE SceneImages SET Ref = $1 WHERE ID = $2", scene.Ref, scene.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &scene, nil
+}
+
+// ?chapter_id= limits the list to the scenes generated for one chapter
+func GetSceneImages(ctx *gin.Context) {
+	var chapterID interface{}
+	if rawChapterID := ctx.Query("chapter_id"); rawChapterID != "" {
+		parsedChapterID, err := strconv.Atoi(rawChapterID)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid chapter ID"})
+			return
+		}
+
+		chapterID = parsedChapterID
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Chapter_ID, COALESCE(Job_ID, 0), Ref, Prompt, Size, Created
+		FROM
+			SceneImages
+		WHERE
+			Fiction_ID = $1 AND ($2::INT IS NULL OR Chapter_ID = $2)
+		ORDER BY ID
+		`,
+		ctx.Param("fictionID"),
+		chapterID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch scenes"})
+		return
+	}
+
+	defer rows.Close()
+	scenes := []models.SceneImageModel{}
+	for rows.Next() {
+		scene := models.SceneImageModel{}
+		var sceneChapterID sql.NullInt64
+		if err := rows.Scan(
+			&scene.ID,
+			&scene.Fiction_ID,
+			&sceneChapterID,
+			&scene.Job_ID,
+			&scene.Ref,
+			&scene.Prompt,
+			&scene.Size,
+			&scene.Created,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing scenes"})
+			return
+		}
+
+		if sceneChapterID.Valid {
+			ID := int(sceneChapterID.Int64)
+			scene.Chapter_ID = &ID
+		}
+
+		scenes = append(scenes, scene)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, scenes)
+}
+
+// Puts the scene image into the chapter after the given paragraph, or at the end when no position is given
+func InsertSceneImage(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit a chapter."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	chapterID := ctx.Param("chapterID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit chapters of this fiction") {
+		return
+	}
+
+	insertForm := models.SceneImageInsertForm{}
+	if err := ctx.ShouldBindJSON(&insertForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	var ref string
+	var prompt string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Ref, Prompt
+		FROM
+			SceneImages
+		WHERE
+			ID = $1 AND Fiction_ID = $2 AND Ref != ''
+		`,
+		ctx.Param("sceneID"),
+		fictionID,
+	).Scan(
+		&ref,
+		&prompt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Scene not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch scene"})
+		}
+
+		return
+	}
+
+	var content string
+	err = db.DB.QueryRow(
+		`
+		SELECT
+			COALESCE(Content, '')
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = $2
+		`,
+		fictionID,
+		chapterID,
+	).Scan(
+		&content,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve chapter"})
+		}
+
+		return
+	}
+
+	alt := strings.TrimSpace(insertForm.Alt)
+	if alt == "" {
+		alt = TruncateText(prompt, 255)
+	}
+
+	imageHTML := `<p><img src="` + html.EscapeString(ref) + `" alt="` + html.EscapeString(alt) + `"></p>`
+	content = InsertAfterParagraph(content, imageHTML, insertForm.Position)
+
+	if err := SaveChapterUpdate(fictionID, chapterID, "", content); err != nil {
+		if err == ErrChapterNotFound {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update chapter"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Scene inserted", "Content": content})
+}
+
+func DeleteSceneImage(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to delete scenes."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "delete scenes of this fiction") {
+		return
+	}
+
+	var deletedFictionID int
+	var deletedID int
+	err := db.DB.QueryRow(
+		`
+		DELETE FROM SceneImages
+		WHERE Fiction_ID = $1 AND ID = $2
+		RETURNING Fiction_ID, ID
+		`,
+		fictionID,
+		ctx.Param("sceneID"),
+	).Scan(
+		&deletedFictionID,
+		&deletedID,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Scene not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete scene"})
+		}
+
+		return
+	}
+
+	// Chapters that already embed the image keep a broken link, the author removed it on purpose
+	if err := DeleteImageFromFirebase(SceneImagePath(deletedFictionID, deletedID), configs.BucketName); err != nil {
+		log.Printf("Error deleting scene image: %v", err)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Scene deleted"})
+}
+
+// Inserts the snippet after the given number of paragraphs, nil or a position past the end appends it
+func InsertAfterParagraph(content string, snippet string, position *int) string {
+	if position == nil || *position < 0 {
+		return content + snippet
+	}
+
+	offset := 0
+	for paragraph := 0; paragraph < *position; paragraph++ {
+		end := strings.Index(content[offset:], "</p>")
+		if end == -1 {
+			return content + snippet
+		}
+
+		offset += end + len("</p>")
+	}
+
+	return content[:offset] + snippet + content[offset:]
+}
+
+func SceneImagePath(fictionID int, sceneID int) string {
+	return configs.BGImagePath + strconv.Itoa(fictionID) + "/" + strconv.Itoa(sceneID)
+}
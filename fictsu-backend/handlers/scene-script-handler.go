@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"net/url"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_SCENE_STEPS         int = 5000
+	MAX_SCENE_ASSETS        int = 100
+	MAX_SCENE_SPRITES       int = 30
+	MAX_SCENE_NAME_LENGTH   int = 100
+	MAX_SCENE_TEXT_LENGTH   int = 5000
+	MAX_SCENE_CHOICES       int = 10
+	MAX_SCENE_SCRIPT_ERRORS int = 20
+)
+
+var SceneKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,50}$`)
+var SceneColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+var scenePositions = map[string]bool{"left": true, "center": true, "right": true}
+var sceneTransitions = map[string]bool{"": true, "cut": true, "fade": true, "dissolve": true}
+
+// Serves the structured script of a scene chapter to the visual-novel player, text chapters have none
+func GetChapterScript(ctx *gin.Context) {
+	var script []byte
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Script
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND ID = $2 AND Format = 'scene'
+		`,
+		ctx.Param("fictionID"),
+		ctx.Param("chapterID"),
+	).Scan(
+		&script,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Scene chapter not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve scene script"})
+		}
+
+		return
+	}
+
+	sceneScript := models.SceneScriptModel{}
+	if err := json.Unmarshal(script, &sceneScript); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve scene script"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, sceneScript)
+}
+
+// Settles the format of a chapter being created or edited. A scene script is validated and rendered into Content
+// as the plain-text fallback, so readers, search and the AI tools keep working on scene chapters.
+// Returns the script to store, nil for the other formats, and writes the error response itself when it returns false.
+func PrepareChapterFormat(ctx *gin.Context, chapter *models.ChapterModel) (interface{}, bool) {
+	if chapter.Script != nil && chapter.Format == "" {
+		chapter.Format = models.ChapterScene
+	}
+
+	switch chapter.Format {
+	case "", models.ChapterText, models.ChapterPages:
+		if chapter.Script != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Only scene chapters can have a scene script"})
+			return nil, false
+		}
+
+		if chapter.Format == "" {
+			chapter.Format = models.ChapterText
+		}
+
+		return nil, true
+	case models.ChapterScene:
+		if chapter.Script == nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Scene chapters need a script"})
+			return nil, false
+		}
+	default:
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Format must be text, scene or pages"})
+		return nil, false
+	}
+
+	if problems := ValidateSceneScript(chapter.Script); len(problems) > 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid scene script", "Problems": problems})
+		return nil, false
+	}
+
+	script, err := json.Marshal(chapter.Script)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid scene script"})
+		return nil, false
+	}
+
+	chapter.Content = RenderSceneScript(chapter.Script)
+	return string(script), true
+}
+
+// Returns the stored title for the webhook the caller sends once its transaction commits
+func SaveChapterFormat(querier Querier, fictionID string, chapterID string, format models.ChapterFormat, script interface{}) (string, error) {
+	var storedTitle string
+	err := querier.QueryRow(
+		`
+		UPDATE Chapters
+		SET Format = $1, Script = $2::JSONB
+		WHERE Fiction_ID = $3 AND ID = $4
+		RETURNING Title
+		`,
+		format,
+		script,
+		fictionID,
+		chapterID,
+	).Scan(
+		&storedTitle,
+	)
+
+	if err == sql.ErrNoRows {
+		return "", ErrChapterNotFound
+	}
+
+	return storedTitle, err
+}
+
+// Lists every problem found, up to MAX_SCENE_SCRIPT_ERRORS, so the editor can show them all at once
+func ValidateSceneScript(script *models.SceneScriptModel) []string {
+	problems := []string{}
+	report := func(format string, args ...interface{}) {
+		if len(problems) < MAX_SCENE_SCRIPT_ERRORS {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	if len(script.Steps) == 0 || len(script.Steps) > MAX_SCENE_STEPS {
+		report("a script must have between 1 and %d steps", MAX_SCENE_STEPS)
+	}
+
+	if len(script.Backgrounds) > MAX_SCENE_ASSETS || len(script.Characters) > MAX_SCENE_ASSETS {
+		report("a script can have at most %d backgrounds and %d characters", MAX_SCENE_ASSETS, MAX_SCENE_ASSETS)
+	}
+
+	for key, background := range script.Backgrounds {
+		if !SceneKeyPattern.MatchString(key) {
+			report("background %q: keys may only use letters, digits, _ and -", key)
+		}
+
+		if len([]rune(background.Name)) > MAX_SCENE_NAME_LENGTH {
+			report("background %q: name must be at most %d characters", key, MAX_SCENE_NAME_LENGTH)
+		}
+
+		if !IsImageURL(background.Image) {
+			report("background %q: image must be an http or https URL", key)
+		}
+	}
+
+	for key, character := range script.Characters {
+		if !SceneKeyPattern.MatchString(key) {
+			report("character %q: keys may only use letters, digits, _ and -", key)
+		}
+
+		if strings.TrimSpace(character.Name) == "" || len([]rune(character.Name)) > MAX_SCENE_NAME_LENGTH {
+			report("character %q: name must be between 1 and %d characters", key, MAX_SCENE_NAME_LENGTH)
+		}
+
+		if character.Color != "" && !SceneColorPattern.MatchString(character.Color) {
+			report("character %q: color must look like #RRGGBB", key)
+		}
+
+		if len(character.Sprites) > MAX_SCENE_SPRITES {
+			report("character %q: at most %d sprites", key, MAX_SCENE_SPRITES)
+		}
+
+		for expression, image := range character.Sprites {
+			if !SceneKeyPattern.MatchString(expression) || !IsImageURL(image) {
+				report("character %q: sprite %q needs a simple name and an http or https image URL", key, expression)
+			}
+		}
+	}
+
+	labels := map[string]bool{}
+	for i, step := range script.Steps {
+		if step.Type == models.SceneLabel {
+			if !SceneKeyPattern.MatchString(step.Label) {
+				report("step %d: labels may only use letters, digits, _ and -", i + 1)
+			} else if labels[step.Label] {
+				report("step %d: label %q is used twice", i + 1, step.Label)
+			}
+
+			labels[step.Label] = true
+		}
+	}
+
+	for i, step := range script.Steps {
+		position := i + 1
+		switch step.Type {
+		case models.SceneBackground:
+			if _, ok := script.Backgrounds[step.Background]; !ok {
+				report("step %d: unknown background %q", position, step.Background)
+			}
+
+			if !sceneTransitions[step.Transition] {
+				report("step %d: transition must be cut, fade or dissolve", position)
+			}
+		case models.SceneShow:
+			character, ok := script.Characters[step.Character]
+			if !ok {
+				report("step %d: unknown character %q", position, step.Character)
+				continue
+			}
+
+			expression := step.Expression
+			if expression == "" {
+				expression = "default"
+			}
+
+			if _, ok := character.Sprites[expression]; !ok {
+				report("step %d: character %q has no %q sprite", position, step.Character, expression)
+			}
+
+			if !scenePositions[step.Position] {
+				report("step %d: position must be left, center or right", position)
+			}
+
+			if !sceneTransitions[step.Transition] {
+				report("step %d: transition must be cut, fade or dissolve", position)
+			}
+		case models.SceneHide:
+			if _, ok := script.Characters[step.Character]; !ok {
+				report("step %d: unknown character %q", position, step.Character)
+			}
+		case models.SceneDialogue:
+			if _, ok := script.Characters[step.Speaker]; !ok {
+				report("step %d: unknown speaker %q", position, step.Speaker)
+			}
+
+			if strings.TrimSpace(step.Text) == "" || len([]rune(step.Text)) > MAX_SCENE_TEXT_LENGTH {
+				report("step %d: text must be between 1 and %d characters", position, MAX_SCENE_TEXT_LENGTH)
+			}
+		case models.SceneNarration:
+			if strings.TrimSpace(step.Text) == "" || len([]rune(step.Text)) > MAX_SCENE_TEXT_LENGTH {
+				report("step %d: text must be between 1 and %d characters", position, MAX_SCENE_TEXT_LENGTH)
+			}
+		case models.SceneChoice:
+			if len(step.Choices) == 0 || len(step.Choices) > MAX_SCENE_CHOICES {
+				report("step %d: a choice needs between 1 and %d options", position, MAX_SCENE_CHOICES)
+			}
+
+			for _, choice := range step.Choices {
+				if strings.TrimSpace(choice.Text) == "" || len([]rune(choice.Text)) > MAX_SCENE_NAME_LENGTH * 5 {
+					report("step %d: every option needs a text of at most %d characters", position, MAX_SCENE_NAME_LENGTH * 5)
+				}
+
+				if !labels[choice.Target] {
+					report("step %d: option %q jumps to unknown label %q", position, choice.Text, choice.Target)
+				}
+			}
+		case models.SceneJump:
+			if !labels[step.Target] {
+				report("step %d: unknown label %q", position, step.Target)
+			}
+		case models.SceneLabel:
+		default:
+			report("step %d: unknown step type %q", position, step.Type)
+		}
+	}
+
+	return problems
+}
+
+// The plain-text fallback reads the script top to bottom, staging steps are dropped and choices are listed
+func RenderSceneScript(script *models.SceneScriptModel) string {
+	lines := []string{}
+	for _, step := range script.Steps {
+		text := strings.Join(strings.Fields(step.Text), " ")
+		switch step.Type {
+		case models.SceneBackground:
+			if name := script.Backgrounds[step.Background].Name; name != "" {
+				lines = append(lines, "[" + name + "]")
+			}
+		case models.SceneDialogue:
+			lines = append(lines, script.Characters[step.Speaker].Name + ": " + text)
+		case models.SceneNarration:
+			lines = append(lines, text)
+		case models.SceneChoice:
+			for _, choice := range step.Choices {
+				lines = append(lines, "» " + strings.Join(strings.Fields(choice.Text), " "))
+			}
+		}
+	}
+
+	return ParagraphsToHTML(strings.Join(lines, "\n"))
+}
+
+func IsImageURL(rawURL string) bool {
+	imageURL, err := url.Parse(rawURL)
+	return err == nil && (imageURL.Scheme == "https" || imageURL.Scheme == "http") && imageURL.Host != "" && len(rawURL) <= MAX_CODEX_IMAGE_URL_LENGTH
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+// A script that passes validation, each case breaks one thing
+func validSceneScript() *models.SceneScriptModel {
+	return &models.SceneScriptModel{
+		Backgrounds: map[string]models.SceneBackgroundModel{
+			"hall": {Name: "Great hall", Image: "https://cdn.example.com/hall.png"},
+		},
+		Characters: map[string]models.SceneCharacterModel{
+			"mira": {
+				Name:    "Mira",
+				Color:   "#AA3366",
+				Sprites: map[string]string{"default": "https://cdn.example.com/mira.png"},
+			},
+		},
+		Steps: []models.SceneStepModel{
+			{Type: models.SceneBackground, Background: "hall", Transition: "fade"},
+			{Type: models.SceneShow, Character: "mira", Position: "left"},
+			{Type: models.SceneDialogue, Speaker: "mira", Text: "Stay or go?"},
+			{Type: models.SceneChoice, Choices: []models.SceneChoiceModel{{Text: "Stay", Target: "stay"}}},
+			{Type: models.SceneLabel, Label: "stay"},
+			{Type: models.SceneNarration, Text: "She stays."},
+			{Type: models.SceneHide, Character: "mira"},
+			{Type: models.SceneJump, Target: "stay"},
+		},
+	}
+}
+
+func TestValidateSceneScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(script *models.SceneScriptModel)
+		want   []string
+	}{
+		{
+			name:   "valid script",
+			modify: func(script *models.SceneScriptModel) {},
+			want:   []string{},
+		},
+		{
+			name:   "no steps",
+			modify: func(script *models.SceneScriptModel) { script.Steps = nil },
+			want:   []string{"a script must have between 1 and 5000 steps"},
+		},
+		{
+			name: "bad background key and image",
+			modify: func(script *models.SceneScriptModel) {
+				script.Backgrounds["bad key"] = models.SceneBackgroundModel{Name: "Yard", Image: "javascript:alert(1)"}
+			},
+			want: []string{
+				`background "bad key": keys may only use letters, digits, _ and -`,
+				`background "bad key": image must be an http or https URL`,
+			},
+		},
+		{
+			name: "bad character color",
+			modify: func(script *models.SceneScriptModel) {
+				mira := script.Characters["mira"]
+				mira.Color = "red"
+				script.Characters["mira"] = mira
+			},
+			want: []string{`character "mira": color must look like #RRGGBB`},
+		},
+		{
+			name: "unknown background",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[0].Background = "yard"
+			},
+			want: []string{`step 1: unknown background "yard"`},
+		},
+		{
+			name: "bad transition",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[0].Transition = "wipe"
+			},
+			want: []string{"step 1: transition must be cut, fade or dissolve"},
+		},
+		{
+			name: "missing sprite and bad position",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[1].Expression = "angry"
+				script.Steps[1].Position = "top"
+			},
+			want: []string{
+				`step 2: character "mira" has no "angry" sprite`,
+				"step 2: position must be left, center or right",
+			},
+		},
+		{
+			name: "unknown speaker and empty text",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[2].Speaker = "nobody"
+				script.Steps[2].Text = "   "
+			},
+			want: []string{
+				`step 3: unknown speaker "nobody"`,
+				"step 3: text must be between 1 and 5000 characters",
+			},
+		},
+		{
+			name: "choice to unknown label",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[3].Choices[0].Target = "leave"
+			},
+			want: []string{`step 4: option "Stay" jumps to unknown label "leave"`},
+		},
+		{
+			name: "choice without options",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[3].Choices = nil
+			},
+			want: []string{"step 4: a choice needs between 1 and 10 options"},
+		},
+		{
+			name: "duplicate label",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps = append(script.Steps, models.SceneStepModel{Type: models.SceneLabel, Label: "stay"})
+			},
+			want: []string{`step 9: label "stay" is used twice`},
+		},
+		{
+			name: "jump to unknown label",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[7].Target = "end"
+			},
+			want: []string{`step 8: unknown label "end"`},
+		},
+		{
+			name: "unknown step type",
+			modify: func(script *models.SceneScriptModel) {
+				script.Steps[5].Type = "shake"
+			},
+			want: []string{`step 6: unknown step type "shake"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := validSceneScript()
+			test.modify(script)
+			if got := ValidateSceneScript(script); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateSceneScriptCapsProblems(t *testing.T) {
+	script := validSceneScript()
+	for i := 0; i < MAX_SCENE_SCRIPT_ERRORS * 2; i++ {
+		script.Steps = append(script.Steps, models.SceneStepModel{Type: models.SceneJump, Target: "nowhere"})
+	}
+
+	if got := ValidateSceneScript(script); len(got) != MAX_SCENE_SCRIPT_ERRORS {
+		t.Fatalf("got %d problems, want %d", len(got), MAX_SCENE_SCRIPT_ERRORS)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+func GetActiveSessions(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, COALESCE(IP, ''), COALESCE(User_Agent, ''), Token_Hash = $2, Created, Last_Seen
+		FROM
+			Sessions
+		WHERE
+			User_ID = $1 AND Last_Seen > NOW() - $3 * INTERVAL '1 second' AND Created > NOW() - $4 * INTERVAL '1 second'
+		ORDER BY Last_Seen DESC
+		`,
+		IDFromSession.(int),
+		db.HashSessionToken(session.ID),
+		configs.SessionIdleTimeout.Seconds(),
+		configs.SessionAbsoluteTimeout.Seconds(),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch sessions"})
+		return
+	}
+
+	defer rows.Close()
+	activeSessions := []models.SessionModel{}
+	for rows.Next() {
+		activeSession := models.SessionModel{}
+		if err := rows.Scan(
+			&activeSession.ID,
+			&activeSession.IP,
+			&activeSession.User_Agent,
+			&activeSession.Current,
+			&activeSession.Created,
+			&activeSession.Last_Seen,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing sessions"})
+			return
+		}
+
+		activeSessions = append(activeSessions, activeSession)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, activeSessions)
+}
+
+func RevokeSession(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to revoke a session."})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		`
+		DELETE FROM
+			Sessions
+		WHERE
+			ID = $1 AND User_ID = $2
+		`,
+		ctx.Param("sessionID"),
+		IDFromSession.(int),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to revoke session"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Session not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Session revoked successfully"})
+}
+
+// Signs out every other device. Pass ?include_current=true to sign out this one as well.
+func RevokeAllSessions(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to revoke sessions."})
+		return
+	}
+
+	keepHash := db.HashSessionToken(session.ID)
+	includeCurrent := ctx.Query("include_current") == "true"
+	if includeCurrent {
+		keepHash = ""
+	}
+
+	result, err := db.DB.Exec(
+		`
+		DELETE FROM
+			Sessions
+		WHERE
+			User_ID = $1 AND Token_Hash <> $2
+		`,
+		IDFromSession.(int),
+		keepHash,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to revoke sessions"})
+		return
+	}
+
+	if includeCurrent {
+		session.Options.MaxAge = -1
+		session.Save(ctx.Request, ctx.Writer)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Sessions revoked successfully", "revoked": rowsAffected})
+}
@@ -0,0 +1,1159 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"errors"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	MAX_CALENDAR_NAME_LENGTH        int = 100
+	MAX_CALENDAR_ERA_LENGTH         int = 20
+	MAX_CALENDAR_MONTHS             int = 100
+	MAX_CALENDAR_MONTH_DAYS         int = 1000
+	MAX_TIMELINE_TITLE_LENGTH       int = 255
+	MAX_TIMELINE_DESCRIPTION_LENGTH int = 10000
+	MAX_TIMELINE_YEAR               int = 1000000000
+	MAX_TIMELINE_DURATION_DAYS      int = 1000000
+	MAX_TIMELINE_LINKS              int = 100
+)
+
+// Years, month lengths and the epoch offset are all bounded so a sort key stays far below the int64 limit,
+// the largest is about 1e9 years * 1e5 days + 1e15
+const MAX_CALENDAR_EPOCH_OFFSET int64 = 1000000000000000
+
+var ErrInvalidCalendarDate = errors.New("date does not exist in this calendar")
+
+// Used by events without a calendar, the Gregorian months without leap years
+var DefaultCalendar = models.TimelineCalendarModel{
+	Name: "Default",
+	Months: []models.CalendarMonth{
+		{Name: "January", Days: 31},
+		{Name: "February", Days: 28},
+		{Name: "March", Days: 31},
+		{Name: "April", Days: 30},
+		{Name: "May", Days: 31},
+		{Name: "June", Days: 30},
+		{Name: "July", Days: 31},
+		{Name: "August", Days: 31},
+		{Name: "September", Days: 30},
+		{Name: "October", Days: 31},
+		{Name: "November", Days: 30},
+		{Name: "December", Days: 31},
+	},
+}
+
+func GetTimelineCalendars(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view the timeline of this fiction") {
+		return
+	}
+
+	calendars, err := GetCalendars(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch calendars"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, calendars)
+}
+
+func CreateTimelineCalendar(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	calendarForm, months, ok := BindTimelineCalendar(ctx)
+	if !ok {
+		return
+	}
+
+	row := db.DB.QueryRow(
+		`
+		INSERT INTO TimelineCalendars (Fiction_ID, Name, Months, Era, Epoch_Offset)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ID, Fiction_ID, Name, Months, Era, Epoch_Offset, Created
+		`,
+		fictionID,
+		calendarForm.Name,
+		months,
+		calendarForm.Era,
+		calendarForm.Epoch_Offset,
+	)
+
+	calendar, err := ScanTimelineCalendar(row)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The fiction already has a calendar with this name"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create calendar"})
+		}
+
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, calendar)
+}
+
+// Changing the months or the epoch moves every event dated in this calendar, so their sort keys are recomputed
+// in the same transaction. Events using a month or day the new calendar no longer has block the change.
+func EditTimelineCalendar(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	calendarForm, months, ok := BindTimelineCalendar(ctx)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	row := tx.QueryRow(
+		`
+		UPDATE TimelineCalendars
+		SET Name = $1, Months = $2, Era = $3, Epoch_Offset = $4
+		WHERE ID = $5 AND Fiction_ID = $6
+		RETURNING ID, Fiction_ID, Name, Months, Era, Epoch_Offset, Created
+		`,
+		calendarForm.Name,
+		months,
+		calendarForm.Era,
+		calendarForm.Epoch_Offset,
+		ctx.Param("calendarID"),
+		fictionID,
+	)
+
+	calendar, err := ScanTimelineCalendar(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Calendar not found"})
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "The fiction already has a calendar with this name"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+		}
+
+		return
+	}
+
+	rows, err := tx.Query("SELECT ID, Year, Month, Day FROM TimelineEvents WHERE Calendar_ID = $1", calendar.ID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+		return
+	}
+
+	sortKeys := map[int]int64{}
+	invalidEvents := []int{}
+	for rows.Next() {
+		var eventID, year int
+		var month, day sql.NullInt64
+		if err := rows.Scan(
+			&eventID,
+			&year,
+			&month,
+			&day,
+		); err != nil {
+			rows.Close()
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+			return
+		}
+
+		sortKey, err := CalendarSortKey(calendar, year, NullableInt(month), NullableInt(day))
+		if err != nil {
+			invalidEvents = append(invalidEvents, eventID)
+			continue
+		}
+
+		sortKeys[eventID] = sortKey
+	}
+
+	rows.Close()
+	if len(invalidEvents) > 0 {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "Some events use a month or day this calendar would no longer have", "Event_IDs": invalidEvents})
+		return
+	}
+
+	for eventID, sortKey := range sortKeys {
+		if _, err := tx.Exec("UPDATE TimelineEvents SET Sort_Key = $1 WHERE ID = $2", sortKey, eventID); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update calendar"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, calendar)
+}
+
+func DeleteTimelineCalendar(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM TimelineCalendars WHERE ID = $1 AND Fiction_ID = $2", ctx.Param("calendarID"), fictionID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" { // 23503: Foreign key violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "Events are still dated in this calendar"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete calendar"})
+		}
+
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Calendar not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Calendar deleted"})
+}
+
+// Events in in-world order, ?character= and ?chapter= narrow it to the events of one codex character or chapter
+func GetTimeline(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view the timeline of this fiction") {
+		return
+	}
+
+	characterID, errCharacter := strconv.Atoi(ctx.DefaultQuery("character", "0"))
+	chapterID, errChapter := strconv.Atoi(ctx.DefaultQuery("chapter", "0"))
+	if errCharacter != nil || errChapter != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid character or chapter"})
+		return
+	}
+
+	events, err := GetTimelineEvents(fictionID, characterID, chapterID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch timeline"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, events)
+}
+
+func CreateTimelineEvent(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	eventForm, sortKey, ok := BindTimelineEvent(ctx, fictionID)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create event"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	var eventID int
+	err = tx.QueryRow(
+		`
+		INSERT INTO TimelineEvents (Fiction_ID, Calendar_ID, Title, Description, Year, Month, Day, Duration_Days, Sort_Key, Location_ID)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING ID
+		`,
+		fictionID,
+		eventForm.Calendar_ID,
+		eventForm.Title,
+		eventForm.Description,
+		eventForm.Year,
+		eventForm.Month,
+		eventForm.Day,
+		eventForm.Duration_Days,
+		sortKey,
+		eventForm.Location_ID,
+	).Scan(&eventID)
+
+	if err != nil || SaveTimelineEventLinks(tx, eventID, fictionID, eventForm) != nil || tx.Commit() != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create event"})
+		return
+	}
+
+	event, err := GetTimelineEvent(fictionID, eventID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch event"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, event)
+}
+
+// Replaces the whole event including its chapter and character links
+func EditTimelineEvent(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	eventForm, sortKey, ok := BindTimelineEvent(ctx, fictionID)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update event"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	var eventID int
+	err = tx.QueryRow(
+		`
+		UPDATE TimelineEvents
+		SET Calendar_ID = $1, Title = $2, Description = $3, Year = $4, Month = $5, Day = $6, Duration_Days = $7, Sort_Key = $8, Location_ID = $9, Updated = NOW()
+		WHERE ID = $10 AND Fiction_ID = $11
+		RETURNING ID
+		`,
+		eventForm.Calendar_ID,
+		eventForm.Title,
+		eventForm.Description,
+		eventForm.Year,
+		eventForm.Month,
+		eventForm.Day,
+		eventForm.Duration_Days,
+		sortKey,
+		eventForm.Location_ID,
+		ctx.Param("eventID"),
+		fictionID,
+	).Scan(&eventID)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Event not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update event"})
+		}
+
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM TimelineEventChapters WHERE Event_ID = $1", eventID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update event"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM TimelineEventCharacters WHERE Event_ID = $1", eventID); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update event"})
+		return
+	}
+
+	if SaveTimelineEventLinks(tx, eventID, fictionID, eventForm) != nil || tx.Commit() != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update event"})
+		return
+	}
+
+	event, err := GetTimelineEvent(fictionID, eventID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch event"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, event)
+}
+
+func DeleteTimelineEvent(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit the timeline of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM TimelineEvents WHERE ID = $1 AND Fiction_ID = $2", ctx.Param("eventID"), fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete event"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Event not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Event deleted"})
+}
+
+// Flags likely continuity errors. Out of order chapters may be intended flashbacks, they are listed so the author can check.
+func GetTimelineContinuity(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view the timeline."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view the timeline of this fiction") {
+		return
+	}
+
+	events, err := GetTimelineEvents(fictionID, 0, 0)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch timeline"})
+		return
+	}
+
+	issues := append(FindCharacterConflicts(events), FindOutOfOrderChapters(events)...)
+	unrevealed, err := FindUnrevealedCharacters(fictionID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check timeline"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, append(issues, unrevealed...))
+}
+
+// A character cannot be in two places at once, overlapping events of one character at different locations are flagged
+func FindCharacterConflicts(events []models.TimelineEventModel) []models.TimelineIssueModel {
+	byCharacter := map[int][]models.TimelineEventModel{}
+	names := map[int]string{}
+	for _, event := range events {
+		if event.Location == nil {
+			continue
+		}
+
+		for _, character := range event.Characters {
+			byCharacter[character.ID] = append(byCharacter[character.ID], event)
+			names[character.ID] = character.Name
+		}
+	}
+
+	characterIDs := []int{}
+	for characterID := range byCharacter {
+		characterIDs = append(characterIDs, characterID)
+	}
+
+	sort.Ints(characterIDs)
+	issues := []models.TimelineIssueModel{}
+	for _, characterID := range characterIDs {
+		characterEvents := byCharacter[characterID]
+		for i, event := range characterEvents {
+			end := event.Sort_Key + int64(event.Duration_Days)
+			for _, other := range characterEvents[i + 1:] {
+				if other.Sort_Key >= end {
+					break
+				}
+
+				if other.Location.ID != event.Location.ID {
+					issues = append(issues, models.TimelineIssueModel{
+						Kind:      models.TimelineCharacterConflict,
+						Message:   fmt.Sprintf("%s is at %s during \"%s\" and at %s during \"%s\" at the same time", names[characterID], event.Location.Name, event.Title, other.Location.Name, other.Title),
+						Event_IDs: []int{event.ID, other.ID},
+					})
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// Compares each chapter with the previous chapter that has events, by the earliest event linked to each
+func FindOutOfOrderChapters(events []models.TimelineEventModel) []models.TimelineIssueModel {
+	earliest := map[int]models.TimelineEventModel{}
+	for _, event := range events {
+		for _, chapter := range event.Chapters {
+			if _, ok := earliest[chapter.ID]; !ok {
+				earliest[chapter.ID] = event
+			}
+		}
+	}
+
+	chapterIDs := []int{}
+	for chapterID := range earliest {
+		chapterIDs = append(chapterIDs, chapterID)
+	}
+
+	sort.Ints(chapterIDs)
+	issues := []models.TimelineIssueModel{}
+	for i := 1; i < len(chapterIDs); i++ {
+		previous, current := earliest[chapterIDs[i - 1]], earliest[chapterIDs[i]]
+		if current.Sort_Key < previous.Sort_Key {
+			issues = append(issues, models.TimelineIssueModel{
+				Kind:      models.TimelineOutOfOrder,
+				Message:   fmt.Sprintf("Chapter %d starts on %s, before chapter %d on %s", chapterIDs[i], current.Date, chapterIDs[i - 1], previous.Date),
+				Event_IDs: []int{previous.ID, current.ID},
+			})
+		}
+	}
+
+	return issues
+}
+
+// Characters linked to an event of a chapter before the chapter their codex entry is revealed in
+func FindUnrevealedCharacters(fictionID string) ([]models.TimelineIssueModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			T.ID, T.Title, E.Name, E.Reveal_Chapter, MIN(TC.Chapter_ID)
+		FROM
+			TimelineEvents T
+		JOIN
+			TimelineEventCharacters TE
+		ON
+			TE.Event_ID = T.ID
+		JOIN
+			CodexEntries E
+		ON
+			E.ID = TE.Entry_ID
+		JOIN
+			TimelineEventChapters TC
+		ON
+			TC.Event_ID = T.ID
+		WHERE
+			T.Fiction_ID = $1 AND E.Reveal_Chapter IS NOT NULL
+		GROUP BY T.ID, T.Title, E.ID, E.Name, E.Reveal_Chapter
+		HAVING MIN(TC.Chapter_ID) < E.Reveal_Chapter
+		ORDER BY T.Sort_Key, T.ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	issues := []models.TimelineIssueModel{}
+	for rows.Next() {
+		var eventID, revealChapter, chapterID int
+		var title, name string
+		if err := rows.Scan(
+			&eventID,
+			&title,
+			&name,
+			&revealChapter,
+			&chapterID,
+		); err != nil {
+			return nil, err
+		}
+
+		issues = append(issues, models.TimelineIssueModel{
+			Kind:      models.TimelineUnrevealed,
+			Message:   fmt.Sprintf("%s takes part in \"%s\" in chapter %d but the codex reveals them in chapter %d", name, title, chapterID, revealChapter),
+			Event_IDs: []int{eventID},
+		})
+	}
+
+	return issues, nil
+}
+
+// Validates the request body, writes the error response itself when it returns false
+func BindTimelineCalendar(ctx *gin.Context) (*models.TimelineCalendarForm, string, bool) {
+	calendarForm := models.TimelineCalendarForm{}
+	if err := ctx.ShouldBindJSON(&calendarForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return nil, "", false
+	}
+
+	calendarForm.Name = strings.TrimSpace(calendarForm.Name)
+	if calendarForm.Name == "" || len([]rune(calendarForm.Name)) > MAX_CALENDAR_NAME_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Name must be between 1 and " + strconv.Itoa(MAX_CALENDAR_NAME_LENGTH) + " characters"})
+		return nil, "", false
+	}
+
+	calendarForm.Era = strings.TrimSpace(calendarForm.Era)
+	if len([]rune(calendarForm.Era)) > MAX_CALENDAR_ERA_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Era must be at most " + strconv.Itoa(MAX_CALENDAR_ERA_LENGTH) + " characters"})
+		return nil, "", false
+	}
+
+	if len(calendarForm.Months) == 0 || len(calendarForm.Months) > MAX_CALENDAR_MONTHS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "A calendar must have between 1 and " + strconv.Itoa(MAX_CALENDAR_MONTHS) + " months"})
+		return nil, "", false
+	}
+
+	if calendarForm.Epoch_Offset < -MAX_CALENDAR_EPOCH_OFFSET || calendarForm.Epoch_Offset > MAX_CALENDAR_EPOCH_OFFSET {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "epoch_offset must be between -" + strconv.FormatInt(MAX_CALENDAR_EPOCH_OFFSET, 10) + " and " + strconv.FormatInt(MAX_CALENDAR_EPOCH_OFFSET, 10)})
+		return nil, "", false
+	}
+
+	for i := range calendarForm.Months {
+		calendarForm.Months[i].Name = strings.TrimSpace(calendarForm.Months[i].Name)
+		month := calendarForm.Months[i]
+		if month.Name == "" || len([]rune(month.Name)) > MAX_CALENDAR_NAME_LENGTH || month.Days < 1 || month.Days > MAX_CALENDAR_MONTH_DAYS {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Every month needs a name and between 1 and " + strconv.Itoa(MAX_CALENDAR_MONTH_DAYS) + " days"})
+			return nil, "", false
+		}
+	}
+
+	months, err := json.Marshal(calendarForm.Months)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid months"})
+		return nil, "", false
+	}
+
+	return &calendarForm, string(months), true
+}
+
+// Validates the request body against the fiction's calendars, chapters and codex and computes the sort key,
+// writes the error response itself when it returns false
+func BindTimelineEvent(ctx *gin.Context, fictionID string) (*models.TimelineEventForm, int64, bool) {
+	eventForm := models.TimelineEventForm{}
+	if err := ctx.ShouldBindJSON(&eventForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return nil, 0, false
+	}
+
+	eventForm.Title = strings.TrimSpace(eventForm.Title)
+	if eventForm.Title == "" || len([]rune(eventForm.Title)) > MAX_TIMELINE_TITLE_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Title must be between 1 and " + strconv.Itoa(MAX_TIMELINE_TITLE_LENGTH) + " characters"})
+		return nil, 0, false
+	}
+
+	if len(eventForm.Description) > MAX_TIMELINE_DESCRIPTION_LENGTH {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Description must be at most " + strconv.Itoa(MAX_TIMELINE_DESCRIPTION_LENGTH) + " characters"})
+		return nil, 0, false
+	}
+
+	if eventForm.Year < -MAX_TIMELINE_YEAR || eventForm.Year > MAX_TIMELINE_YEAR {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Year is out of range"})
+		return nil, 0, false
+	}
+
+	if eventForm.Duration_Days == 0 {
+		eventForm.Duration_Days = 1
+	}
+
+	if eventForm.Duration_Days < 1 || eventForm.Duration_Days > MAX_TIMELINE_DURATION_DAYS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "duration_days must be between 1 and " + strconv.Itoa(MAX_TIMELINE_DURATION_DAYS)})
+		return nil, 0, false
+	}
+
+	calendar := &DefaultCalendar
+	if eventForm.Calendar_ID != nil {
+		row := db.DB.QueryRow(
+			`
+			SELECT
+				ID, Fiction_ID, Name, Months, Era, Epoch_Offset, Created
+			FROM
+				TimelineCalendars
+			WHERE
+				ID = $1 AND Fiction_ID = $2
+			`,
+			*eventForm.Calendar_ID,
+			fictionID,
+		)
+
+		found, err := ScanTimelineCalendar(row)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Calendar not found"})
+			} else {
+				ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch calendar"})
+			}
+
+			return nil, 0, false
+		}
+
+		calendar = found
+	}
+
+	sortKey, err := CalendarSortKey(calendar, eventForm.Year, eventForm.Month, eventForm.Day)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "The date does not exist in the " + calendar.Name + " calendar"})
+		return nil, 0, false
+	}
+
+	eventForm.Chapter_IDs = UniqueChapterIDs(eventForm.Chapter_IDs)
+	eventForm.Character_IDs = UniqueChapterIDs(eventForm.Character_IDs)
+	if len(eventForm.Chapter_IDs) > MAX_TIMELINE_LINKS || len(eventForm.Character_IDs) > MAX_TIMELINE_LINKS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "An event can link at most " + strconv.Itoa(MAX_TIMELINE_LINKS) + " chapters and characters"})
+		return nil, 0, false
+	}
+
+	var chapters, characters, locations int
+	err = db.DB.QueryRow(
+		`
+		SELECT
+			(SELECT COUNT(*) FROM Chapters WHERE Fiction_ID = $1 AND ID = ANY($2)),
+			(SELECT COUNT(*) FROM CodexEntries WHERE Fiction_ID = $1 AND Type = 'character' AND ID = ANY($3)),
+			(SELECT COUNT(*) FROM CodexEntries WHERE Fiction_ID = $1 AND Type = 'location' AND ID = $4)
+		`,
+		fictionID,
+		pq.Array(eventForm.Chapter_IDs),
+		pq.Array(eventForm.Character_IDs),
+		eventForm.Location_ID,
+	).Scan(
+		&chapters,
+		&characters,
+		&locations,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check event links"})
+		return nil, 0, false
+	}
+
+	if chapters != len(eventForm.Chapter_IDs) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Some chapters do not exist in this fiction"})
+		return nil, 0, false
+	}
+
+	if characters != len(eventForm.Character_IDs) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Some characters are not character entries of this fiction's codex"})
+		return nil, 0, false
+	}
+
+	if eventForm.Location_ID != nil && locations == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "The location is not a location entry of this fiction's codex"})
+		return nil, 0, false
+	}
+
+	return &eventForm, sortKey, true
+}
+
+func SaveTimelineEventLinks(tx *sql.Tx, eventID int, fictionID string, eventForm *models.TimelineEventForm) error {
+	_, err := tx.Exec(
+		`
+		INSERT INTO TimelineEventChapters (Event_ID, Fiction_ID, Chapter_ID)
+		SELECT $1, $2, UNNEST($3::INT[])
+		`,
+		eventID,
+		fictionID,
+		pq.Array(eventForm.Chapter_IDs),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+		INSERT INTO TimelineEventCharacters (Event_ID, Entry_ID)
+		SELECT $1, UNNEST($2::INT[])
+		`,
+		eventID,
+		pq.Array(eventForm.Character_IDs),
+	)
+
+	return err
+}
+
+// Days since the shared epoch, an event without a month or day sorts at the start of its year or month
+func CalendarSortKey(calendar *models.TimelineCalendarModel, year int, month *int, day *int) (int64, error) {
+	var daysPerYear int64
+	for _, calendarMonth := range calendar.Months {
+		daysPerYear += int64(calendarMonth.Days)
+	}
+
+	// Also guards calendars stored before the bounds existed
+	if calendar.Epoch_Offset < -MAX_CALENDAR_EPOCH_OFFSET || calendar.Epoch_Offset > MAX_CALENDAR_EPOCH_OFFSET || year < -MAX_TIMELINE_YEAR || year > MAX_TIMELINE_YEAR {
+		return 0, ErrInvalidCalendarDate
+	}
+
+	sortKey := calendar.Epoch_Offset + int64(year) * daysPerYear
+	if month == nil {
+		if day != nil {
+			return 0, ErrInvalidCalendarDate
+		}
+
+		return sortKey, nil
+	}
+
+	if *month < 1 || *month > len(calendar.Months) {
+		return 0, ErrInvalidCalendarDate
+	}
+
+	for _, calendarMonth := range calendar.Months[:*month - 1] {
+		sortKey += int64(calendarMonth.Days)
+	}
+
+	if day != nil {
+		if *day < 1 || *day > calendar.Months[*month - 1].Days {
+			return 0, ErrInvalidCalendarDate
+		}
+
+		sortKey += int64(*day - 1)
+	}
+
+	return sortKey, nil
+}
+
+func FormatCalendarDate(calendar *models.TimelineCalendarModel, year int, month *int, day *int) string {
+	date := strconv.Itoa(year)
+	if calendar.Era != "" {
+		date += " " + calendar.Era
+	}
+
+	if month == nil || *month < 1 || *month > len(calendar.Months) {
+		return date
+	}
+
+	date = calendar.Months[*month - 1].Name + " " + date
+	if day != nil {
+		date = strconv.Itoa(*day) + " " + date
+	}
+
+	return date
+}
+
+func GetCalendars(fictionID string) ([]models.TimelineCalendarModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, Name, Months, Era, Epoch_Offset, Created
+		FROM
+			TimelineCalendars
+		WHERE
+			Fiction_ID = $1
+		ORDER BY Epoch_Offset, Name
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	calendars := []models.TimelineCalendarModel{}
+	for rows.Next() {
+		calendar, err := ScanTimelineCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		calendars = append(calendars, *calendar)
+	}
+
+	return calendars, nil
+}
+
+func ScanTimelineCalendar(row interface{ Scan(...interface{}) error }) (*models.TimelineCalendarModel, error) {
+	calendar := models.TimelineCalendarModel{}
+	var months []byte
+	if err := row.Scan(
+		&calendar.ID,
+		&calendar.Fiction_ID,
+		&calendar.Name,
+		&months,
+		&calendar.Era,
+		&calendar.Epoch_Offset,
+		&calendar.Created,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(months, &calendar.Months); err != nil {
+		return nil, err
+	}
+
+	return &calendar, nil
+}
+
+func GetTimelineEvent(fictionID string, eventID int) (*models.TimelineEventModel, error) {
+	events, err := QueryTimelineEvents(fictionID, "T.ID = $2", eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &events[0], nil
+}
+
+// A zero characterID or chapterID does not filter
+func GetTimelineEvents(fictionID string, characterID int, chapterID int) ([]models.TimelineEventModel, error) {
+	return QueryTimelineEvents(
+		fictionID,
+		`
+			($2 = 0 OR EXISTS (SELECT 1 FROM TimelineEventCharacters WHERE Event_ID = T.ID AND Entry_ID = $2))
+			AND ($3 = 0 OR EXISTS (SELECT 1 FROM TimelineEventChapters WHERE Event_ID = T.ID AND Chapter_ID = $3))
+		`,
+		characterID,
+		chapterID,
+	)
+}
+
+func QueryTimelineEvents(fictionID string, filter string, args ...interface{}) ([]models.TimelineEventModel, error) {
+	calendarList, err := GetCalendars(fictionID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendars := map[int]*models.TimelineCalendarModel{}
+	for i := range calendarList {
+		calendars[calendarList[i].ID] = &calendarList[i]
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			T.ID, T.Fiction_ID, T.Title, T.Description, T.Calendar_ID, T.Year, T.Month, T.Day, T.Duration_Days, T.Sort_Key,
+			L.ID, L.Name, T.Created, T.Updated
+		FROM
+			TimelineEvents T
+		LEFT JOIN
+			CodexEntries L
+		ON
+			L.ID = T.Location_ID
+		WHERE
+			T.Fiction_ID = $1 AND `+filter+`
+		ORDER BY T.Sort_Key, T.ID
+		`,
+		append([]interface{}{fictionID}, args...)...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	events := []models.TimelineEventModel{}
+	eventIndex := map[int]int{}
+	eventIDs := []int64{}
+	for rows.Next() {
+		event := models.TimelineEventModel{Chapters: []models.TimelineLinkModel{}, Characters: []models.TimelineLinkModel{}}
+		var calendarID, month, day, locationID sql.NullInt64
+		var locationName sql.NullString
+		if err := rows.Scan(
+			&event.ID,
+			&event.Fiction_ID,
+			&event.Title,
+			&event.Description,
+			&calendarID,
+			&event.Year,
+			&month,
+			&day,
+			&event.Duration_Days,
+			&event.Sort_Key,
+			&locationID,
+			&locationName,
+			&event.Created,
+			&event.Updated,
+		); err != nil {
+			return nil, err
+		}
+
+		event.Calendar_ID = NullableInt(calendarID)
+		event.Month = NullableInt(month)
+		event.Day = NullableInt(day)
+		if locationID.Valid {
+			event.Location = &models.TimelineLinkModel{ID: int(locationID.Int64), Name: locationName.String}
+		}
+
+		calendar := &DefaultCalendar
+		if event.Calendar_ID != nil && calendars[*event.Calendar_ID] != nil {
+			calendar = calendars[*event.Calendar_ID]
+		}
+
+		event.Date = FormatCalendarDate(calendar, event.Year, event.Month, event.Day)
+		eventIndex[event.ID] = len(events)
+		eventIDs = append(eventIDs, int64(event.ID))
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil || len(events) == 0 {
+		return events, err
+	}
+
+	chapterRows, err := db.DB.Query(
+		`
+		SELECT
+			TC.Event_ID, C.ID, C.Title
+		FROM
+			TimelineEventChapters TC
+		JOIN
+			Chapters C
+		ON
+			C.Fiction_ID = TC.Fiction_ID AND C.ID = TC.Chapter_ID
+		WHERE
+			TC.Event_ID = ANY($1)
+		ORDER BY C.ID
+		`,
+		pq.Array(eventIDs),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer chapterRows.Close()
+	for chapterRows.Next() {
+		var eventID int
+		link := models.TimelineLinkModel{}
+		if err := chapterRows.Scan(
+			&eventID,
+			&link.ID,
+			&link.Name,
+		); err != nil {
+			return nil, err
+		}
+
+		events[eventIndex[eventID]].Chapters = append(events[eventIndex[eventID]].Chapters, link)
+	}
+
+	characterRows, err := db.DB.Query(
+		`
+		SELECT
+			TE.Event_ID, E.ID, E.Name
+		FROM
+			TimelineEventCharacters TE
+		JOIN
+			CodexEntries E
+		ON
+			E.ID = TE.Entry_ID
+		WHERE
+			TE.Event_ID = ANY($1)
+		ORDER BY E.Name
+		`,
+		pq.Array(eventIDs),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer characterRows.Close()
+	for characterRows.Next() {
+		var eventID int
+		link := models.TimelineLinkModel{}
+		if err := characterRows.Scan(
+			&eventID,
+			&link.ID,
+			&link.Name,
+		); err != nil {
+			return nil, err
+		}
+
+		events[eventIndex[eventID]].Characters = append(events[eventIndex[eventID]].Characters, link)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"testing"
+
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func TestCalendarSortKey(t *testing.T) {
+	calendar := &models.TimelineCalendarModel{
+		Months: []models.CalendarMonth{
+			{Name: "Thaw", Days: 30},
+			{Name: "Bloom", Days: 20},
+			{Name: "Frost", Days: 10},
+		},
+		Epoch_Offset: 100,
+	}
+
+	tests := []struct {
+		name    string
+		year    int
+		month   *int
+		day     *int
+		want    int64
+		wantErr bool
+	}{
+		{name: "year only", year: 0, want: 100},
+		{name: "later year", year: 2, want: 100 + 2 * 60},
+		{name: "negative year", year: -1, want: 100 - 60},
+		{name: "first month", year: 1, month: intPointer(1), want: 160},
+		{name: "third month", year: 1, month: intPointer(3), want: 160 + 30 + 20},
+		{name: "first day", year: 1, month: intPointer(2), day: intPointer(1), want: 160 + 30},
+		{name: "last day", year: 1, month: intPointer(3), day: intPointer(10), want: 160 + 30 + 20 + 9},
+		{name: "day without month", year: 1, day: intPointer(1), wantErr: true},
+		{name: "month zero", year: 1, month: intPointer(0), wantErr: true},
+		{name: "month past the calendar", year: 1, month: intPointer(4), wantErr: true},
+		{name: "day zero", year: 1, month: intPointer(1), day: intPointer(0), wantErr: true},
+		{name: "day past the month", year: 1, month: intPointer(2), day: intPointer(21), wantErr: true},
+		{name: "year past the bound", year: MAX_TIMELINE_YEAR + 1, wantErr: true},
+		{name: "year before the bound", year: -MAX_TIMELINE_YEAR - 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CalendarSortKey(calendar, test.year, test.month, test.day)
+			if test.wantErr {
+				if err != ErrInvalidCalendarDate {
+					t.Fatalf("got %d, %v, want ErrInvalidCalendarDate", got, err)
+				}
+
+				return
+			}
+
+			if err != nil || got != test.want {
+				t.Fatalf("got %d, %v, want %d", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCalendarSortKeyEpochOffsetBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int64
+		wantErr bool
+	}{
+		{name: "largest offset", offset: MAX_CALENDAR_EPOCH_OFFSET},
+		{name: "smallest offset", offset: -MAX_CALENDAR_EPOCH_OFFSET},
+		{name: "offset past the bound", offset: MAX_CALENDAR_EPOCH_OFFSET + 1, wantErr: true},
+		{name: "offset before the bound", offset: -MAX_CALENDAR_EPOCH_OFFSET - 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			months := make([]models.CalendarMonth, MAX_CALENDAR_MONTHS)
+			for i := range months {
+				months[i] = models.CalendarMonth{Name: "Month", Days: MAX_CALENDAR_MONTH_DAYS}
+			}
+
+			calendar := &models.TimelineCalendarModel{Months: months, Epoch_Offset: test.offset}
+			lastMonth := intPointer(MAX_CALENDAR_MONTHS)
+			lastDay := intPointer(MAX_CALENDAR_MONTH_DAYS)
+			latest, err := CalendarSortKey(calendar, MAX_TIMELINE_YEAR, lastMonth, lastDay)
+			if test.wantErr {
+				if err != ErrInvalidCalendarDate {
+					t.Fatalf("got %d, %v, want ErrInvalidCalendarDate", latest, err)
+				}
+
+				return
+			}
+
+			earliest, err2 := CalendarSortKey(calendar, -MAX_TIMELINE_YEAR, nil, nil)
+			if err != nil || err2 != nil {
+				t.Fatalf("got errors %v, %v", err, err2)
+			}
+
+			// An overflow would wrap around and break the order
+			if earliest >= latest {
+				t.Fatalf("earliest %d does not sort before latest %d", earliest, latest)
+			}
+		})
+	}
+}
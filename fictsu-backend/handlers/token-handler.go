@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"time"
+	"strings"
+	"net/http"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	TOKEN_PREFIX              string = "fictsu_pat_"
+	DEFAULT_TOKEN_EXPIRY_DAYS int    = 90
+	MAX_TOKEN_EXPIRY_DAYS     int    = 365
+)
+
+var tokenScopes = map[models.TokenScope]bool{
+	models.ScopeRead:          true,
+	models.ScopeWriteChapters: true,
+	models.ScopeWriteFictions: true,
+	models.ScopeAI:            true,
+}
+
+// Sessions built from a token are never written back, so a token can not be turned into a cookie
+type TokenSessionStore struct{}
+
+func (TokenSessionStore) Get(request *http.Request, name string) (*sessions.Session, error) {
+	return sessions.NewSession(TokenSessionStore{}, name), nil
+}
+
+func (TokenSessionStore) New(request *http.Request, name string) (*sessions.Session, error) {
+	return sessions.NewSession(TokenSessionStore{}, name), nil
+}
+
+func (TokenSessionStore) Save(request *http.Request, writer http.ResponseWriter, session *sessions.Session) error {
+	return nil
+}
+
+// Returns the session of the request. For bearer token requests the session is built from the token,
+// but only on safe methods or on routes that granted one of the token's scopes through RequireScope.
+func GetSession(ctx *gin.Context, store sessions.Store) (*sessions.Session, error) {
+	tokenUserID, isTokenRequest := ctx.Get("token_user_ID")
+	if !isTokenRequest {
+		return store.Get(ctx.Request, "fictsu-session")
+	}
+
+	session := sessions.NewSession(TokenSessionStore{}, "fictsu-session")
+	if IsSafeMethod(ctx.Request.Method) || ctx.GetBool("token_scope_granted") {
+		session.Values["ID"] = tokenUserID
+		session.Values["name"] = ctx.GetString("token_user_name")
+	}
+
+	return session, nil
+}
+
+// Lets the session store record the same client IP as the rate limiter, resolved with the trusted proxies
+func ResolveClientIP() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = db.WithClientIP(ctx.Request, ctx.ClientIP())
+		ctx.Next()
+	}
+}
+
+// Authenticates "Authorization: Bearer <token>" requests, cookie requests pass through untouched
+func TokenAuthentication() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorization := ctx.GetHeader("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			ctx.Next()
+			return
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		var tokenID int
+		var userID int
+		var userName string
+		var scopes []string
+		err := db.DB.QueryRow(
+			`
+			SELECT
+				T.ID, T.User_ID, U.Name, T.Scopes
+			FROM
+				PersonalAccessTokens T
+			JOIN
+				Users U ON T.User_ID = U.ID
+			WHERE
+				T.Token_Hash = $1 AND T.Revoked IS NULL AND T.Expires > NOW()
+			`,
+			HashToken(token),
+		).Scan(
+			&tokenID,
+			&userID,
+			&userName,
+			pq.Array(&scopes),
+		)
+
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"Error": "Invalid, expired or revoked access token"})
+			return
+		}
+
+		// Only touch the row once a minute to avoid a write on every request
+		db.DB.Exec(
+			`
+			UPDATE PersonalAccessTokens
+			SET Last_Used = NOW()
+			WHERE ID = $1 AND (Last_Used IS NULL OR Last_Used < NOW() - INTERVAL '1 minute')
+			`,
+			tokenID,
+		)
+
+		if IsSafeMethod(ctx.Request.Method) && !HasScope(scopes, models.ScopeRead) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "Access token is missing the read scope"})
+			return
+		}
+
+		ctx.Set("token_user_ID", userID)
+		ctx.Set("token_user_name", userName)
+		ctx.Set("token_scopes", scopes)
+		ctx.Next()
+	}
+}
+
+// Lets bearer tokens with the given scope use the route. Writes without it stay cookie-only for tokens,
+// safe methods only need the read scope unless the route also uses RequireCookieSession.
+func RequireScope(scope models.TokenScope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scopes, isTokenRequest := ctx.Get("token_scopes")
+		if !isTokenRequest {
+			ctx.Next()
+			return
+		}
+
+		if !HasScope(scopes.([]string), scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "Access token is missing the " + string(scope) + " scope"})
+			return
+		}
+
+		ctx.Set("token_scope_granted", true)
+		ctx.Next()
+	}
+}
+
+// Refuses bearer tokens on account management routes, a leaked read-only token must not expose the export,
+// the other tokens or the active sessions of the account
+func RequireCookieSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, isTokenRequest := ctx.Get("token_user_ID"); isTokenRequest {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "This route can not be used with an access token"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func GetPersonalAccessTokens(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	tokens, err := GetPersonalAccessTokensOf(IDFromSession.(int))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch access tokens"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, tokens)
+}
+
+// Only the metadata, the tokens themselves are stored as hashes
+func GetPersonalAccessTokensOf(userID int) ([]models.PersonalAccessTokenModel, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, User_ID, Name, Prefix, Scopes, Expires, Last_Used, Revoked, Created
+		FROM
+			PersonalAccessTokens
+		WHERE
+			User_ID = $1
+		ORDER BY ID DESC
+		`,
+		userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	tokens := []models.PersonalAccessTokenModel{}
+	for rows.Next() {
+		token := models.PersonalAccessTokenModel{}
+		if err := rows.Scan(
+			&token.ID,
+			&token.User_ID,
+			&token.Name,
+			&token.Prefix,
+			pq.Array(&token.Scopes),
+			&token.Expires,
+			&token.Last_Used,
+			&token.Revoked,
+			&token.Created,
+		); err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func CreatePersonalAccessToken(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to create an access token."})
+		return
+	}
+
+	tokenCreateRequest := models.PersonalAccessTokenForm{}
+	if err := ctx.ShouldBindJSON(&tokenCreateRequest); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid data provided for access token creation"})
+		return
+	}
+
+	if tokenCreateRequest.Name == "" || len(tokenCreateRequest.Name) > 255 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Access token name is required"})
+		return
+	}
+
+	if len(tokenCreateRequest.Scopes) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "At least one scope must be selected"})
+		return
+	}
+
+	for _, scope := range tokenCreateRequest.Scopes {
+		if !tokenScopes[models.TokenScope(scope)] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unknown scope: " + scope})
+			return
+		}
+	}
+
+	if tokenCreateRequest.Expires_In_Days == 0 {
+		tokenCreateRequest.Expires_In_Days = DEFAULT_TOKEN_EXPIRY_DAYS
+	}
+
+	if tokenCreateRequest.Expires_In_Days < 0 || tokenCreateRequest.Expires_In_Days > MAX_TOKEN_EXPIRY_DAYS {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Access tokens must expire within 365 days"})
+		return
+	}
+
+	rawToken, err := GenerateToken()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate access token"})
+		return
+	}
+
+	token := models.PersonalAccessTokenModel{}
+	errInsert := db.DB.QueryRow(
+		`
+		INSERT INTO PersonalAccessTokens (User_ID, Name, Token_Hash, Prefix, Scopes, Expires)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ID, User_ID, Name, Prefix, Scopes, Expires, Created
+		`,
+		IDFromSession.(int),
+		tokenCreateRequest.Name,
+		HashToken(rawToken),
+		rawToken[:len(TOKEN_PREFIX) + 8],
+		pq.Array(tokenCreateRequest.Scopes),
+		time.Now().AddDate(0, 0, tokenCreateRequest.Expires_In_Days),
+	).Scan(
+		&token.ID,
+		&token.User_ID,
+		&token.Name,
+		&token.Prefix,
+		pq.Array(&token.Scopes),
+		&token.Expires,
+		&token.Created,
+	)
+
+	if errInsert != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create access token"})
+		return
+	}
+
+	// Only the hash is stored, this is the one and only time the token is shown
+	token.Token = rawToken
+	ctx.IndentedJSON(http.StatusCreated, token)
+}
+
+func RevokePersonalAccessToken(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to revoke an access token."})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		`
+		UPDATE PersonalAccessTokens
+		SET Revoked = NOW()
+		WHERE ID = $1 AND User_ID = $2 AND Revoked IS NULL
+		`,
+		ctx.Param("tokenID"),
+		IDFromSession.(int),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to revoke access token"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Access token not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Access token revoked successfully"})
+}
+
+func GenerateToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return TOKEN_PREFIX + hex.EncodeToString(secret), nil
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func HasScope(scopes []string, scope models.TokenScope) bool {
+	for _, granted := range scopes {
+		if granted == string(scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,814 @@
+package handlers
+
+import (
+	"log"
+	"context"
+	"strconv"
+	"strings"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	llm "github.com/Fictsu/Fictsu/llm"
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+const (
+	INTRO_TRANSLATION string = `You are a literary translator working on a web novel. Translate the user's text into %LANGUAGE%.
+	Keep every HTML tag and footnote marker such as [^1] exactly as it is and only translate the text between them.
+	Keep the author's tone, tense and formatting, and do not add notes or explanations. Reply with the translation only.`
+
+	// Chapters are translated in pieces of about this size so long chapters fit the model's output limit
+	TRANSLATION_CHUNK_TOKENS int = 1500
+	TRANSLATION_REPLY_TOKENS int = 4096
+	MAX_GLOSSARY_PROMPT_TERMS int = 200
+)
+
+var TranslationLanguages = map[string]string{
+	"th": "Thai",
+	"en": "English",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"zh": "Chinese",
+}
+
+// Lists every edition of the fiction, whether the given ID is the original or one of its translations
+func GetFictionTranslations(ctx *gin.Context) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			FT.Fiction_ID, FT.Original_ID, FT.Language, F.Title, COALESCE(F.Cover, ''), FT.Created
+		FROM
+			FictionTranslations FT
+		JOIN
+			Fictions F
+		ON
+			F.ID = FT.Fiction_ID
+		WHERE
+			FT.Original_ID = COALESCE((SELECT Original_ID FROM FictionTranslations WHERE Fiction_ID = $1), $1)
+		ORDER BY FT.Language
+		`,
+		ctx.Param("fictionID"),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch translations"})
+		return
+	}
+
+	defer rows.Close()
+	translations := []models.FictionTranslationModel{}
+	for rows.Next() {
+		translation := models.FictionTranslationModel{}
+		if err := rows.Scan(
+			&translation.Fiction_ID,
+			&translation.Original_ID,
+			&translation.Language,
+			&translation.Title,
+			&translation.Cover,
+			&translation.Created,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing translations"})
+			return
+		}
+
+		translations = append(translations, translation)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, translations)
+}
+
+// Creates the edition as a copy of the original's details, the chapters are filled in by the translation job
+func CreateFictionTranslation(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	nameFromSession := session.Values["name"]
+	if IDFromSession == nil || nameFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to translate a fiction."})
+		return
+	}
+
+	originalID, err := strconv.Atoi(ctx.Param("fictionID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+		return
+	}
+
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), IDFromSession.(int), "translate this fiction") {
+		return
+	}
+
+	translationForm := models.TranslationForm{}
+	if err := ctx.ShouldBindJSON(&translationForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	if _, ok := TranslationLanguages[translationForm.Language]; !ok {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Unsupported language"})
+		return
+	}
+
+	translationForm.Title = strings.TrimSpace(translationForm.Title)
+	if len([]rune(translationForm.Title)) > 255 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Title must be at most 255 characters"})
+		return
+	}
+
+	// Translating a translation would chain editions, always link to the original instead
+	var isTranslation bool
+	if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM FictionTranslations WHERE Fiction_ID = $1)", originalID).Scan(&isTranslation); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch translations"})
+		return
+	}
+
+	if isTranslation {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "This fiction is already a translation, translate the original instead"})
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create translation"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	translation := models.FictionTranslationModel{
+		Original_ID: originalID,
+		Language:    translationForm.Language,
+	}
+
+	err = tx.QueryRow(
+		`
+		INSERT INTO Fictions (Contributor_ID, Contributor_Name, Cover, Title, Subtitle, Author, Artist, Status, Synopsis)
+		SELECT
+			$1, $2, Cover, COALESCE(NULLIF($3, ''), Title), Subtitle, Author, Artist, Status, Synopsis
+		FROM
+			Fictions
+		WHERE
+			ID = $4
+		RETURNING ID, Title, COALESCE(Cover, '')
+		`,
+		IDFromSession.(int),
+		nameFromSession.(string),
+		translationForm.Title,
+		originalID,
+	).Scan(
+		&translation.Fiction_ID,
+		&translation.Title,
+		&translation.Cover,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create translation"})
+		return
+	}
+
+	_, err = tx.Exec(
+		`
+		INSERT INTO AssignGenreToFiction (Fiction_ID, Genre_ID)
+		SELECT
+			$1, Genre_ID
+		FROM
+			AssignGenreToFiction
+		WHERE
+			Fiction_ID = $2
+		`,
+		translation.Fiction_ID,
+		originalID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create translation"})
+		return
+	}
+
+	err = tx.QueryRow(
+		`
+		INSERT INTO FictionTranslations (Fiction_ID, Original_ID, Language)
+		VALUES ($1, $2, $3)
+		RETURNING Created
+		`,
+		translation.Fiction_ID,
+		translation.Original_ID,
+		translation.Language,
+	).Scan(
+		&translation.Created,
+	)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			ctx.IndentedJSON(http.StatusConflict, gin.H{"Error": "This fiction already has a translation in that language"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create translation"})
+		}
+
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create translation"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, translation)
+}
+
+// Starts an async job that machine-translates chapters of the original into the edition, poll GET /ai/jobs/:jobID for the result
+func OpenAITranslateFiction(ctx *gin.Context) {
+	fictionID, err := strconv.Atoi(ctx.Param("fictionID"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid fiction ID"})
+		return
+	}
+
+	userID := ctx.GetInt("ai_user_ID")
+	if !CheckFictionOwner(ctx, ctx.Param("fictionID"), userID, "translate this fiction") {
+		return
+	}
+
+	translation, err := GetFictionTranslation(fictionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "This fiction is not a translation"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch translation"})
+		}
+
+		return
+	}
+
+	jobForm := models.TranslationJobForm{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&jobForm); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+			return
+		}
+	}
+
+	jobForm.Chapter_IDs = UniqueChapterIDs(jobForm.Chapter_IDs)
+	job, err := StartAIJobWithTimeout(userID, fictionID, models.AIJobTranslation, jobForm, AI_TRANSLATION_JOB_TIMEOUT, func(jobCtx context.Context, job *models.AIJobModel) (interface{}, error) {
+		return TranslateFiction(jobCtx, job, translation, jobForm)
+	})
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start translation"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusAccepted, job)
+}
+
+func GetFictionTranslation(fictionID int) (*models.FictionTranslationModel, error) {
+	translation := models.FictionTranslationModel{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			FT.Fiction_ID, FT.Original_ID, FT.Language, F.Title, COALESCE(F.Cover, ''), FT.Created
+		FROM
+			FictionTranslations FT
+		JOIN
+			Fictions F
+		ON
+			F.ID = FT.Fiction_ID
+		WHERE
+			FT.Fiction_ID = $1
+		`,
+		fictionID,
+	).Scan(
+		&translation.Fiction_ID,
+		&translation.Original_ID,
+		&translation.Language,
+		&translation.Title,
+		&translation.Cover,
+		&translation.Created,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &translation, nil
+}
+
+// Runs inside the job. Reviewed chapters and chapters written directly in the edition are
+// skipped unless Overwrite is set, a chapter that fails does not stop the others. Each chapter
+// gets its own AI_JOB_TIMEOUT and the quota is checked again before each one, once it is spent
+// the remaining chapters are listed as not started.
+func TranslateFiction(ctx context.Context, job *models.AIJobModel, translation *models.FictionTranslationModel, jobForm models.TranslationJobForm) (*models.TranslationJobResult, error) {
+	systemPrompt, err := BuildTranslationPrompt(translation)
+	if err != nil {
+		return nil, err
+	}
+
+	result := models.TranslationJobResult{
+		Translated:  []int{},
+		Skipped:     []int{},
+		Failed:      []int{},
+		Not_Started: []int{},
+	}
+
+	if jobForm.Metadata && !TranslationQuotaExceeded(job.User_ID, &result) {
+		detailsCtx, cancel := context.WithTimeout(ctx, AI_JOB_TIMEOUT)
+		err := TranslateFictionDetails(detailsCtx, job.User_ID, translation, systemPrompt)
+		cancel()
+		if err != nil {
+			log.Printf("Error translating details of fiction %d: %v", translation.Fiction_ID, err)
+		} else {
+			result.Metadata = true
+		}
+	}
+
+	statuses, err := GetChapterTranslationStatuses(translation.Fiction_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Title, COALESCE(Content, ''), Footnotes
+		FROM
+			Chapters
+		WHERE
+			Fiction_ID = $1 AND (CARDINALITY($2::INT[]) = 0 OR ID = ANY($2))
+		ORDER BY ID
+		`,
+		translation.Original_ID,
+		pq.Array(jobForm.Chapter_IDs),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := []models.ChapterModel{}
+	for rows.Next() {
+		chapter := models.ChapterModel{}
+		var footnotes []byte
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.Title,
+			&chapter.Content,
+			&footnotes,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if err := json.Unmarshal(footnotes, &chapter.Footnotes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		chapters = append(chapters, chapter)
+	}
+
+	rows.Close()
+	for _, chapter := range chapters {
+		status, exists := statuses[chapter.ID]
+		if exists && status != models.ChapterTranslationMachine && !jobForm.Overwrite {
+			result.Skipped = append(result.Skipped, chapter.ID)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			result.Failed = append(result.Failed, chapter.ID)
+			continue
+		}
+
+		if TranslationQuotaExceeded(job.User_ID, &result) {
+			result.Not_Started = append(result.Not_Started, chapter.ID)
+			continue
+		}
+
+		chapterCtx, cancel := context.WithTimeout(ctx, AI_JOB_TIMEOUT)
+		err := TranslateChapter(chapterCtx, job.User_ID, translation, chapter, systemPrompt)
+		cancel()
+		if err != nil {
+			log.Printf("Error translating chapter %d of fiction %d: %v", chapter.ID, translation.Original_ID, err)
+			result.Failed = append(result.Failed, chapter.ID)
+			continue
+		}
+
+		result.Translated = append(result.Translated, chapter.ID)
+	}
+
+	return &result, nil
+}
+
+// Remembers on the result once the quota is spent so it is only looked up until then,
+// a failed lookup counts as spent so the job does not keep calling the provider blind
+func TranslationQuotaExceeded(userID int, result *models.TranslationJobResult) bool {
+	if !result.Quota_Exceeded {
+		exceeded, err := AIQuotaExceeded(userID)
+		if err != nil {
+			log.Printf("Error checking AI quota of user %d: %v", userID, err)
+		}
+
+		result.Quota_Exceeded = exceeded || err != nil
+	}
+
+	return result.Quota_Exceeded
+}
+
+// The glossary is put into the system prompt so names stay the same across chapters
+func BuildTranslationPrompt(translation *models.FictionTranslationModel) (string, error) {
+	terms, err := GetGlossaryTerms(translation.Fiction_ID)
+	if err != nil {
+		return "", err
+	}
+
+	prompt := strings.Builder{}
+	prompt.WriteString(strings.Replace(INTRO_TRANSLATION, "%LANGUAGE%", TranslationLanguages[translation.Language], 1))
+	if len(terms) > 0 {
+		prompt.WriteString("\n\nAlways translate these names and terms exactly as given:\n")
+		for _, term := range terms[:min(len(terms), MAX_GLOSSARY_PROMPT_TERMS)] {
+			prompt.WriteString("- " + term.Source_Term + " => " + term.Target_Term)
+			if term.Note != "" {
+				prompt.WriteString(" (" + term.Note + ")")
+			}
+
+			prompt.WriteString("\n")
+		}
+	}
+
+	return prompt.String(), nil
+}
+
+func TranslateFictionDetails(ctx context.Context, userID int, translation *models.FictionTranslationModel, systemPrompt string) error {
+	var title string
+	var subtitle string
+	var synopsis string
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Title, COALESCE(Subtitle, ''), COALESCE(Synopsis, '')
+		FROM
+			Fictions
+		WHERE
+			ID = $1
+		`,
+		translation.Original_ID,
+	).Scan(
+		&title,
+		&subtitle,
+		&synopsis,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	details := []*string{&title, &subtitle, &synopsis}
+	for _, detail := range details {
+		if strings.TrimSpace(*detail) == "" {
+			continue
+		}
+
+		translated, err := TranslateText(ctx, userID, systemPrompt, *detail)
+		if err != nil {
+			return err
+		}
+
+		*detail = translated
+	}
+
+	_, err = db.DB.Exec(
+		`
+		UPDATE Fictions
+		SET Title = $1, Subtitle = $2, Synopsis = $3
+		WHERE ID = $4
+		`,
+		TruncateText(title, 255),
+		TruncateText(subtitle, 255),
+		synopsis,
+		translation.Fiction_ID,
+	)
+
+	return err
+}
+
+// Writes the translated chapter under the same chapter ID in the edition and marks it as machine translated
+func TranslateChapter(ctx context.Context, userID int, translation *models.FictionTranslationModel, chapter models.ChapterModel, systemPrompt string) error {
+	title, err := TranslateText(ctx, userID, systemPrompt, chapter.Title)
+	if err != nil {
+		return err
+	}
+
+	content := strings.Builder{}
+	for _, chunk := range SplitChapterChunks(chapter.Content, TRANSLATION_CHUNK_TOKENS) {
+		translated, err := TranslateText(ctx, userID, systemPrompt, chunk)
+		if err != nil {
+			return err
+		}
+
+		content.WriteString(translated)
+	}
+
+	// The markers are kept in the translated content, so the footnotes they point to come along translated too
+	footnotes := []models.ChapterFootnoteModel{}
+	for _, footnote := range chapter.Footnotes {
+		text, err := TranslateText(ctx, userID, systemPrompt, footnote.Text)
+		if err != nil {
+			return err
+		}
+
+		footnotes = append(footnotes, models.ChapterFootnoteModel{ID: footnote.ID, Text: TruncateText(text, MAX_FOOTNOTE_LENGTH)})
+	}
+
+	JSONFootnotes, err := json.Marshal(footnotes)
+	if err != nil {
+		return err
+	}
+
+	title = TruncateText(title, 255)
+	fictionID := strconv.Itoa(translation.Fiction_ID)
+	chapterID := strconv.Itoa(chapter.ID)
+
+	err = SaveChapterUpdate(fictionID, chapterID, title, content.String())
+	if err == ErrChapterNotFound {
+		translated := models.ChapterModel{
+			Fiction_ID: translation.Fiction_ID,
+			ID:         chapter.ID,
+			Title:      title,
+			Content:    content.String(),
+		}
+
+		err = db.DB.QueryRow(
+			`
+			INSERT INTO Chapters (Fiction_ID, ID, Title, Content)
+			VALUES ($1, $2, $3, $4)
+			RETURNING Created
+			`,
+			translated.Fiction_ID,
+			translated.ID,
+			translated.Title,
+			translated.Content,
+		).Scan(
+			&translated.Created,
+		)
+
+		if err == nil {
+			DispatchWebhookEvent(fictionID, models.ChapterCreated, translated)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.DB.Exec("UPDATE Chapters SET Footnotes = $1::JSONB WHERE Fiction_ID = $2 AND ID = $3", string(JSONFootnotes), translation.Fiction_ID, chapter.ID); err != nil {
+		return err
+	}
+
+	_, err = db.DB.Exec(
+		`
+		INSERT INTO ChapterTranslations (Fiction_ID, Chapter_ID, Source_Hash, Status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (Fiction_ID, Chapter_ID)
+		DO UPDATE SET Source_Hash = EXCLUDED.Source_Hash, Status = EXCLUDED.Status, Reviewed_By = NULL, Updated = NOW()
+		`,
+		translation.Fiction_ID,
+		chapter.ID,
+		HashChapterContent(chapter.Content),
+		models.ChapterTranslationMachine,
+	)
+
+	return err
+}
+
+func TranslateText(ctx context.Context, userID int, systemPrompt string, text string) (string, error) {
+	temperature := 0.3
+	response, err := llm.Client.Chat(ctx, llm.ChatRequest{
+		Model: configs.TranslationModel,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: systemPrompt},
+			{Role: llm.RoleUser, Content: text},
+		},
+		Temperature: &temperature,
+		Max_Tokens: TRANSLATION_REPLY_TOKENS,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	RecordAIUsage(
+		userID,
+		models.AIFeatureTranslation,
+		response.Model,
+		response.Usage.Prompt_Tokens,
+		response.Usage.Completion_Tokens,
+		0,
+	)
+
+	return strings.TrimSpace(response.Content), nil
+}
+
+// Splits after closing paragraph tags so no chunk cuts a paragraph in half, a single huge paragraph stays whole
+func SplitChapterChunks(content string, maxTokens int) []string {
+	chunks := []string{}
+	current := strings.Builder{}
+	for _, paragraph := range strings.SplitAfter(content, "</p>") {
+		if paragraph == "" {
+			continue
+		}
+
+		if current.Len() > 0 && llm.EstimateTokens(current.String() + paragraph) > maxTokens {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+
+		current.WriteString(paragraph)
+	}
+
+	if strings.TrimSpace(current.String()) != "" {
+		chunks = append(chunks, current.String())
+	}
+
+	return chunks
+}
+
+// Chapters written directly in the edition have no translation row and count as reviewed
+func GetChapterTranslationStatuses(fictionID int) (map[int]models.ChapterTranslationStatus, error) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			C.ID, COALESCE(CT.Status, $2)
+		FROM
+			Chapters C
+		LEFT JOIN
+			ChapterTranslations CT
+		ON
+			CT.Fiction_ID = C.Fiction_ID AND CT.Chapter_ID = C.ID
+		WHERE
+			C.Fiction_ID = $1
+		`,
+		fictionID,
+		models.ChapterTranslationReviewed,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	statuses := map[int]models.ChapterTranslationStatus{}
+	for rows.Next() {
+		var chapterID int
+		var status models.ChapterTranslationStatus
+		if err := rows.Scan(&chapterID, &status); err != nil {
+			return nil, err
+		}
+
+		statuses[chapterID] = status
+	}
+
+	return statuses, nil
+}
+
+// Public so readers can see which chapters were machine translated
+func GetChapterTranslations(ctx *gin.Context) {
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			CT.Fiction_ID, CT.Chapter_ID, C.Title, CT.Status, CT.Reviewed_By, CT.Updated,
+			CT.Source_Hash != ENCODE(SHA256(CONVERT_TO(COALESCE(S.Content, ''), 'UTF8')), 'hex')
+		FROM
+			ChapterTranslations CT
+		JOIN
+			Chapters C
+		ON
+			C.Fiction_ID = CT.Fiction_ID AND C.ID = CT.Chapter_ID
+		JOIN
+			FictionTranslations FT
+		ON
+			FT.Fiction_ID = CT.Fiction_ID
+		LEFT JOIN
+			Chapters S
+		ON
+			S.Fiction_ID = FT.Original_ID AND S.ID = CT.Chapter_ID
+		WHERE
+			CT.Fiction_ID = $1
+		ORDER BY CT.Chapter_ID
+		`,
+		ctx.Param("fictionID"),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch translated chapters"})
+		return
+	}
+
+	defer rows.Close()
+	chapters := []models.ChapterTranslationModel{}
+	for rows.Next() {
+		chapter := models.ChapterTranslationModel{}
+		var reviewedBy sql.NullInt64
+		if err := rows.Scan(
+			&chapter.Fiction_ID,
+			&chapter.Chapter_ID,
+			&chapter.Title,
+			&chapter.Status,
+			&reviewedBy,
+			&chapter.Updated,
+			&chapter.Outdated,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing translated chapters"})
+			return
+		}
+
+		if reviewedBy.Valid {
+			ID := int(reviewedBy.Int64)
+			chapter.Reviewed_By = &ID
+		}
+
+		chapters = append(chapters, chapter)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, chapters)
+}
+
+// Translators mark a chapter as reviewed once they post-edited it, setting it back to machine allows retranslating it
+func EditChapterTranslation(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit a chapter."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit chapters of this fiction") {
+		return
+	}
+
+	translationForm := models.ChapterTranslationForm{}
+	if err := ctx.ShouldBindJSON(&translationForm); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+
+	var reviewedBy interface{}
+	switch translationForm.Status {
+	case models.ChapterTranslationReviewed:
+		reviewedBy = IDFromSession.(int)
+	case models.ChapterTranslationMachine:
+	default:
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Status must be machine or reviewed"})
+		return
+	}
+
+	result, err := db.DB.Exec(
+		`
+		UPDATE ChapterTranslations
+		SET Status = $1, Reviewed_By = $2, Updated = NOW()
+		WHERE Fiction_ID = $3 AND Chapter_ID = $4
+		`,
+		translationForm.Status,
+		reviewedBy,
+		fictionID,
+		ctx.Param("chapterID"),
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update translation status"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Translated chapter not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Translation status updated"})
+}
+
+// VARCHAR limits count characters, cutting bytes would split Thai and other multi-byte text
+func TruncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit])
+}
@@ -17,6 +17,11 @@ import (
 )
 
 func UploadImageToFirebase(file multipart.File, fileHeader *multipart.FileHeader, objectPath string, bucketName string) (string, error) {
+	return UploadBytesToFirebase(file, fileHeader.Header.Get("Content-Type"), objectPath, bucketName)
+}
+
+// Same as UploadImageToFirebase for content that did not come from a form, such as generated images
+func UploadBytesToFirebase(reader io.Reader, contentType string, objectPath string, bucketName string) (string, error) {
 	ctx := context.Background()
 
 	storageClient, err := configs.FirebaseApp.Storage(ctx)
@@ -30,9 +35,9 @@ func UploadImageToFirebase(file multipart.File, fileHeader *multipart.FileHeader
 	}
 
 	writer := bucket.Object(objectPath).NewWriter(ctx)
-	writer.ContentType = fileHeader.Header.Get("Content-Type")
+	writer.ContentType = contentType
 	writer.CacheControl = "no-cache, max-age=0"
-	if _, err := io.Copy(writer, file); err != nil {
+	if _, err := io.Copy(writer, reader); err != nil {
 		return "", fmt.Errorf("failed to upload a file: %v", err)
 	}
 
@@ -48,6 +53,54 @@ func UploadImageToFirebase(file multipart.File, fileHeader *multipart.FileHeader
 	return publicURL, nil
 }
 
+func DownloadImageFromFirebase(objectPath string, bucketName string) ([]byte, string, error) {
+	ctx := context.Background()
+
+	storageClient, err := configs.FirebaseApp.Storage(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get the Firebase storage client: %v", err)
+	}
+
+	bucket, err := storageClient.Bucket(bucketName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get the default bucket: %v", err)
+	}
+
+	reader, err := bucket.Object(objectPath).NewReader(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open a file: %v", err)
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read a file: %v", err)
+	}
+
+	return data, reader.Attrs.ContentType, nil
+}
+
+func DeleteImageFromFirebase(objectPath string, bucketName string) error {
+	ctx := context.Background()
+
+	storageClient, err := configs.FirebaseApp.Storage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the Firebase storage client: %v", err)
+	}
+
+	bucket, err := storageClient.Bucket(bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to get the default bucket: %v", err)
+	}
+
+	if err := bucket.Object(objectPath).Delete(ctx); err != nil && err != gsc.ErrObjectNotExist {
+		return fmt.Errorf("failed to delete a file: %v", err)
+	}
+
+	return nil
+}
+
 func UploadChapterImage(ctx *gin.Context) {
 	err := ctx.Request.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
@@ -3,17 +3,35 @@ package handlers
 import (
 	"fmt"
 	"time"
+	"bytes"
+	"strings"
+	"strconv"
+	"net/url"
 	"net/http"
 	"database/sql"
+	"unicode/utf8"
+	"github.com/lib/pq"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 
 	db "github.com/Fictsu/Fictsu/database"
 	models "github.com/Fictsu/Fictsu/models"
+	configs "github.com/Fictsu/Fictsu/configs"
 )
 
-func GetUserProfile(ctx *gin.Context, store *sessions.CookieStore) {
-	session, errSess := store.Get(ctx.Request, "fictsu-session")
+var ErrEmailTaken = fmt.Errorf("an account with this email already exists")
+
+const (
+	MAX_DISPLAY_NAME_LENGTH int = 255
+	MAX_BIO_LENGTH          int = 1000
+	MAX_PROFILE_LINKS       int = 5
+)
+
+// The avatar is held to the same limit as a page image, the form fields get the remaining megabyte
+const MAX_PROFILE_UPLOAD_SIZE int64 = MAX_PAGE_IMAGE_SIZE + 1 << 20
+
+func GetUserProfile(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
 	if errSess != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
 		return
@@ -30,7 +48,8 @@ func GetUserProfile(ctx *gin.Context, store *sessions.CookieStore) {
 	err := db.DB.QueryRow(
 		`
 		SELECT
-			ID, User_ID, Super_User, Name, Email, Avatar_URL, Joined
+			ID, COALESCE(User_ID, ''), Super_User, Name, COALESCE(Email, ''), Avatar_URL,
+			COALESCE(Display_Name, ''), Bio, Links, Public_Favorites, Joined
 		FROM
 			Users
 		WHERE
@@ -44,6 +63,10 @@ func GetUserProfile(ctx *gin.Context, store *sessions.CookieStore) {
 		&user.Name,
 		&user.Email,
 		&user.Avatar_URL,
+		&user.Display_Name,
+		&user.Bio,
+		pq.Array(&user.Links),
+		&user.Public_Favorites,
 		&user.Joined,
 	)
 
@@ -75,18 +98,245 @@ func GetUserProfile(ctx *gin.Context, store *sessions.CookieStore) {
 	ctx.IndentedJSON(http.StatusOK, gin.H{"User_Profile": user})
 }
 
-func GetUser(userID string) (*models.UserModel, error) {
-	user := models.UserModel{}
+func GetPublicUserProfile(ctx *gin.Context) {
+	userID := ctx.Param("userID")
+	user := models.PublicUserModel{}
+	var publicFavorites bool
 	err := db.DB.QueryRow(
 		`
 		SELECT
-			ID, User_ID, Name, Email, Avatar_URL, Joined
+			ID, Name, COALESCE(Display_Name, ''), COALESCE(Avatar_URL, ''),
+			Bio, Links, Public_Favorites, Joined
 		FROM
 			Users
 		WHERE
-			User_ID = $1
+			ID = $1
 		`,
 		userID,
+	).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Display_Name,
+		&user.Avatar_URL,
+		&user.Bio,
+		pq.Array(&user.Links),
+		&publicFavorites,
+		&user.Joined,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve user details"})
+		}
+
+		return
+	}
+
+	contriFictions, err := GetContributedFictions(user.ID)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve contributed fictions"})
+		return
+	}
+
+	// Favorites are only listed when the user has chosen to share them
+	favFictions := []models.FictionModel{}
+	if publicFavorites {
+		favFictions, err = GetFavFictions(user.ID)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve favorite fictions"})
+			return
+		}
+	}
+
+	user.Fav_Fictions = favFictions
+	user.Contributed_Fic = contriFictions
+	ctx.IndentedJSON(http.StatusOK, gin.H{"User_Profile": user})
+}
+
+func EditUserProfile(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit your profile."})
+		return
+	}
+
+	IDToDB := IDFromSession.(int)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MAX_PROFILE_UPLOAD_SIZE)
+	profileUpdateRequest := models.UserProfileForm{}
+	if err := ctx.ShouldBind(&profileUpdateRequest); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data, avatars are limited to " + strconv.FormatInt(MAX_PAGE_IMAGE_SIZE >> 20, 10) + "MB"})
+		return
+	}
+
+	query := "UPDATE Users SET "
+	params := []interface{}{}
+	paramIndex := 1
+
+	// Display name is a pointer too, an empty one resets it so the account name is shown again
+	if profileUpdateRequest.Display_Name != nil {
+		displayName := strings.TrimSpace(*profileUpdateRequest.Display_Name)
+		if utf8.RuneCountInString(displayName) > MAX_DISPLAY_NAME_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Display name is too long"})
+			return
+		}
+
+		query += "Display_Name = NULLIF($" + strconv.Itoa(paramIndex) + ", ''), "
+		params = append(params, displayName)
+		paramIndex++
+	}
+
+	// Bio is a pointer so that it can be cleared with an empty string
+	if profileUpdateRequest.Bio != nil {
+		if utf8.RuneCountInString(*profileUpdateRequest.Bio) > MAX_BIO_LENGTH {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Bio is too long"})
+			return
+		}
+
+		query += "Bio = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, *profileUpdateRequest.Bio)
+		paramIndex++
+	}
+
+	if profileUpdateRequest.Links != nil {
+		if err := ValidateProfileLinks(profileUpdateRequest.Links); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		query += "Links = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, pq.Array(profileUpdateRequest.Links))
+		paramIndex++
+	}
+
+	if profileUpdateRequest.Public_Favorites != nil {
+		query += "Public_Favorites = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, *profileUpdateRequest.Public_Favorites)
+		paramIndex++
+	}
+
+	// The avatar is checked and uploaded before anything is written, so a rejected one leaves the profile as it was.
+	// Like page images its type is sniffed from the bytes and that type is stored, not the one the client sent.
+	avatarURL := ""
+	if header, errFile := ctx.FormFile("avatar"); errFile == nil {
+		avatar, err := ReadPageUpload(header)
+		if err != nil {
+			if err == ErrPageTooLarge {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Avatars are limited to " + strconv.FormatInt(MAX_PAGE_IMAGE_SIZE >> 20, 10) + "MB"})
+			} else {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Avatar must be a JPEG, PNG, GIF or WebP image"})
+			}
+
+			return
+		}
+
+		avatarPath := configs.AvatarPath + strconv.Itoa(IDToDB)
+		avatarURL, err = UploadBytesToFirebase(bytes.NewReader(avatar.data), avatar.contentType, avatarPath, configs.BucketName)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to upload avatar"})
+			return
+		}
+
+		query += "Avatar_URL = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, avatarURL)
+		paramIndex++
+	}
+
+	if len(params) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No valid fields provided for update"})
+		return
+	}
+
+	query = query[:len(query) - 2] + " WHERE ID = $" + strconv.Itoa(paramIndex)
+	params = append(params, IDToDB)
+	if _, err := db.DB.Exec(query, params...); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update profile"})
+		return
+	}
+
+	if avatarURL != "" {
+		session.Values["avatar_URL"] = avatarURL
+		session.Save(ctx.Request, ctx.Writer)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Profile updated successfully"})
+}
+
+func ValidateProfileLinks(links []string) error {
+	if len(links) > MAX_PROFILE_LINKS {
+		return fmt.Errorf("At most %d links are allowed", MAX_PROFILE_LINKS)
+	}
+
+	for _, link := range links {
+		parsedURL, err := url.Parse(link)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return fmt.Errorf("Invalid link: %s", link)
+		}
+	}
+
+	return nil
+}
+
+func GetUserByID(ID int) (*models.UserModel, error) {
+	user := models.UserModel{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			ID, COALESCE(User_ID, ''), Super_User, Name, COALESCE(Email, ''), COALESCE(Avatar_URL, ''),
+			COALESCE(Display_Name, ''), Bio, Links, Public_Favorites, Joined
+		FROM
+			Users
+		WHERE
+			ID = $1
+		`,
+		ID,
+	).Scan(
+		&user.ID,
+		&user.User_ID,
+		&user.Super_User,
+		&user.Name,
+		&user.Email,
+		&user.Avatar_URL,
+		&user.Display_Name,
+		&user.Bio,
+		pq.Array(&user.Links),
+		&user.Public_Favorites,
+		&user.Joined,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// No user found
+			return nil, nil
+		} else {
+			return nil, fmt.Errorf("failed to retrieve user from database: %v", err)
+		}
+	}
+
+	return &user, nil
+}
+
+func GetUserByIdentity(provider string, providerUserID string) (*models.UserModel, error) {
+	user := models.UserModel{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			U.ID, COALESCE(U.User_ID, ''), U.Name, COALESCE(U.Email, ''), COALESCE(U.Avatar_URL, ''), U.Joined
+		FROM
+			UserIdentities I
+		JOIN
+			Users U ON I.User_ID = U.ID
+		WHERE
+			I.Provider = $1 AND I.Provider_User_ID = $2
+		`,
+		provider,
+		providerUserID,
 	).Scan(
 		&user.ID,
 		&user.User_ID,
@@ -107,31 +357,83 @@ func GetUser(userID string) (*models.UserModel, error) {
 	return &user, nil
 }
 
-func CreateUser(user *models.UserModel) (*models.UserModel, error) {
+// Creates the account together with the login identity it was created from
+func CreateUser(user *models.UserModel, identity *models.UserIdentityModel) (*models.UserModel, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user account: %v", err)
+	}
+
+	defer tx.Rollback()
+
 	var newUserID int
-	var newUserGoogleID string
 	var newUserJoined time.Time
-	err := db.DB.QueryRow(
+	err = tx.QueryRow(
 		`
-		INSERT INTO Users (User_ID, Name, Email, Avatar_URL)
-		VALUES ($1, $2, $3, $4)
-		RETURNING ID, User_ID, Joined
+		INSERT INTO Users (Name, Email, Avatar_URL)
+		VALUES ($1, NULLIF($2, ''), $3)
+		RETURNING ID, Joined
 		`,
-		user.User_ID,
 		user.Name,
 		user.Email,
 		user.Avatar_URL,
 	).Scan(
 		&newUserID,
-		&newUserGoogleID,
 		&newUserJoined,
 	)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505: Unique violation
+			return nil, ErrEmailTaken
+		}
+
+		return nil, fmt.Errorf("failed to create user account: %v", err)
+	}
+
+	identity.User_ID = newUserID
+	if err := InsertUserIdentity(tx, identity); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to create user account: %v", err)
 	}
 
 	user.ID = newUserID
-	user.User_ID = newUserGoogleID
 	user.Joined = newUserJoined
 	return user, nil
 }
+
+// Writes 403 and returns false unless the user is a super user
+func CheckSuperUser(ctx *gin.Context, userID int, action string) bool {
+	var superUser bool
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			Super_User
+		FROM
+			Users
+		WHERE
+			ID = $1
+		`,
+		userID,
+	).Scan(
+		&superUser,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return false
+		}
+
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user data"})
+		return false
+	}
+
+	if !superUser {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{"Error": "You do not have permission to " + action})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,668 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+	"bytes"
+	"strings"
+	"syscall"
+	"strconv"
+	"net/url"
+	"net/http"
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+
+	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
+)
+
+const (
+	WEBHOOK_MAX_ATTEMPTS int           = 5
+	WEBHOOK_BASE_BACKOFF time.Duration = 2 * time.Second
+	WEBHOOK_TIMEOUT      time.Duration = 10 * time.Second
+)
+
+var ErrWebhookAddress = fmt.Errorf("webhook URL resolves to a local address")
+
+// The address is checked at dial time, after DNS, so a public hostname that resolves to an internal IP is refused.
+// Redirects are not followed since they could send the delivery on to an internal URL.
+var webhookClient = &http.Client{
+	Timeout: WEBHOOK_TIMEOUT,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: WEBHOOK_TIMEOUT, Control: CheckWebhookDial}).DialContext,
+		TLSHandshakeTimeout: WEBHOOK_TIMEOUT,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// 100.64.0.0/10 is carrier-grade NAT space, often used for internal cloud networks
+var _, sharedAddressSpace, _ = net.ParseCIDR("100.64.0.0/10")
+
+var webhookEvents = map[models.WebhookEvent]bool{
+	models.ChapterCreated:       true,
+	models.ChapterUpdated:       true,
+	models.ChapterDeleted:       true,
+	models.FictionStatusChanged: true,
+	models.FictionFavorited:     true,
+}
+
+func GetWebhooks(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view webhooks."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view webhooks of this fiction") {
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			ID, Fiction_ID, URL, Events, Active, Created
+		FROM
+			Webhooks
+		WHERE
+			Fiction_ID = $1
+		ORDER BY ID
+		`,
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch webhooks"})
+		return
+	}
+
+	defer rows.Close()
+	webhooks := []models.WebhookModel{}
+	for rows.Next() {
+		webhook := models.WebhookModel{}
+		if err := rows.Scan(
+			&webhook.ID,
+			&webhook.Fiction_ID,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&webhook.Created,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing webhooks"})
+			return
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, webhooks)
+}
+
+func CreateWebhook(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to create a webhook."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "create webhooks for this fiction") {
+		return
+	}
+
+	webhookCreateRequest := models.WebhookForm{}
+	if err := ctx.ShouldBindJSON(&webhookCreateRequest); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid data provided for webhook creation"})
+		return
+	}
+
+	if err := ValidateWebhookURL(webhookCreateRequest.URL); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+
+	if err := ValidateWebhookEvents(webhookCreateRequest.Events); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+
+	secret, err := GenerateWebhookSecret()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate webhook secret"})
+		return
+	}
+
+	active := true
+	if webhookCreateRequest.Active != nil {
+		active = *webhookCreateRequest.Active
+	}
+
+	webhook := models.WebhookModel{}
+	errInsert := db.DB.QueryRow(
+		`
+		INSERT INTO Webhooks (Fiction_ID, URL, Secret, Events, Active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ID, Fiction_ID, URL, Secret, Events, Active, Created
+		`,
+		fictionID,
+		webhookCreateRequest.URL,
+		secret,
+		pq.Array(webhookCreateRequest.Events),
+		active,
+	).Scan(
+		&webhook.ID,
+		&webhook.Fiction_ID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.Events),
+		&webhook.Active,
+		&webhook.Created,
+	)
+
+	if errInsert != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create webhook"})
+		return
+	}
+
+	// The secret is only revealed once, receivers use it to verify signatures
+	ctx.IndentedJSON(http.StatusCreated, webhook)
+}
+
+func EditWebhook(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to edit a webhook."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	webhookID := ctx.Param("webhookID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "edit webhooks of this fiction") {
+		return
+	}
+
+	webhookUpdateRequest := models.WebhookForm{}
+	if err := ctx.ShouldBindJSON(&webhookUpdateRequest); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+		return
+	}
+
+	query := "UPDATE Webhooks SET "
+	params := []interface{}{}
+	paramIndex := 1
+
+	if webhookUpdateRequest.URL != "" {
+		if err := ValidateWebhookURL(webhookUpdateRequest.URL); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		query += "URL = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, webhookUpdateRequest.URL)
+		paramIndex++
+	}
+
+	if webhookUpdateRequest.Events != nil {
+		if err := ValidateWebhookEvents(webhookUpdateRequest.Events); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		query += "Events = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, pq.Array(webhookUpdateRequest.Events))
+		paramIndex++
+	}
+
+	if webhookUpdateRequest.Active != nil {
+		query += "Active = $" + strconv.Itoa(paramIndex) + ", "
+		params = append(params, *webhookUpdateRequest.Active)
+		paramIndex++
+	}
+
+	if len(params) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"Error": "No valid fields provided for update"})
+		return
+	}
+
+	query = query[:len(query) - 2] + " WHERE ID = $" + strconv.Itoa(paramIndex) + " AND Fiction_ID = $" + strconv.Itoa(paramIndex + 1)
+	params = append(params, webhookID, fictionID)
+	result, err := db.DB.Exec(query, params...)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update webhook"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Webhook not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Webhook updated successfully"})
+}
+
+func DeleteWebhook(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to delete a webhook."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	webhookID := ctx.Param("webhookID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "delete webhooks of this fiction") {
+		return
+	}
+
+	result, err := db.DB.Exec(
+		`
+		DELETE FROM
+			Webhooks
+		WHERE
+			ID = $1 AND Fiction_ID = $2
+		`,
+		webhookID,
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete webhook"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Webhook not found"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{"Message": "Webhook deleted successfully"})
+}
+
+func GetWebhookDeliveries(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to view webhook deliveries."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	webhookID := ctx.Param("webhookID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "view webhooks of this fiction") {
+		return
+	}
+
+	rows, err := db.DB.Query(
+		`
+		SELECT
+			D.ID, D.Webhook_ID, D.Event, D.Payload, D.Status_Code,
+			D.Success, D.Attempts, D.Error, D.Created, D.Updated
+		FROM
+			WebhookDeliveries D
+		JOIN
+			Webhooks W ON D.Webhook_ID = W.ID
+		WHERE
+			W.ID = $1 AND W.Fiction_ID = $2
+		ORDER BY D.ID DESC
+		LIMIT 100
+		`,
+		webhookID,
+		fictionID,
+	)
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch webhook deliveries"})
+		return
+	}
+
+	defer rows.Close()
+	deliveries := []models.WebhookDeliveryModel{}
+	for rows.Next() {
+		delivery := models.WebhookDeliveryModel{}
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.Webhook_ID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status_Code,
+			&delivery.Success,
+			&delivery.Attempts,
+			&delivery.Error,
+			&delivery.Created,
+			&delivery.Updated,
+		); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Error processing webhook deliveries"})
+			return
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, deliveries)
+}
+
+func SendTestWebhook(ctx *gin.Context, store sessions.Store) {
+	session, errSess := GetSession(ctx, store)
+	if errSess != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to get session"})
+		return
+	}
+
+	IDFromSession := session.Values["ID"]
+	if IDFromSession == nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized. Please log in to test a webhook."})
+		return
+	}
+
+	fictionID := ctx.Param("fictionID")
+	webhookID := ctx.Param("webhookID")
+	if !CheckFictionOwner(ctx, fictionID, IDFromSession.(int), "test webhooks of this fiction") {
+		return
+	}
+
+	webhook := models.WebhookModel{}
+	err := db.DB.QueryRow(
+		`
+		SELECT
+			ID, Fiction_ID, URL, Secret
+		FROM
+			Webhooks
+		WHERE
+			ID = $1 AND Fiction_ID = $2
+		`,
+		webhookID,
+		fictionID,
+	).Scan(
+		&webhook.ID,
+		&webhook.Fiction_ID,
+		&webhook.URL,
+		&webhook.Secret,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{"Error": "Webhook not found"})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to retrieve webhook"})
+		}
+
+		return
+	}
+
+	payload := models.WebhookPayload{
+		Event:      models.WebhookTest,
+		Fiction_ID: webhook.Fiction_ID,
+		Timestamp:  time.Now().UTC(),
+		Data:       gin.H{"message": "This is a test delivery from Fictsu."},
+	}
+
+	// Test deliveries are sent once and synchronously so the owner sees the result right away
+	delivery, err := DeliverWebhook(webhook, payload, 1)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"Error": "Failed to send test delivery"})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, delivery)
+}
+
+// Sends an event to every active webhook of the fiction subscribed to it.
+// Delivery happens in the background so handlers never wait on receivers.
+func DispatchWebhookEvent(fictionID string, event models.WebhookEvent, data interface{}) {
+	fictionIDInt, err := strconv.Atoi(fictionID)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		rows, err := db.DB.Query(
+			`
+			SELECT
+				ID, Fiction_ID, URL, Secret
+			FROM
+				Webhooks
+			WHERE
+				Fiction_ID = $1 AND Active AND $2 = ANY(Events)
+			`,
+			fictionIDInt,
+			string(event),
+		)
+
+		if err != nil {
+			log.Printf("Error fetching %s webhooks of fiction %d: %v", event, fictionIDInt, err)
+			return
+		}
+
+		webhooks := []models.WebhookModel{}
+		for rows.Next() {
+			webhook := models.WebhookModel{}
+			if err := rows.Scan(
+				&webhook.ID,
+				&webhook.Fiction_ID,
+				&webhook.URL,
+				&webhook.Secret,
+			); err != nil {
+				log.Printf("Error processing %s webhooks of fiction %d: %v", event, fictionIDInt, err)
+				rows.Close()
+				return
+			}
+
+			webhooks = append(webhooks, webhook)
+		}
+
+		rows.Close()
+		payload := models.WebhookPayload{
+			Event:      event,
+			Fiction_ID: fictionIDInt,
+			Timestamp:  time.Now().UTC(),
+			Data:       data,
+		}
+
+		for _, webhook := range webhooks {
+			go DeliverWebhook(webhook, payload, WEBHOOK_MAX_ATTEMPTS)
+		}
+	}()
+}
+
+// Posts the signed payload, retrying with exponential backoff, and keeps the delivery log up to date.
+func DeliverWebhook(webhook models.WebhookModel, payload models.WebhookPayload, maxAttempts int) (*models.WebhookDeliveryModel, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := models.WebhookDeliveryModel{
+		Webhook_ID: webhook.ID,
+		Event:      payload.Event,
+		Payload:    string(body),
+	}
+
+	err = db.DB.QueryRow(
+		`
+		INSERT INTO WebhookDeliveries (Webhook_ID, Event, Payload)
+		VALUES ($1, $2, $3)
+		RETURNING ID, Created, Updated
+		`,
+		delivery.Webhook_ID,
+		delivery.Event,
+		delivery.Payload,
+	).Scan(
+		&delivery.ID,
+		&delivery.Created,
+		&delivery.Updated,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery.Attempts = attempt
+		delivery.Status_Code, err = PostWebhook(webhook, delivery.ID, delivery.Event, body)
+		delivery.Success = err == nil
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		db.DB.QueryRow(
+			`
+			UPDATE WebhookDeliveries
+			SET Status_Code = $1, Success = $2, Attempts = $3, Error = $4, Updated = NOW()
+			WHERE ID = $5
+			RETURNING Updated
+			`,
+			delivery.Status_Code,
+			delivery.Success,
+			delivery.Attempts,
+			delivery.Error,
+			delivery.ID,
+		).Scan(
+			&delivery.Updated,
+		)
+
+		if delivery.Success || attempt == maxAttempts {
+			break
+		}
+
+		// 2s, 4s, 8s, 16s...
+		time.Sleep(WEBHOOK_BASE_BACKOFF << (attempt - 1))
+	}
+
+	return &delivery, nil
+}
+
+func PostWebhook(webhook models.WebhookModel, deliveryID int, event models.WebhookEvent, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Fictsu-Webhook/1.0")
+	request.Header.Set("X-Fictsu-Event", string(event))
+	request.Header.Set("X-Fictsu-Delivery", strconv.Itoa(deliveryID))
+	request.Header.Set("X-Fictsu-Timestamp", timestamp)
+	request.Header.Set("X-Fictsu-Signature", "sha256=" + SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("receiver responded with status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// HMAC-SHA256 over "<timestamp>.<body>" so receivers can reject replayed deliveries
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func ValidateWebhookURL(rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("Webhook URL must be an absolute http(s) URL")
+	}
+
+	hostname := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return fmt.Errorf("Webhook URL must not point to a local address")
+	}
+
+	if IP := net.ParseIP(hostname); IP != nil && !IsPublicIP(IP) {
+		return fmt.Errorf("Webhook URL must not point to a local address")
+	}
+
+	return nil
+}
+
+// Runs on every connection the webhook client opens, with the address DNS actually resolved to
+func CheckWebhookDial(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if IP := net.ParseIP(host); IP == nil || !IsPublicIP(IP) {
+		return ErrWebhookAddress
+	}
+
+	return nil
+}
+
+func IsPublicIP(IP net.IP) bool {
+	return !(IP.IsLoopback() || IP.IsPrivate() || IP.IsLinkLocalUnicast() || IP.IsLinkLocalMulticast() || IP.IsInterfaceLocalMulticast() || IP.IsMulticast() || IP.IsUnspecified() || sharedAddressSpace.Contains(IP))
+}
+
+func ValidateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("At least one event must be selected")
+	}
+
+	for _, event := range events {
+		if !webhookEvents[models.WebhookEvent(event)] {
+			return fmt.Errorf("Unknown webhook event: %s", event)
+		}
+	}
+
+	return nil
+}
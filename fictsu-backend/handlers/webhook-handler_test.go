@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://example.com/hooks/fictsu"},
+		{url: "http://example.com:8080/hook"},
+		{url: "https://93.184.216.34/hook"},
+		{url: "https://[2606:4700::1111]/hook"},
+		{url: "ftp://example.com/hook", wantErr: true},
+		{url: "example.com/hook", wantErr: true},
+		{url: "https:///hook", wantErr: true},
+		{url: "://missing-scheme", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://LOCALHOST./hook", wantErr: true},
+		{url: "http://api.localhost/hook", wantErr: true},
+		{url: "http://127.0.0.1/hook", wantErr: true},
+		{url: "http://10.1.2.3/hook", wantErr: true},
+		{url: "http://172.16.0.1/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://100.64.0.1/hook", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://[fe80::1]/hook", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := ValidateWebhookURL(test.url)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ValidateWebhookURL(%q) = %v, want error %v", test.url, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookDial(t *testing.T) {
+	tests := []struct {
+		address string
+		want    error
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:4700::1111]:443"},
+		{address: "127.0.0.1:80", want: ErrWebhookAddress},
+		{address: "10.0.0.5:443", want: ErrWebhookAddress},
+		{address: "169.254.169.254:80", want: ErrWebhookAddress},
+		{address: "100.100.100.100:80", want: ErrWebhookAddress},
+		{address: "[::1]:443", want: ErrWebhookAddress},
+		{address: "[::ffff:192.168.0.1]:443", want: ErrWebhookAddress},
+		{address: "example.com:443", want: ErrWebhookAddress},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			if err := CheckWebhookDial("tcp", test.address, nil); err != test.want {
+				t.Fatalf("CheckWebhookDial(%q) = %v, want %v", test.address, err, test.want)
+			}
+		})
+	}
+}
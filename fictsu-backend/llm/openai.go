@@ -0,0 +1,272 @@
+package llm
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"bytes"
+	"bufio"
+	"context"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"encoding/base64"
+)
+
+const (
+	OPENAI_BASE_URL  string        = "https://api.openai.com/v1"
+	PROVIDER_TIMEOUT time.Duration = 5 * time.Minute
+)
+
+// Speaks the OpenAI HTTP API, which Ollama, llama.cpp server and LocalAI also implement under /v1
+type OpenAIProvider struct {
+	BaseURL string
+	Headers map[string]string
+	// The timeout covers reading the whole body too, so it is long enough for a streamed reply from a slow local model
+	HTTP    *http.Client
+}
+
+func NewOpenAIProvider(key string, orgID string, projID string) *OpenAIProvider {
+	return &OpenAIProvider{
+		BaseURL: OPENAI_BASE_URL,
+		Headers: map[string]string{
+			"Authorization":       "Bearer " + key,
+			"OpenAI-Organization": orgID,
+			"OpenAI-Project":      projID,
+		},
+		HTTP: &http.Client{Timeout: PROVIDER_TIMEOUT},
+	}
+}
+
+// Local servers usually ignore the key, but some proxies in front of them require one
+func NewLocalProvider(baseURL string, key string) *OpenAIProvider {
+	headers := map[string]string{}
+	if key != "" {
+		headers["Authorization"] = "Bearer " + key
+	}
+
+	return &OpenAIProvider{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Headers: headers,
+		HTTP:    &http.Client{Timeout: PROVIDER_TIMEOUT},
+	}
+}
+
+type chatCompletionRequest struct {
+	Model          string            `json:"model"`
+	Messages       []Message         `json:"messages"`
+	Temperature    *float64          `json:"temperature,omitempty"`
+	MaxTokens      int               `json:"max_tokens,omitempty"`
+	Stream         bool              `json:"stream,omitempty"`
+	StreamOptions  map[string]bool   `json:"stream_options,omitempty"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+type imageGenerationResponse struct {
+	Data []struct {
+		URL     string `json:"url"`
+		B64JSON string `json:"b64_json"`
+	} `json:"data"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (provider *OpenAIProvider) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	response, err := provider.post(ctx, "/chat/completions", newChatCompletionRequest(request, false))
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	completion := chatCompletionResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("failed to decode chat completion: %v", err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return nil, ErrNoChoices
+	}
+
+	chatResponse := &ChatResponse{
+		Model:   request.Model,
+		Content: completion.Choices[0].Message.Content,
+	}
+
+	if completion.Usage != nil {
+		chatResponse.Usage = *completion.Usage
+	}
+
+	return chatResponse, nil
+}
+
+// Reads the server-sent events of a streamed completion, onDelta gets every piece of content as it arrives.
+// Cancelling ctx closes the upstream connection, which stops generation on the provider side too.
+func (provider *OpenAIProvider) ChatStream(ctx context.Context, request ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	response, err := provider.post(ctx, "/chat/completions", newChatCompletionRequest(request, true))
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	chatResponse := &ChatResponse{Model: request.Model}
+	content := strings.Builder{}
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64 * 1024), 1024 * 1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		chunk := chatCompletionResponse{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode stream chunk: %v", err)
+		}
+
+		// The final chunk carries the usage and no choices
+		if chunk.Usage != nil {
+			chatResponse.Usage = *chunk.Usage
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			chatResponse.Content = content.String()
+			return chatResponse, err
+		}
+	}
+
+	chatResponse.Content = content.String()
+	if err := scanner.Err(); err != nil {
+		return chatResponse, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return chatResponse, err
+	}
+
+	return chatResponse, nil
+}
+
+func (provider *OpenAIProvider) GenerateImage(ctx context.Context, request ImageRequest) (*ImageResponse, error) {
+	response, err := provider.post(ctx, "/images/generations", map[string]interface{}{
+		"model":  request.Model,
+		"prompt": request.Prompt,
+		"size":   request.Size,
+		"n":      1,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	generation := imageGenerationResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&generation); err != nil {
+		return nil, fmt.Errorf("failed to decode image generation: %v", err)
+	}
+
+	if len(generation.Data) == 0 {
+		return nil, ErrNoChoices
+	}
+
+	imageResponse := &ImageResponse{
+		Model: request.Model,
+		URL:   generation.Data[0].URL,
+	}
+
+	if generation.Data[0].B64JSON != "" {
+		data, err := base64.StdEncoding.DecodeString(generation.Data[0].B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image data: %v", err)
+		}
+
+		imageResponse.Data = data
+	}
+
+	return imageResponse, nil
+}
+
+// Sends a JSON request and turns non-2xx answers into errors carrying the provider's message
+func (provider *OpenAIProvider) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	JSONBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", provider.BaseURL + path, bytes.NewBuffer(JSONBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range provider.Headers {
+		if value != "" {
+			request.Header.Set(key, value)
+		}
+	}
+
+	response, err := provider.HTTP.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 64 * 1024))
+		providerError := errorResponse{}
+		if json.Unmarshal(body, &providerError) == nil && providerError.Error.Message != "" {
+			return nil, fmt.Errorf("provider returned %d: %s", response.StatusCode, providerError.Error.Message)
+		}
+
+		return nil, fmt.Errorf("provider returned %d", response.StatusCode)
+	}
+
+	return response, nil
+}
+
+func newChatCompletionRequest(request ChatRequest, stream bool) chatCompletionRequest {
+	completionRequest := chatCompletionRequest{
+		Model:       request.Model,
+		Messages:    request.Messages,
+		Temperature: request.Temperature,
+		MaxTokens:   request.Max_Tokens,
+		Stream:      stream,
+	}
+
+	if stream {
+		completionRequest.StreamOptions = map[string]bool{"include_usage": true}
+	}
+
+	if request.JSON {
+		completionRequest.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+
+	return completionRequest
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"log"
+	"errors"
+	"context"
+
+	configs "github.com/Fictsu/Fictsu/configs"
+)
+
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature *float64
+	Max_Tokens  int
+	JSON        bool
+}
+
+type Usage struct {
+	Prompt_Tokens     int `json:"prompt_tokens"`
+	Completion_Tokens int `json:"completion_tokens"`
+}
+
+type ChatResponse struct {
+	Model   string
+	Content string
+	Usage   Usage
+}
+
+type ImageRequest struct {
+	Model  string
+	Prompt string
+	Size   string
+}
+
+// Either URL or Data is set, depending on what the backend returns
+type ImageResponse struct {
+	Model string
+	URL   string
+	Data  []byte
+}
+
+// Called for every chunk of a streamed completion, returning an error stops the stream
+type StreamHandler func(delta string) error
+
+type Provider interface {
+	Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error)
+	ChatStream(ctx context.Context, request ChatRequest, onDelta StreamHandler) (*ChatResponse, error)
+	GenerateImage(ctx context.Context, request ImageRequest) (*ImageResponse, error)
+}
+
+var ErrNoChoices = errors.New("no choices returned from the model")
+
+// Rough count of about four characters per token, good enough for budgeting and missing usage reports
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func EstimateUsage(prompt string, completion string) Usage {
+	return Usage{
+		Prompt_Tokens:     EstimateTokens(prompt),
+		Completion_Tokens: EstimateTokens(completion),
+	}
+}
+
+// Selected by LLM_PROVIDER, used by every AI handler
+var Client Provider
+
+func InitProvider() {
+	switch configs.LLMProvider {
+	case "local":
+		Client = NewLocalProvider(configs.LLMBaseURL, configs.LLMAPIKey)
+	case "openai":
+		Client = NewOpenAIProvider(configs.OpenAIKey, configs.OpenAIOrgID, configs.OpenAIProjID)
+	default:
+		log.Fatalf("Unknown LLM provider: %q", configs.LLMProvider)
+	}
+}
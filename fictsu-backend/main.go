@@ -1,14 +1,18 @@
 package main
 
 import (
+	"log"
 	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/markbates/goth"
-	"github.com/gorilla/sessions"
 	"github.com/gin-contrib/cors"
 	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/discord"
 
+	llm "github.com/Fictsu/Fictsu/llm"
 	db "github.com/Fictsu/Fictsu/database"
+	models "github.com/Fictsu/Fictsu/models"
 	configs "github.com/Fictsu/Fictsu/configs"
 	handlers "github.com/Fictsu/Fictsu/handlers"
 )
@@ -16,93 +20,380 @@ import (
 func main() {
 	configs.LoadEnv()
 
-	store := sessions.NewCookieStore([]byte(configs.SessionKey))
-	store.Options = &sessions.Options{
-		HttpOnly: true,
-		Secure:   false,
-		Path:     "/",
-	}
+	store := db.NewPostgresStore(
+		configs.SessionIdleTimeout,
+		configs.SessionAbsoluteTimeout,
+		[]byte(configs.SessionKey),
+	)
+	store.Options.Secure = configs.CookieSecure
+	store.Options.Domain = configs.CookieDomain
+	store.SameSite = configs.CookieSameSite
 
-	goth.UseProviders(
+	providers := []goth.Provider{
 		google.New(
 			configs.ClientID,
 			configs.ClientSecret,
 			configs.ClientCallbackURL,
 			"email", "profile",
 		),
-	)
+	}
+
+	if configs.GitHubClientID != "" {
+		providers = append(providers, github.New(
+			configs.GitHubClientID,
+			configs.GitHubClientSecret,
+			configs.GitHubCallbackURL,
+			"read:user", "user:email",
+		))
+	}
+
+	if configs.DiscordClientID != "" {
+		providers = append(providers, discord.New(
+			configs.DiscordClientID,
+			configs.DiscordClientSecret,
+			configs.DiscordCallbackURL,
+			discord.ScopeIdentify, discord.ScopeEmail,
+		))
+	}
+
+	goth.UseProviders(providers...)
+
+	var limiter db.RateLimiter = db.NewMemoryRateLimiter()
+	if configs.RateLimitBackend == "postgres" {
+		limiter = db.NewPostgresRateLimiter()
+	}
 
 	db.Connection()
 	defer db.CloseConnection()
+	go store.PeriodicCleanup(time.Hour)
+	go limiter.PeriodicCleanup(time.Minute)
+	handlers.RecoverAIJobs()
 	configs.InitFirebaseApp()
+	llm.InitProvider()
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(configs.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
+	router.Use(handlers.ResolveClientIP())
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     configs.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	API := router.Group("/api")
+	API.Use(handlers.TokenAuthentication())
+	API.Use(handlers.RateLimitByMethod(limiter, store, handlers.RateLimitReads, handlers.RateLimitWrites))
+	API.Use(handlers.CSRFProtection(store))
 
 	// GET
 	API.GET("/f", handlers.GetAllFictions)
 	API.GET("/f/:fictionID", handlers.GetFiction)
 	API.GET("/f/:fictionID/:chapterID", handlers.GetChapter)
-	API.GET("/auth/:provider", handlers.GetOpenAuthorization)
+	API.GET("/f/:fictionID/:chapterID/script", handlers.GetChapterScript)
+	API.GET("/f/:fictionID/:chapterID/pages", handlers.GetChapterPages)
+	API.GET("/f/:fictionID/:chapterID/pages/cbz", handlers.RateLimit(limiter, store, handlers.RateLimitDownloads), handlers.DownloadChapterCBZ)
+	API.GET("/f/:fictionID/chars", handlers.GetCharacterImages)
+	API.GET("/f/:fictionID/scenes", handlers.GetSceneImages)
+	API.GET("/f/:fictionID/cover/candidates", func(ctx *gin.Context) {
+		handlers.GetCoverCandidates(ctx, store)
+	})
+	API.GET("/f/:fictionID/translations", handlers.GetFictionTranslations)
+	API.GET("/f/:fictionID/translation/chapters", handlers.GetChapterTranslations)
+	API.GET("/f/:fictionID/glossary", func(ctx *gin.Context) {
+		handlers.GetGlossary(ctx, store)
+	})
+	API.GET("/f/:fictionID/codex", func(ctx *gin.Context) {
+		handlers.GetCodex(ctx, store)
+	})
+	API.GET("/f/:fictionID/codex/:entryID", func(ctx *gin.Context) {
+		handlers.GetCodexEntry(ctx, store)
+	})
+	API.GET("/f/:fictionID/timeline", func(ctx *gin.Context) {
+		handlers.GetTimeline(ctx, store)
+	})
+	API.GET("/f/:fictionID/timeline/continuity", func(ctx *gin.Context) {
+		handlers.GetTimelineContinuity(ctx, store)
+	})
+	API.GET("/f/:fictionID/timeline/calendars", func(ctx *gin.Context) {
+		handlers.GetTimelineCalendars(ctx, store)
+	})
+	API.GET("/f/:fictionID/:chapterID/choices", func(ctx *gin.Context) {
+		handlers.GetChapterChoices(ctx, store)
+	})
+	API.GET("/f/:fictionID/variables", func(ctx *gin.Context) {
+		handlers.GetBranchVariables(ctx, store)
+	})
+	API.GET("/f/:fictionID/graph", func(ctx *gin.Context) {
+		handlers.GetBranchGraphReport(ctx, store)
+	})
+	API.GET("/f/:fictionID/path", func(ctx *gin.Context) {
+		handlers.GetReaderPath(ctx, store)
+	})
+	API.GET("/f/:fictionID/:chapterID/suggestions", func(ctx *gin.Context) {
+		handlers.GetChapterSuggestions(ctx, store)
+	})
+	API.GET("/auth/csrf", func(ctx *gin.Context) {
+		handlers.GetCSRFToken(ctx, store)
+	})
+	API.GET("/auth/:provider", func(ctx *gin.Context) {
+		handlers.GetOpenAuthorization(ctx, store)
+	})
+	API.GET("/users/:userID", handlers.GetPublicUserProfile)
 
 	API.GET("/user", func(ctx *gin.Context) {
 		handlers.GetUserProfile(ctx, store)
 	})
+	API.GET("/user/export", handlers.RequireCookieSession(), func(ctx *gin.Context) {
+		handlers.ExportUserData(ctx, store)
+	})
 	API.GET("/auth/logout", func(ctx *gin.Context) {
 		handlers.Logout(ctx, store)
 	})
 	API.GET("/auth/:provider/callback", func(ctx *gin.Context) {
 		handlers.AuthorizedCallback(ctx, store)
 	})
+	API.GET("/auth/:provider/link", func(ctx *gin.Context) {
+		handlers.LinkOpenAuthorization(ctx, store)
+	})
+	API.GET("/user/identities", handlers.RequireCookieSession(), func(ctx *gin.Context) {
+		handlers.GetUserIdentities(ctx, store)
+	})
+	API.GET("/user/tokens", handlers.RequireCookieSession(), func(ctx *gin.Context) {
+		handlers.GetPersonalAccessTokens(ctx, store)
+	})
+	API.GET("/user/sessions", handlers.RequireCookieSession(), func(ctx *gin.Context) {
+		handlers.GetActiveSessions(ctx, store)
+	})
 	API.GET("/f/:fictionID/fav/status", func(ctx *gin.Context) {
 		handlers.CheckFavoriteFiction(ctx, store)
 	})
+	API.GET("/f/:fictionID/webhooks", func(ctx *gin.Context) {
+		handlers.GetWebhooks(ctx, store)
+	})
+	API.GET("/f/:fictionID/webhooks/:webhookID/deliveries", func(ctx *gin.Context) {
+		handlers.GetWebhookDeliveries(ctx, store)
+	})
 
 	// POST
-	API.POST("/f/c", func(ctx *gin.Context) {
+	API.POST("/f/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
 		handlers.CreateFiction(ctx, store)
 	})
-	API.POST("/f/:fictionID/c", func(ctx *gin.Context) {
+	API.POST("/f/:fictionID/c", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
 		handlers.CreateChapter(ctx, store)
 	})
-	API.POST("/f/:fictionID/fav", func(ctx *gin.Context) {
+	API.POST("/f/:fictionID/:chapterID/pages/c", handlers.RequireScope(models.ScopeWriteChapters), handlers.RateLimit(limiter, store, handlers.RateLimitUploads), func(ctx *gin.Context) {
+		handlers.UploadChapterPages(ctx, store)
+	})
+	API.POST("/f/:fictionID/fav", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
 		handlers.AddFavoriteFiction(ctx, store)
 	})
-	API.POST("f/images/upload", handlers.UploadChapterImage)
+	API.POST("/user/tokens/c", func(ctx *gin.Context) {
+		handlers.CreatePersonalAccessToken(ctx, store)
+	})
+	API.POST("f/images/upload", handlers.RequireScope(models.ScopeWriteChapters), handlers.RateLimit(limiter, store, handlers.RateLimitUploads), handlers.UploadChapterImage)
+	API.POST("/f/:fictionID/webhooks/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateWebhook(ctx, store)
+	})
+	API.POST("/f/:fictionID/:chapterID/scenes/:sceneID/insert", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.InsertSceneImage(ctx, store)
+	})
+	API.POST("/f/:fictionID/translations/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateFictionTranslation(ctx, store)
+	})
+	API.POST("/f/:fictionID/glossary/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateGlossaryTerm(ctx, store)
+	})
+	API.POST("/f/:fictionID/codex/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateCodexEntry(ctx, store)
+	})
+	API.POST("/f/:fictionID/codex/:entryID/relations/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateCodexRelation(ctx, store)
+	})
+	API.POST("/f/:fictionID/timeline/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateTimelineEvent(ctx, store)
+	})
+	API.POST("/f/:fictionID/timeline/calendars/c", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.CreateTimelineCalendar(ctx, store)
+	})
+	API.POST("/f/:fictionID/path/start", handlers.RequireScope(models.ScopeRead), func(ctx *gin.Context) {
+		handlers.StartReaderPath(ctx, store)
+	})
+	API.POST("/f/:fictionID/:chapterID/choices/:choiceID", handlers.RequireScope(models.ScopeRead), func(ctx *gin.Context) {
+		handlers.ChooseChapterChoice(ctx, store)
+	})
+	API.POST("/f/:fictionID/:chapterID/suggestions/:suggestionID/accept", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.AcceptChapterSuggestion(ctx, store)
+	})
+	API.POST("/f/:fictionID/:chapterID/suggestions/:suggestionID/reject", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.RejectChapterSuggestion(ctx, store)
+	})
+	API.POST("/f/:fictionID/cover/candidates/:candidateID/select", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.SelectCoverCandidate(ctx, store)
+	})
+	API.POST("/f/:fictionID/webhooks/:webhookID/test", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.SendTestWebhook(ctx, store)
+	})
 
 	// PUT
-	API.PUT("/f/:fictionID/u", func(ctx *gin.Context) {
+	API.PUT("/user/u", func(ctx *gin.Context) {
+		handlers.EditUserProfile(ctx, store)
+	})
+	API.PUT("/f/:fictionID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
 		handlers.EditFiction(ctx, store)
 	})
-	API.PUT("/f/:fictionID/:chapterID/u", func(ctx *gin.Context) {
+	API.PUT("/f/:fictionID/:chapterID/u", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
 		handlers.EditChapter(ctx, store)
 	})
+	API.PUT("/f/:fictionID/:chapterID/pages/u", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.EditChapterPages(ctx, store)
+	})
+	API.PUT("/f/:fictionID/glossary/:termID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditGlossaryTerm(ctx, store)
+	})
+	API.PUT("/f/:fictionID/codex/:entryID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditCodexEntry(ctx, store)
+	})
+	API.PUT("/f/:fictionID/timeline/:eventID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditTimelineEvent(ctx, store)
+	})
+	API.PUT("/f/:fictionID/timeline/calendars/:calendarID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditTimelineCalendar(ctx, store)
+	})
+	API.PUT("/f/:fictionID/:chapterID/choices/u", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.EditChapterChoices(ctx, store)
+	})
+	API.PUT("/f/:fictionID/variables/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditBranchVariables(ctx, store)
+	})
+	API.PUT("/f/:fictionID/:chapterID/translation/u", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.EditChapterTranslation(ctx, store)
+	})
+	API.PUT("/f/:fictionID/webhooks/:webhookID/u", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.EditWebhook(ctx, store)
+	})
 
 	// DELETE
-	API.DELETE("/f/:fictionID/d", func(ctx *gin.Context) {
+	API.DELETE("/user/d", func(ctx *gin.Context) {
+		handlers.DeleteAccount(ctx, store)
+	})
+	API.DELETE("/user/identities/:provider/d", func(ctx *gin.Context) {
+		handlers.UnlinkUserIdentity(ctx, store)
+	})
+	API.DELETE("/user/tokens/:tokenID/d", func(ctx *gin.Context) {
+		handlers.RevokePersonalAccessToken(ctx, store)
+	})
+	API.DELETE("/user/sessions/d", func(ctx *gin.Context) {
+		handlers.RevokeAllSessions(ctx, store)
+	})
+	API.DELETE("/user/sessions/:sessionID/d", func(ctx *gin.Context) {
+		handlers.RevokeSession(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
 		handlers.DeleteFiction(ctx, store)
 	})
-	API.DELETE("/f/:fictionID/fav/rmv", func(ctx *gin.Context) {
+	API.DELETE("/f/:fictionID/fav/rmv", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
 		handlers.RemoveFavoriteFiction(ctx, store)
 	})
-	API.DELETE("/f/:fictionID/:chapterID/d", func(ctx *gin.Context) {
+	API.DELETE("/f/:fictionID/:chapterID/d", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
 		handlers.DeleteChapter(ctx, store)
 	})
+	API.DELETE("/f/:fictionID/:chapterID/pages/:pageID/d", handlers.RequireScope(models.ScopeWriteChapters), func(ctx *gin.Context) {
+		handlers.DeleteChapterPage(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/scenes/:sceneID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteSceneImage(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/cover/candidates/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DiscardCoverCandidates(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/glossary/:termID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteGlossaryTerm(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/codex/:entryID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteCodexEntry(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/codex/:entryID/relations/:relationID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteCodexRelation(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/timeline/:eventID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteTimelineEvent(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/timeline/calendars/:calendarID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteTimelineCalendar(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/chars/:characterID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteCharacterImage(ctx, store)
+	})
+	API.DELETE("/f/:fictionID/webhooks/:webhookID/d", handlers.RequireScope(models.ScopeWriteFictions), func(ctx *gin.Context) {
+		handlers.DeleteWebhook(ctx, store)
+	})
 
 	// OpenAI
 	AI := API.Group("/ai")
-	AI.POST("/storyline/c", handlers.OpenAICreateStoryline)
-	// AI.POST("/char/c", handlers.OpenAICreateCharacter)
+	AI.Use(handlers.RequireScope(models.ScopeAI))
+	AI.Use(handlers.RateLimit(limiter, store, handlers.RateLimitAI))
+	AI.GET("/usage", func(ctx *gin.Context) {
+		handlers.GetAIUsage(ctx, store)
+	})
+	AI.GET("/usage/all", func(ctx *gin.Context) {
+		handlers.GetAIUsageAdminReport(ctx, store)
+	})
+	AI.PUT("/quotas/:userID/u", func(ctx *gin.Context) {
+		handlers.SetAIQuota(ctx, store)
+	})
+	AI.DELETE("/quotas/:userID/d", func(ctx *gin.Context) {
+		handlers.DeleteAIQuota(ctx, store)
+	})
+	AI.GET("/prompts", func(ctx *gin.Context) {
+		handlers.GetPromptTemplatesAdmin(ctx, store)
+	})
+	AI.GET("/prompts/report", func(ctx *gin.Context) {
+		handlers.GetPromptTemplateReport(ctx, store)
+	})
+	AI.POST("/prompts/c", func(ctx *gin.Context) {
+		handlers.CreatePromptTemplate(ctx, store)
+	})
+	AI.PUT("/prompts/:templateID/u", func(ctx *gin.Context) {
+		handlers.EditPromptTemplate(ctx, store)
+	})
+	AI.GET("/generations/:generationID", func(ctx *gin.Context) {
+		handlers.GetAIGeneration(ctx, store)
+	})
+	AI.POST("/storyline/c", handlers.RequireAIQuota(store), handlers.OpenAICreateStoryline)
+	AI.POST("/storyline/stream", handlers.RequireAIQuota(store), handlers.OpenAIStreamStoryline)
+	AI.GET("/threads", func(ctx *gin.Context) {
+		handlers.GetAIThreads(ctx, store)
+	})
+	AI.GET("/threads/:threadID", func(ctx *gin.Context) {
+		handlers.GetAIThread(ctx, store)
+	})
+	AI.POST("/threads/c", func(ctx *gin.Context) {
+		handlers.CreateAIThread(ctx, store)
+	})
+	AI.POST("/threads/:threadID/c", handlers.RequireAIQuota(store), handlers.SendAIThreadMessage)
+	AI.POST("/threads/:threadID/stream", handlers.RequireAIQuota(store), handlers.StreamAIThreadMessage)
+	AI.PUT("/threads/:threadID/u", func(ctx *gin.Context) {
+		handlers.EditAIThread(ctx, store)
+	})
+	AI.DELETE("/threads/:threadID/d", func(ctx *gin.Context) {
+		handlers.DeleteAIThread(ctx, store)
+	})
+	AI.POST("/f/:fictionID/char/c", handlers.RequireAIQuota(store), handlers.OpenAICreateCharacter)
+	AI.POST("/f/:fictionID/bg/c", handlers.RequireAIQuota(store), handlers.OpenAICreateSceneImage)
+	AI.POST("/f/:fictionID/cover/c", handlers.RequireAIQuota(store), handlers.OpenAICreateCoverCandidates)
+	AI.POST("/f/:fictionID/translate", handlers.RequireAIQuota(store), handlers.OpenAITranslateFiction)
+	AI.POST("/f/:fictionID/:chapterID/recap", handlers.RequireAIQuota(store), handlers.OpenAIRecapChapters)
+	AI.POST("/f/:fictionID/:chapterID/proofread", handlers.RequireAIQuota(store), handlers.OpenAIProofreadChapter)
+	AI.POST("/f/:fictionID/:chapterID/continue", handlers.RequireAIQuota(store), handlers.OpenAIContinueChapter)
+	AI.GET("/jobs/:jobID", func(ctx *gin.Context) {
+		handlers.GetAIJob(ctx, store)
+	})
 
 	router.Run(":8080")
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+type FictionDisposal string
+
+const (
+	DeleteFictions   FictionDisposal = "delete"
+	OrphanFictions   FictionDisposal = "orphan"
+	TransferFictions FictionDisposal = "transfer"
+)
+
+// Accounts without an email confirm with their name instead, see AccountDeletionConfirmation
+type AccountDeletionForm struct {
+	Confirm_Email string          `json:"confirm_email"`
+	Confirm_Name  string          `json:"confirm_name"`
+	Fictions      FictionDisposal `json:"fictions"`
+	Transfer_To   int             `json:"transfer_to"`
+}
+
+type UserDataExport struct {
+	Exported      time.Time                  `json:"exported"`
+	Profile       UserModel                  `json:"profile"`
+	Identities    []UserIdentityModel        `json:"identities"`
+	Favorites     []FictionModel             `json:"favorites"`
+	Fictions      []FictionModel             `json:"fictions"`
+	AI_Threads    []AIThreadModel            `json:"ai_threads"`
+	Access_Tokens []PersonalAccessTokenModel `json:"access_tokens"`
+	Image_URLs    []string                   `json:"image_urls"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+type AIGenerationStatus string
+
+const (
+	AIGenerationStreaming AIGenerationStatus = "streaming"
+	AIGenerationComplete  AIGenerationStatus = "complete"
+	AIGenerationCancelled AIGenerationStatus = "cancelled"
+	AIGenerationFailed    AIGenerationStatus = "failed"
+)
+
+type AIGenerationModel struct {
+	ID      int                `json:"id"`
+	User_ID int                `json:"user_id"`
+	Feature AIFeature          `json:"feature"`
+	Model   string             `json:"model"`
+	Prompt  string             `json:"prompt"`
+	Content string             `json:"content"`
+	Status  AIGenerationStatus `json:"status"`
+	Created time.Time          `json:"created"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+	"encoding/json"
+)
+
+type AIJobKind string
+
+const (
+	AIJobBackground  AIJobKind = "background"
+	AIJobCover       AIJobKind = "cover"
+	AIJobTranslation AIJobKind = "translation"
+)
+
+type AIJobStatus string
+
+const (
+	AIJobPending  AIJobStatus = "pending"
+	AIJobRunning  AIJobStatus = "running"
+	AIJobComplete AIJobStatus = "complete"
+	AIJobFailed   AIJobStatus = "failed"
+)
+
+// Input and Result are kept as raw JSON, their shape depends on Kind
+type AIJobModel struct {
+	ID         int             `json:"id"`
+	User_ID    int             `json:"user_id"`
+	Fiction_ID int             `json:"fiction_id"`
+	Kind       AIJobKind       `json:"kind"`
+	Status     AIJobStatus     `json:"status"`
+	Input      json.RawMessage `json:"input"`
+	Result     json.RawMessage `json:"result"`
+	Error      string          `json:"error"`
+	Created    time.Time       `json:"created"`
+	Updated    time.Time       `json:"updated"`
+}
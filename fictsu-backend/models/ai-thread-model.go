@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+type AIThreadForm struct {
+	Title       *string `json:"title"`
+	Fiction_ID  *int    `json:"fiction_id"`
+	Chapter_IDs []int64 `json:"chapter_ids"`
+}
+
+type AIThreadMessageForm struct {
+	Message string `json:"message"`
+}
+
+type AIThreadModel struct {
+	ID          int                    `json:"id"`
+	User_ID     int                    `json:"user_id"`
+	Fiction_ID  *int                   `json:"fiction_id"`
+	Title       string                 `json:"title"`
+	Chapter_IDs []int64                `json:"chapter_ids"`
+	Created     time.Time              `json:"created"`
+	Updated     time.Time              `json:"updated"`
+	Messages    []AIThreadMessageModel `json:"messages,omitempty"`
+}
+
+type AIThreadMessageModel struct {
+	ID        int       `json:"id"`
+	Thread_ID int       `json:"thread_id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Created   time.Time `json:"created"`
+}
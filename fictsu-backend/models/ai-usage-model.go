@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+)
+
+type AIFeature string
+
+const (
+	AIFeatureStoryline   AIFeature = "storyline"
+	AIFeatureCharacter   AIFeature = "character"
+	AIFeatureAssistant   AIFeature = "assistant"
+	AIFeatureBackground  AIFeature = "background"
+	AIFeatureCover       AIFeature = "cover"
+	AIFeatureRecap       AIFeature = "recap"
+	AIFeatureProofread   AIFeature = "proofread"
+	AIFeatureContinue    AIFeature = "continue"
+	AIFeatureTranslation AIFeature = "translation"
+)
+
+// USD per million tokens, images are charged per image
+type AIModelPrice struct {
+	Prompt     float64
+	Completion float64
+	Image      float64
+}
+
+var AIModelPrices = map[string]AIModelPrice{
+	"gpt-4o":      {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini": {Prompt: 0.15, Completion: 0.60},
+	"dall-e-3":    {Image: 0.04},
+}
+
+type AIUsageModel struct {
+	ID                int       `json:"id"`
+	User_ID           int       `json:"user_id"`
+	Feature           AIFeature `json:"feature"`
+	Model             string    `json:"model"`
+	Prompt_Tokens     int       `json:"prompt_tokens"`
+	Completion_Tokens int       `json:"completion_tokens"`
+	Cost              float64   `json:"cost"`
+	Created           time.Time `json:"created"`
+}
+
+type AIUsageSummary struct {
+	Requests          int     `json:"requests"`
+	Prompt_Tokens     int     `json:"prompt_tokens"`
+	Completion_Tokens int     `json:"completion_tokens"`
+	Cost              float64 `json:"cost"`
+}
+
+// A nil limit means unlimited
+type AIQuotaModel struct {
+	Daily_Requests *int `json:"daily_requests"`
+	Daily_Tokens   *int `json:"daily_tokens"`
+	Overridden     bool `json:"overridden"`
+}
+
+type AIQuotaForm struct {
+	Daily_Requests *int `json:"daily_requests"`
+	Daily_Tokens   *int `json:"daily_tokens"`
+	Unlimited      bool `json:"unlimited"`
+}
+
+type AIDailyUsage struct {
+	Date time.Time `json:"date"`
+	AIUsageSummary
+}
+
+type AIUsageReport struct {
+	Quota              AIQuotaModel   `json:"quota"`
+	Today              AIUsageSummary `json:"today"`
+	Remaining_Requests *int           `json:"remaining_requests"`
+	Remaining_Tokens   *int           `json:"remaining_tokens"`
+	Resets             time.Time      `json:"resets"`
+	History            []AIDailyUsage `json:"history"`
+}
+
+type AIUserUsage struct {
+	User_ID int    `json:"user_id"`
+	Name    string `json:"name"`
+	AIUsageSummary
+}
+
+type AIModelUsage struct {
+	Model string `json:"model"`
+	AIUsageSummary
+}
+
+type AIUsageAdminReport struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Total    AIUsageSummary `json:"total"`
+	By_User  []AIUserUsage  `json:"by_user"`
+	By_Model []AIModelUsage `json:"by_model"`
+}
+
+func EstimateAICost(model string, promptTokens int, completionTokens int, images int) float64 {
+	price := AIModelPrices[model]
+	return (float64(promptTokens) * price.Prompt + float64(completionTokens) * price.Completion) / 1000000 + float64(images) * price.Image
+}
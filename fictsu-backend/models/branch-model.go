@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+)
+
+// Operator is one of eq, ne, lt, lte, gt or gte
+type BranchConditionModel struct {
+	Variable string `json:"variable"`
+	Operator string `json:"operator"`
+	Value    int    `json:"value"`
+}
+
+// Operator is set or add
+type BranchEffectModel struct {
+	Variable string `json:"variable"`
+	Operator string `json:"operator"`
+	Value    int    `json:"value"`
+}
+
+type BranchVariableModel struct {
+	Name          string `json:"name"`
+	Default_Value int    `json:"default_value"`
+}
+
+type ChapterChoiceForm struct {
+	Text       string                 `json:"text"`
+	Target_ID  int                    `json:"target_id"`
+	Conditions []BranchConditionModel `json:"conditions"`
+	Effects    []BranchEffectModel    `json:"effects"`
+}
+
+// Ending marks a chapter where a branch is meant to stop, so it is not reported as a dead end
+type ChapterChoicesForm struct {
+	Ending  bool                `json:"ending"`
+	Choices []ChapterChoiceForm `json:"choices"`
+}
+
+// Available is only set for readers with a path, it tells whether their state meets the conditions
+type ChapterChoiceModel struct {
+	ID           int                    `json:"id"`
+	Chapter_ID   int                    `json:"chapter_id"`
+	Position     int                    `json:"position"`
+	Text         string                 `json:"text"`
+	Target_ID    int                    `json:"target_id"`
+	Target_Title string                 `json:"target_title"`
+	Conditions   []BranchConditionModel `json:"conditions"`
+	Effects      []BranchEffectModel    `json:"effects"`
+	Available    *bool                  `json:"available,omitempty"`
+}
+
+type ChapterChoicesModel struct {
+	Fiction_ID int                  `json:"fiction_id"`
+	Chapter_ID int                  `json:"chapter_id"`
+	Ending     bool                 `json:"ending"`
+	Choices    []ChapterChoiceModel `json:"choices"`
+}
+
+// Conditions are not evaluated here, a chapter reachable only through a choice that can never be met still counts
+type BranchGraphReportModel struct {
+	Start_Chapter_ID  int      `json:"start_chapter_id"`
+	Unreachable       []int    `json:"unreachable"`
+	Dead_Ends         []int    `json:"dead_ends"`
+	No_Ending         []int    `json:"no_ending"`
+	Cycles            [][]int  `json:"cycles"`
+	Unknown_Variables []string `json:"unknown_variables"`
+}
+
+// Path lists the chapters the reader went through in order, the last one is Chapter_ID
+type ReaderPathModel struct {
+	Fiction_ID int            `json:"fiction_id"`
+	Chapter_ID int            `json:"chapter_id"`
+	State      map[string]int `json:"state"`
+	Path       []int          `json:"path"`
+	Created    time.Time      `json:"created"`
+	Updated    time.Time      `json:"updated"`
+}
+
+type BranchStepModel struct {
+	Path    ReaderPathModel      `json:"path"`
+	Chapter ChapterModel         `json:"chapter"`
+	Ending  bool                 `json:"ending"`
+	Choices []ChapterChoiceModel `json:"choices"`
+}
@@ -4,10 +4,33 @@ import (
 	"time"
 )
 
+type ChapterFormat string
+
+const (
+	ChapterText  ChapterFormat = "text"
+	ChapterScene ChapterFormat = "scene"
+	ChapterPages ChapterFormat = "pages"
+)
+
+// The notes and lists are pointers or nil when left out, so an edit can tell leaving them alone from clearing them
 type ChapterModel struct {
 	Fiction_ID	int			`json:"fiction_id"`
 	ID			int			`json:"id"`
 	Title 		string 		`json:"title"`
 	Content		string		`json:"content"`
 	Created 	time.Time	`json:"created"`
+	Mentions	[]CodexMentionModel	`json:"mentions,omitempty"`
+	Format		ChapterFormat		`json:"format,omitempty"`
+	Script		*SceneScriptModel	`json:"script,omitempty"`
+	Pages		[]ChapterPageModel	`json:"pages,omitempty"`
+	Pre_Note	*string				`json:"pre_note,omitempty"`
+	Post_Note	*string				`json:"post_note,omitempty"`
+	Footnotes	[]ChapterFootnoteModel	`json:"footnotes,omitempty"`
+	Content_Warnings	[]string	`json:"content_warnings,omitempty"`
+}
+
+// Referenced from the content with a [^ID] marker where the footnote applies
+type ChapterFootnoteModel struct {
+	ID		string	`json:"id"`
+	Text	string	`json:"text"`
 }
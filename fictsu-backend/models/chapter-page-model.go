@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+type ChapterPageModel struct {
+	ID         int       `json:"id"`
+	Fiction_ID int       `json:"fiction_id"`
+	Chapter_ID int       `json:"chapter_id"`
+	Position   int       `json:"position"`
+	Ref        string    `json:"ref"`
+	Alt        string    `json:"alt"`
+	Created    time.Time `json:"created"`
+}
+
+type ChapterPageEditForm struct {
+	ID  int    `json:"id"`
+	Alt string `json:"alt"`
+}
+
+// Pages lists every page of the chapter in the new order
+type ChapterPagesForm struct {
+	Pages []ChapterPageEditForm `json:"pages"`
+}
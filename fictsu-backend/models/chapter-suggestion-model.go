@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+type ChapterSuggestionKind string
+
+const (
+	ChapterSuggestionRecap     ChapterSuggestionKind = "recap"
+	ChapterSuggestionProofread ChapterSuggestionKind = "proofread"
+	ChapterSuggestionContinue  ChapterSuggestionKind = "continue"
+)
+
+type ChapterSuggestionStatus string
+
+const (
+	ChapterSuggestionPending  ChapterSuggestionStatus = "pending"
+	ChapterSuggestionAccepted ChapterSuggestionStatus = "accepted"
+	ChapterSuggestionRejected ChapterSuggestionStatus = "rejected"
+)
+
+type ChapterRecapForm struct {
+	Chapters int `json:"chapters"`
+}
+
+type ChapterContinueForm struct {
+	Instructions string `json:"instructions"`
+}
+
+// Edits lists the indexes of the proofreading edits to apply, nil applies all of them.
+// Content replaces the generated text of a recap or continuation before it is applied.
+type ChapterSuggestionDecisionForm struct {
+	Edits   []int   `json:"edits"`
+	Content *string `json:"content"`
+}
+
+// Start and End are byte offsets into the chapter content the suggestion was made for
+type ChapterEdit struct {
+	Index       int    `json:"index"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+	Reason      string `json:"reason"`
+}
+
+// Content holds the recap or continuation, Edits the proofreading result
+type ChapterSuggestionModel struct {
+	ID          int                     `json:"id"`
+	Fiction_ID  int                     `json:"fiction_id"`
+	Chapter_ID  int                     `json:"chapter_id"`
+	User_ID     int                     `json:"user_id"`
+	Kind        ChapterSuggestionKind   `json:"kind"`
+	Status      ChapterSuggestionStatus `json:"status"`
+	Content     string                  `json:"content"`
+	Edits       []ChapterEdit           `json:"edits"`
+	Source_Hash string                  `json:"-"`
+	Created     time.Time               `json:"created"`
+	Updated     time.Time               `json:"updated"`
+}
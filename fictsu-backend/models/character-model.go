@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type CharacterImageModel struct {
+	Fiction_ID int       `json:"fiction_id"`
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Ref        string    `json:"ref"`
+	Prompt     string    `json:"prompt"`
+	Created    time.Time `json:"created"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+type CodexEntryType string
+
+const (
+	CodexCharacter CodexEntryType = "character"
+	CodexLocation  CodexEntryType = "location"
+	CodexFaction   CodexEntryType = "faction"
+	CodexItem      CodexEntryType = "item"
+	CodexLore      CodexEntryType = "lore"
+)
+
+// Reveal_Chapter hides the entry from readers until they reached that chapter, nil shows it from the start
+type CodexEntryForm struct {
+	Type           CodexEntryType    `json:"type"`
+	Name           string            `json:"name"`
+	Aliases        []string          `json:"aliases"`
+	Description    string            `json:"description"`
+	Image          string            `json:"image"`
+	Fields         map[string]string `json:"fields"`
+	Reveal_Chapter *int              `json:"reveal_chapter"`
+}
+
+type CodexEntryModel struct {
+	ID             int                  `json:"id"`
+	Fiction_ID     int                  `json:"fiction_id"`
+	Type           CodexEntryType       `json:"type"`
+	Name           string               `json:"name"`
+	Aliases        []string             `json:"aliases"`
+	Description    string               `json:"description"`
+	Image          string               `json:"image"`
+	Fields         map[string]string    `json:"fields"`
+	Reveal_Chapter *int                 `json:"reveal_chapter"`
+	Relations      []CodexRelationModel `json:"relations,omitempty"`
+	Created        time.Time            `json:"created"`
+	Updated        time.Time            `json:"updated"`
+}
+
+type CodexRelationForm struct {
+	To_ID          int    `json:"to_id"`
+	Kind           string `json:"kind"`
+	Reveal_Chapter *int   `json:"reveal_chapter"`
+}
+
+type CodexRelationModel struct {
+	ID             int    `json:"id"`
+	From_ID        int    `json:"from_id"`
+	To_ID          int    `json:"to_id"`
+	To_Name        string `json:"to_name"`
+	Kind           string `json:"kind"`
+	Reveal_Chapter *int   `json:"reveal_chapter"`
+}
+
+// Terms are the names or aliases found in the chapter, so the reader can link every occurrence
+type CodexMentionModel struct {
+	Entry_ID int            `json:"entry_id"`
+	Type     CodexEntryType `json:"type"`
+	Name     string         `json:"name"`
+	Terms    []string       `json:"terms"`
+	Count    int            `json:"count"`
+}
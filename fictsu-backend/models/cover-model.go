@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+type CoverCandidateForm struct {
+	Count int    `json:"count"`
+	Style string `json:"style"`
+	Size  string `json:"size"`
+}
+
+type CoverCandidateModel struct {
+	ID         int       `json:"id"`
+	Fiction_ID int       `json:"fiction_id"`
+	Job_ID     int       `json:"job_id"`
+	Ref        string    `json:"ref"`
+	Prompt     string    `json:"prompt"`
+	Created    time.Time `json:"created"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type UserIdentityModel struct {
+	ID               int       `json:"id"`
+	User_ID          int       `json:"user_id"`
+	Provider         string    `json:"provider"`
+	Provider_User_ID string    `json:"provider_user_id"`
+	Email            string    `json:"email"`
+	Created          time.Time `json:"created"`
+}
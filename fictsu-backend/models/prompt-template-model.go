@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// Matches the AIFeature of the same name, so usage can be compared per template
+type PromptTemplateKey string
+
+const (
+	PromptStoryline PromptTemplateKey = "storyline"
+	PromptAssistant PromptTemplateKey = "assistant"
+	PromptCharacter PromptTemplateKey = "character"
+)
+
+// Body, Model and Temperature never change once created, only Weight and Notes do, so usage stays comparable per version.
+// Version 0 is the built-in default that is used while no stored version of the key has a weight.
+type PromptTemplateModel struct {
+	ID          int               `json:"id"`
+	Key         PromptTemplateKey `json:"key"`
+	Version     int               `json:"version"`
+	Body        string            `json:"body"`
+	Model       string            `json:"model"`
+	Temperature *float64          `json:"temperature"`
+	Weight      int               `json:"weight"`
+	Notes       string            `json:"notes"`
+	Created_By  *int              `json:"created_by"`
+	Created     time.Time         `json:"created"`
+}
+
+type PromptTemplateForm struct {
+	Key         PromptTemplateKey `json:"key"`
+	Body        string            `json:"body"`
+	Model       string            `json:"model"`
+	Temperature *float64          `json:"temperature"`
+	Weight      int               `json:"weight"`
+	Notes       string            `json:"notes"`
+}
+
+type PromptTemplateRolloutForm struct {
+	Weight *int    `json:"weight"`
+	Notes  *string `json:"notes"`
+}
+
+type PromptTemplateUsage struct {
+	Template_ID           *int              `json:"template_id"`
+	Key                   PromptTemplateKey `json:"key"`
+	Version               int               `json:"version"`
+	Weight                int               `json:"weight"`
+	Users                 int               `json:"users"`
+	Avg_Completion_Tokens float64           `json:"avg_completion_tokens"`
+	AIUsageSummary
+}
+
+type PromptTemplateReport struct {
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+	Templates []PromptTemplateUsage `json:"templates"`
+}
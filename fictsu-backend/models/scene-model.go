@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+type SceneImageForm struct {
+	Prompt            string `json:"prompt"`
+	Chapter_ID        *int   `json:"chapter_id"`
+	Seed_From_Chapter bool   `json:"seed_from_chapter"`
+	Size              string `json:"size"`
+}
+
+type SceneImageInsertForm struct {
+	Position *int   `json:"position"`
+	Alt      string `json:"alt"`
+}
+
+type SceneImageModel struct {
+	ID         int       `json:"id"`
+	Fiction_ID int       `json:"fiction_id"`
+	Chapter_ID *int      `json:"chapter_id"`
+	Job_ID     int       `json:"job_id"`
+	Ref        string    `json:"ref"`
+	Prompt     string    `json:"prompt"`
+	Size       string    `json:"size"`
+	Created    time.Time `json:"created"`
+}
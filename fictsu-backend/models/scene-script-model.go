@@ -0,0 +1,55 @@
+package models
+
+type SceneStepType string
+
+const (
+	SceneBackground SceneStepType = "background"
+	SceneShow       SceneStepType = "show"
+	SceneHide       SceneStepType = "hide"
+	SceneDialogue   SceneStepType = "dialogue"
+	SceneNarration  SceneStepType = "narration"
+	SceneChoice     SceneStepType = "choice"
+	SceneLabel      SceneStepType = "label"
+	SceneJump       SceneStepType = "jump"
+)
+
+// Backgrounds and characters are keyed by short IDs the steps refer to, images are URLs from the
+// scene and character galleries or the generic image upload
+type SceneScriptModel struct {
+	Backgrounds map[string]SceneBackgroundModel `json:"backgrounds"`
+	Characters  map[string]SceneCharacterModel  `json:"characters"`
+	Steps       []SceneStepModel                `json:"steps"`
+}
+
+type SceneBackgroundModel struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// Sprites maps an expression to its image, "default" is used when a step names no expression
+type SceneCharacterModel struct {
+	Name    string            `json:"name"`
+	Color   string            `json:"color,omitempty"`
+	Sprites map[string]string `json:"sprites"`
+}
+
+// Which fields apply depends on Type, e.g. a show step uses Character, Position and Expression
+type SceneStepModel struct {
+	Type       SceneStepType      `json:"type"`
+	Background string             `json:"background,omitempty"`
+	Transition string             `json:"transition,omitempty"`
+	Character  string             `json:"character,omitempty"`
+	Position   string             `json:"position,omitempty"`
+	Expression string             `json:"expression,omitempty"`
+	Speaker    string             `json:"speaker,omitempty"`
+	Text       string             `json:"text,omitempty"`
+	Choices    []SceneChoiceModel `json:"choices,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	Target     string             `json:"target,omitempty"`
+}
+
+// Target is the label the player jumps to when the choice is picked
+type SceneChoiceModel struct {
+	Text   string `json:"text"`
+	Target string `json:"target"`
+}
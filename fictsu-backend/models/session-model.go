@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type SessionModel struct {
+	ID         int       `json:"id"`
+	IP         string    `json:"ip"`
+	User_Agent string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+	Created    time.Time `json:"created"`
+	Last_Seen  time.Time `json:"last_seen"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+)
+
+type TimelineIssueKind string
+
+const (
+	TimelineCharacterConflict TimelineIssueKind = "character_conflict"
+	TimelineOutOfOrder        TimelineIssueKind = "out_of_order"
+	TimelineUnrevealed        TimelineIssueKind = "unrevealed_character"
+)
+
+type CalendarMonth struct {
+	Name string `json:"name"`
+	Days int    `json:"days"`
+}
+
+// Epoch_Offset is the day the calendar's year 0 starts on, relative to the other calendars of the fiction,
+// so events dated in different calendars still sort on one timeline
+type TimelineCalendarForm struct {
+	Name         string          `json:"name"`
+	Months       []CalendarMonth `json:"months"`
+	Era          string          `json:"era"`
+	Epoch_Offset int64           `json:"epoch_offset"`
+}
+
+type TimelineCalendarModel struct {
+	ID           int             `json:"id"`
+	Fiction_ID   int             `json:"fiction_id"`
+	Name         string          `json:"name"`
+	Months       []CalendarMonth `json:"months"`
+	Era          string          `json:"era"`
+	Epoch_Offset int64           `json:"epoch_offset"`
+	Created      time.Time       `json:"created"`
+}
+
+// Month and Day are optional for events only known to the year, Calendar_ID nil uses the default calendar
+type TimelineEventForm struct {
+	Title         string  `json:"title"`
+	Description   string  `json:"description"`
+	Calendar_ID   *int    `json:"calendar_id"`
+	Year          int     `json:"year"`
+	Month         *int    `json:"month"`
+	Day           *int    `json:"day"`
+	Duration_Days int     `json:"duration_days"`
+	Location_ID   *int    `json:"location_id"`
+	Chapter_IDs   []int64 `json:"chapter_ids"`
+	Character_IDs []int64 `json:"character_ids"`
+}
+
+type TimelineLinkModel struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type TimelineEventModel struct {
+	ID            int                 `json:"id"`
+	Fiction_ID    int                 `json:"fiction_id"`
+	Title         string              `json:"title"`
+	Description   string              `json:"description"`
+	Calendar_ID   *int                `json:"calendar_id"`
+	Year          int                 `json:"year"`
+	Month         *int                `json:"month"`
+	Day           *int                `json:"day"`
+	Date          string              `json:"date"`
+	Duration_Days int                 `json:"duration_days"`
+	Sort_Key      int64               `json:"sort_key"`
+	Location      *TimelineLinkModel  `json:"location"`
+	Chapters      []TimelineLinkModel `json:"chapters"`
+	Characters    []TimelineLinkModel `json:"characters"`
+	Created       time.Time           `json:"created"`
+	Updated       time.Time           `json:"updated"`
+}
+
+type TimelineIssueModel struct {
+	Kind      TimelineIssueKind `json:"kind"`
+	Message   string            `json:"message"`
+	Event_IDs []int             `json:"event_ids"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+type TokenScope string
+
+const (
+	ScopeRead          TokenScope = "read"
+	ScopeWriteChapters TokenScope = "write:chapters"
+	ScopeWriteFictions TokenScope = "write:fictions"
+	ScopeAI            TokenScope = "ai"
+)
+
+type PersonalAccessTokenForm struct {
+	Name            string   `json:"name"`
+	Scopes          []string `json:"scopes"`
+	Expires_In_Days int      `json:"expires_in_days"`
+}
+
+type PersonalAccessTokenModel struct {
+	ID        int        `json:"id"`
+	User_ID   int        `json:"user_id"`
+	Name      string     `json:"name"`
+	Token     string     `json:"token,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	Expires   time.Time  `json:"expires"`
+	Last_Used *time.Time `json:"last_used"`
+	Revoked   *time.Time `json:"revoked"`
+	Created   time.Time  `json:"created"`
+}
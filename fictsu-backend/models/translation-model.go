@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+)
+
+type ChapterTranslationStatus string
+
+const (
+	ChapterTranslationMachine  ChapterTranslationStatus = "machine"
+	ChapterTranslationReviewed ChapterTranslationStatus = "reviewed"
+)
+
+type TranslationForm struct {
+	Language string `json:"language"`
+	Title    string `json:"title"`
+}
+
+// A translated edition is a regular fiction linked to the fiction it was translated from
+type FictionTranslationModel struct {
+	Fiction_ID  int       `json:"fiction_id"`
+	Original_ID int       `json:"original_id"`
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Cover       string    `json:"cover"`
+	Created     time.Time `json:"created"`
+}
+
+type GlossaryTermForm struct {
+	Source_Term string `json:"source_term"`
+	Target_Term string `json:"target_term"`
+	Note        string `json:"note"`
+}
+
+type GlossaryTermModel struct {
+	ID          int       `json:"id"`
+	Fiction_ID  int       `json:"fiction_id"`
+	Source_Term string    `json:"source_term"`
+	Target_Term string    `json:"target_term"`
+	Note        string    `json:"note"`
+	Created     time.Time `json:"created"`
+}
+
+// No chapter IDs translates every chapter of the original, reviewed chapters are only replaced with Overwrite
+type TranslationJobForm struct {
+	Chapter_IDs []int64 `json:"chapter_ids"`
+	Metadata    bool    `json:"metadata"`
+	Overwrite   bool    `json:"overwrite"`
+}
+
+// Not_Started lists the chapters left untouched because the daily AI quota ran out partway through
+type TranslationJobResult struct {
+	Metadata       bool  `json:"metadata"`
+	Translated     []int `json:"translated"`
+	Skipped        []int `json:"skipped"`
+	Failed         []int `json:"failed"`
+	Not_Started    []int `json:"not_started"`
+	Quota_Exceeded bool  `json:"quota_exceeded"`
+}
+
+type ChapterTranslationForm struct {
+	Status ChapterTranslationStatus `json:"status"`
+}
+
+// Outdated is set when the original chapter changed after it was translated
+type ChapterTranslationModel struct {
+	Fiction_ID  int                      `json:"fiction_id"`
+	Chapter_ID  int                      `json:"chapter_id"`
+	Title       string                   `json:"title"`
+	Status      ChapterTranslationStatus `json:"status"`
+	Reviewed_By *int                     `json:"reviewed_by"`
+	Outdated    bool                     `json:"outdated"`
+	Updated     time.Time                `json:"updated"`
+}
@@ -11,7 +11,31 @@ type UserModel struct {
 	Name      			string			`json:"name"`
 	Email     			string			`json:"email"`
 	Avatar_URL 			string			`json:"avatar_url"`
+	Display_Name		string			`json:"display_name"`
+	Bio					string			`json:"bio"`
+	Links				[]string		`json:"links"`
+	Public_Favorites	bool			`json:"public_favorites"`
 	Joined 				time.Time		`json:"joined"`
 	Fav_Fictions 		[]FictionModel	`json:"fav_fictions"`
 	Contributed_Fic		[]FictionModel	`json:"contributed_fic"`
 }
+
+// Public view of a user, it must never carry private fields such as the email
+type PublicUserModel struct {
+	ID					int				`json:"id"`
+	Name				string			`json:"name"`
+	Display_Name		string			`json:"display_name"`
+	Avatar_URL			string			`json:"avatar_url"`
+	Bio					string			`json:"bio"`
+	Links				[]string		`json:"links"`
+	Joined				time.Time		`json:"joined"`
+	Fav_Fictions		[]FictionModel	`json:"fav_fictions"`
+	Contributed_Fic		[]FictionModel	`json:"contributed_fic"`
+}
+
+type UserProfileForm struct {
+	Display_Name		*string			`form:"display_name"`
+	Bio					*string			`form:"bio"`
+	Links				[]string		`form:"links"`
+	Public_Favorites	*bool			`form:"public_favorites"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+type WebhookEvent string
+
+const (
+	ChapterCreated       WebhookEvent = "chapter.created"
+	ChapterUpdated       WebhookEvent = "chapter.updated"
+	ChapterDeleted       WebhookEvent = "chapter.deleted"
+	FictionStatusChanged WebhookEvent = "fiction.status_changed"
+	FictionFavorited     WebhookEvent = "fiction.favorited"
+	WebhookTest          WebhookEvent = "webhook.test"
+)
+
+type WebhookForm struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookModel struct {
+	ID         int       `json:"id"`
+	Fiction_ID int       `json:"fiction_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	Events     []string  `json:"events"`
+	Active     bool      `json:"active"`
+	Created    time.Time `json:"created"`
+}
+
+type WebhookDeliveryModel struct {
+	ID          int          `json:"id"`
+	Webhook_ID  int          `json:"webhook_id"`
+	Event       WebhookEvent `json:"event"`
+	Payload     string       `json:"payload"`
+	Status_Code int          `json:"status_code"`
+	Success     bool         `json:"success"`
+	Attempts    int          `json:"attempts"`
+	Error       string       `json:"error"`
+	Created     time.Time    `json:"created"`
+	Updated     time.Time    `json:"updated"`
+}
+
+type WebhookPayload struct {
+	Event      WebhookEvent `json:"event"`
+	Fiction_ID int          `json:"fiction_id"`
+	Timestamp  time.Time    `json:"timestamp"`
+	Data       interface{}  `json:"data"`
+}
@@ -2,6 +2,7 @@
 
 import useSWR from "swr"
 import dynamic from "next/dynamic"
+import { csrfFetch } from "@/lib/csrf"
 import { useRouter } from "next/navigation"
 import { ChapterForm } from "@/types/types"
 import "react-quill-new/dist/quill.snow.css"
@@ -36,10 +37,9 @@ export default function ChapterEditPage({ params }: { params: Promise<{ fiction_
         setLoading(true)
         setErrorMessage(null)
 
-        const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/${chapter_id}/u`, {
+        const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/${chapter_id}/u`, {
             method: "PUT",
             headers: { "Content-Type": "application/json" },
-            credentials: "include",
             body: JSON.stringify(formData),
         })
 
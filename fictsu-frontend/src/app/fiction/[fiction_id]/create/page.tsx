@@ -2,6 +2,7 @@
 
 import useSWR from "swr"
 import dynamic from "next/dynamic"
+import { csrfFetch } from "@/lib/csrf"
 import { useRouter } from "next/navigation"
 import { ChapterForm } from "@/types/types"
 import "react-quill-new/dist/quill.snow.css"
@@ -36,10 +37,9 @@ export default function ChapterCreatePage({ params }: { params: Promise<{ fictio
         setLoading(true)
         setErrorMessage(null)
         try {
-            const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fictionID}/c`, {
+            const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fictionID}/c`, {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
-                credentials: "include",
                 body: JSON.stringify(formData),
             })
 
@@ -4,6 +4,7 @@ import useSWR from "swr"
 import Link from "next/link"
 import Image from "next/image"
 import dynamic from "next/dynamic"
+import { csrfFetch } from "@/lib/csrf"
 import { useRouter } from "next/navigation"
 import "react-quill-new/dist/quill.snow.css"
 import { use, useState, useEffect } from "react"
@@ -47,9 +48,8 @@ export default function FictionEditPage({ params }: { params: Promise<{ fiction_
         const formDataObj = new FormData()
         formDataObj.append("cover", coverFile || "")
         Object.entries(formData).forEach(([key, value]) => formDataObj.append(key, value))
-        const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/u`, {
+        const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/u`, {
             method: "PUT",
-            credentials: "include",
             body: formDataObj,
         })
 
@@ -3,6 +3,7 @@
 import Image from "next/image"
 import { useState } from "react"
 import dynamic from "next/dynamic"
+import { csrfFetch } from "@/lib/csrf"
 import { useRouter } from "next/navigation"
 import "react-quill-new/dist/quill.snow.css"
 import { Fiction, FictionForm } from "@/types/types"
@@ -44,10 +45,9 @@ export default function FictionCreatePage() {
             }
 
             Object.entries(data).forEach(([key, value]) => formData.append(key, value))
-            const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/c`, {
+            const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/c`, {
                 method: "POST",
                 body: formData,
-                credentials: "include",
             })
 
             if (response.ok) {
@@ -4,6 +4,7 @@ import useSWR from "swr"
 import Link from "next/link"
 import Image from "next/image"
 import React, { Suspense } from "react"
+import { csrfFetch } from "@/lib/csrf"
 import { useState, useEffect } from "react"
 import { User, Fiction } from "@/types/types"
 import { useRouter, useSearchParams } from "next/navigation"
@@ -126,10 +127,9 @@ function FictionList({ fictions, emptyMessage, allowEdit, mutate, showCreated }:
         }
 
         try {
-            const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/d`, {
+            const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fiction_id}/d`, {
                 method: "DELETE",
                 headers: { "Content-Type": "application/json" },
-                credentials: "include",
             })
 
             if (!response.ok) {
@@ -2,6 +2,7 @@ import useSWR from "swr"
 import { useState } from "react"
 import { User } from "@/types/types"
 import { motion } from "framer-motion"
+import { csrfFetch } from "@/lib/csrf"
 
 interface ChapterActionsProps {
     fictionID:      number
@@ -40,9 +41,8 @@ export default function ChapterActions({ fictionID, chapterID, contributorID, mu
 
         setLoading(true)
         try {
-            const res = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fictionID}/${chapterID}/d`, {
+            const res = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fictionID}/${chapterID}/d`, {
                 method: "DELETE",
-                credentials: "include",
             })
 
             if (!res.ok) {
@@ -2,6 +2,7 @@
 
 import useSWR from "swr"
 import { useState } from "react"
+import { csrfFetch } from "@/lib/csrf"
 import { Heart, HeartOff } from "lucide-react"
 
 const fetcher = (URL: string) =>
@@ -43,10 +44,7 @@ export default function FavoriteButton({ fictionID }: { fictionID: number }) {
             const method = data.is_favorited ? "DELETE" : "POST"
             const endpoint = `${process.env.NEXT_PUBLIC_BACKEND_API}/f/${fictionID}/fav${data.is_favorited ? "/rmv" : ""}`
 
-            const res = await fetch(endpoint, {
-                method,
-                credentials: "include",
-            })
+            const res = await csrfFetch(endpoint, { method })
 
             if (res.status === 401) {
                 alert("You need to log in to favorite a fiction.")
@@ -1,4 +1,5 @@
 import { marked } from "marked"
+import { csrfFetch } from "@/lib/csrf"
 import { usePathname } from "next/navigation"
 import { useState, useEffect, useRef, useCallback } from "react"
 import { Menu, X, Bot, ImagePlus, ImageUp, ArrowUp } from "lucide-react"
@@ -40,18 +41,58 @@ export default function FloatingToolsMenu({ onImageInsert }: { onImageInsert?: (
         setMessages((prev) => [...prev, { text: inputPrompt, sender: "user" }])
         setInputPrompt("")
         try {
-            const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/ai/storyline/c`, {
+            const response = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/ai/storyline/stream`, {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
-                credentials: "include",
                 body: JSON.stringify({ Message: inputPrompt }),
             })
 
-            const data = await response.json()
-            const AIResponse = response.ok ? data.Received_Message : `Error: ${data.Error}`
+            if (!response.ok || !response.body) {
+                const data = await response.json()
+                const parsedMessage = await parseMarkdown(`Error: ${data.Error}`)
+                setMessages((prev) => [...prev, { text: parsedMessage, sender: "AI" }])
+            } else {
+                // Append an empty AI message and grow it as Server-Sent Events arrive
+                setMessages((prev) => [...prev, { text: "", sender: "AI" }])
+                setLoading(false)
+
+                const reader = response.body.getReader()
+                const decoder = new TextDecoder()
+                let buffer = ""
+                let AIResponse = ""
+                while (true) {
+                    const { done, value } = await reader.read()
+                    if (done) {
+                        break
+                    }
+
+                    buffer += decoder.decode(value, { stream: true })
+                    const events = buffer.split("\n\n")
+                    buffer = events.pop() ?? ""
+                    for (const event of events) {
+                        const type = event.match(/^event:(.*)$/m)?.[1].trim()
+                        const data = event.match(/^data:(.*)$/m)?.[1]
+                        if (!type || !data) {
+                            continue
+                        }
+
+                        const payload = JSON.parse(data)
+                        if (type === "delta") {
+                            AIResponse += payload.Content
+                        } else if (type === "error") {
+                            AIResponse += `\n\nError: ${payload.Error}`
+                        } else {
+                            continue
+                        }
 
-            const parsedMessage = await parseMarkdown(AIResponse)
-            setMessages((prev) => [...prev, { text: parsedMessage, sender: "AI" }])
+                        const parsedMessage = await parseMarkdown(AIResponse)
+                        setMessages((prev) => [...prev.slice(0, -1), { text: parsedMessage, sender: "AI" }])
+                        if (chatContainerRef.current) {
+                            chatContainerRef.current.scrollTop = chatContainerRef.current.scrollHeight
+                        }
+                    }
+                }
+            }
         } catch (error) {
             console.error("Error:", error)
             setMessages((prev) => [...prev, { text: "Failed to fetch AI response.", sender: "AI" }])
@@ -74,10 +115,9 @@ export default function FloatingToolsMenu({ onImageInsert }: { onImageInsert?: (
         const formData = new FormData()
         formData.append("image", file)
         try {
-            const res = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/images/upload`, {
+            const res = await csrfFetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/f/images/upload`, {
                 method: "POST",
                 body: formData,
-                credentials: "include",
             })
 
             const data = await res.json()
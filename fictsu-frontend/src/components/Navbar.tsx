@@ -3,6 +3,7 @@
 import Link from "next/link"
 import Image from "next/image"
 import { User } from "@/types/types"
+import { clearCsrfToken } from "@/lib/csrf"
 import { useEffect, useState, useRef } from "react"
 import { useRouter, usePathname } from "next/navigation"
 
@@ -21,9 +22,17 @@ export default function Navbar() {
             "width=960, height=540"
         )
 
+        // Popup blocked, fall back to the redirect flow and come back to this page
+        if (!authWindow) {
+            const returnTo = encodeURIComponent(window.location.pathname + window.location.search)
+            window.location.href = `${process.env.NEXT_PUBLIC_BACKEND_API}/auth/google?return_to=${returnTo}`
+            return
+        }
+
         const checkLogin = setInterval(() => {
-            if (!authWindow || authWindow.closed) {
+            if (authWindow.closed) {
                 clearInterval(checkLogin)
+                clearCsrfToken()
                 window.location.reload()
             }
         }, 1000)
@@ -34,6 +43,7 @@ export default function Navbar() {
             credentials: "include",
         })
 
+        clearCsrfToken()
         setUser(null)
         router.push("/")
     }
@@ -68,7 +78,9 @@ export default function Navbar() {
 
     useEffect(() => {
         const handleLoginSuccess = (event: MessageEvent) => {
-            if (event.origin === process.env.NEXT_PUBLIC_BACKEND_API && event.data === "login-success") {
+            // Origins never carry a path, so compare against the origin of the API URL
+            const backendOrigin = new URL(process.env.NEXT_PUBLIC_BACKEND_API as string).origin
+            if (event.origin === backendOrigin && event.data === "login-success") {
                 window.location.reload()
             }
         }
@@ -0,0 +1,43 @@
+let csrfToken: string | null = null
+
+const CSRF_ERROR = "Missing or invalid CSRF token"
+
+// The API runs on another origin, so its CSRF cookie can't be read here and the token is fetched instead
+export async function csrfHeaders(): Promise<Record<string, string>> {
+    if (!csrfToken) {
+        const res = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_API}/auth/csrf`, { credentials: "include" })
+        const data = await res.json()
+        csrfToken = data.csrf_token
+    }
+
+    return { "X-CSRF-Token": csrfToken ?? "" }
+}
+
+// The token is bound to the session, so it has to be fetched again after logging in or out
+export function clearCsrfToken() {
+    csrfToken = null
+}
+
+// fetch with the CSRF header and cookies. A session that rotated or expired since the token was fetched
+// gets a 403, then the token is fetched again and the request retried once.
+export async function csrfFetch(url: string, init: RequestInit = {}): Promise<Response> {
+    const send = async () =>
+        fetch(url, {
+            ...init,
+            headers: { ...(init.headers as Record<string, string> | undefined), ...(await csrfHeaders()) },
+            credentials: "include",
+        })
+
+    const res = await send()
+    if (res.status !== 403) {
+        return res
+    }
+
+    const data = await res.clone().json().catch(() => null)
+    if (data?.Error !== CSRF_ERROR) {
+        return res
+    }
+
+    clearCsrfToken()
+    return send()
+}